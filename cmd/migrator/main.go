@@ -1,49 +1,204 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
+	"strconv"
 
+	"github.com/Vykiy/house-service/internal/migrator"
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/lib/pq"
 )
 
+const usage = `Использование: migrator [флаги] <команда> [аргумент]
+
+Команды:
+  up [N]        применить все миграции или N следующих (по умолчанию, если команда не указана)
+  down N|all    откатить N последних миграций или все
+  steps N       применить N миграций, при отрицательном N - откатить
+  goto V        перейти к версии V вверх или вниз
+  version       показать текущую версию схемы
+  force V       записать версию V без выполнения миграций, снимает признак dirty
+  create NAME   создать пустые файлы следующей миграции
+
+Флаги:
+`
+
 func main() {
-	dbConnection := os.Getenv("DB_CONNECTION")
+	log.SetFlags(0)
 
-	db, err := sql.Open("postgres", dbConnection)
-	if err != nil {
-		log.Fatalln(err)
+	driver := flag.String("driver", envOrDefault("DB_DRIVER", "postgres"), "драйвер базы данных: postgres или sqlite (DB_DRIVER)")
+	dsn := flag.String("dsn", os.Getenv("DB_CONNECTION"), "строка подключения, для sqlite - путь к файлу (DB_CONNECTION)")
+	path := flag.String("path", "", "каталог миграций; по умолчанию используются встроенные, а create пишет в migrations или migrations_sqlite")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	defer db.Close()
+	command, args := "up", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
 
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
-	if err != nil {
+	if err := run(*driver, *dsn, *path, command, args); err != nil {
 		log.Fatalln(err)
 	}
+}
 
-	migrationsPath := filepath.Join("migrations")
+func run(driver, dsn, path, command string, args []string) error {
+	if command == "create" {
+		if len(args) != 1 {
+			return errors.New("create: укажите имя миграции")
+		}
+
+		if path == "" {
+			path = migrator.DefaultPath(driver)
+		}
+
+		up, down, err := migrator.Create(path, args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(up)
+		fmt.Println(down)
+		return nil
+	}
 
-	fmt.Println("Migrations path:", migrationsPath)
+	if len(args) > 1 {
+		return fmt.Errorf("%s: слишком много аргументов", command)
+	}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		"file:///"+migrationsPath,
-		"postgres", driver)
+	if path == "" {
+		fmt.Println("Migrations: embedded")
+	} else {
+		fmt.Println("Migrations path:", path)
+	}
+
+	m, err := migrator.New(driver, dsn, path)
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
+	defer m.Close()
 
-	if err := m.Up(); err != nil {
-		if err == migrate.ErrNoChange {
-			log.Println("No migrations to apply")
-			return
+	switch command {
+	case "up":
+		if len(args) == 0 {
+			err = m.Up()
+			break
 		}
-		log.Fatalln(err)
+
+		var n int
+		if n, err = positiveArg(command, args); err == nil {
+			err = m.Steps(n)
+		}
+	case "down":
+		if len(args) == 1 && args[0] == "all" {
+			err = m.Down()
+			break
+		}
+
+		var n int
+		if n, err = positiveArg(command, args); err == nil {
+			err = m.Steps(-n)
+		}
+	case "steps":
+		var n int
+		if n, err = intArg(command, args); err == nil && n == 0 {
+			err = errors.New("steps: число шагов не может быть нулевым")
+		}
+		if err == nil {
+			err = m.Steps(n)
+		}
+	case "goto":
+		var v int
+		if v, err = positiveArg(command, args); err == nil {
+			err = m.Migrate(uint(v))
+		}
+	case "force":
+		// -1 допускается: так golang-migrate обозначает пустую схему без примененных миграций
+		var v int
+		if v, err = intArg(command, args); err == nil && v < -1 {
+			err = fmt.Errorf("force: неверная версия %d", v)
+		}
+		if err == nil {
+			err = m.Force(v)
+		}
+	case "version":
+		if len(args) > 0 {
+			return errors.New("version: команда не принимает аргументов")
+		}
+	default:
+		return fmt.Errorf("неизвестная команда: %s", command)
 	}
+
+	if errors.Is(err, migrate.ErrNoChange) {
+		log.Println("No migrations to apply")
+	} else if err != nil {
+		return err
+	}
+
+	if command == "up" || command == "steps" || command == "goto" {
+		if err := migrator.Backfill(context.Background(), m, driver, dsn); err != nil {
+			return err
+		}
+	}
+
+	return printVersion(m)
+}
+
+func printVersion(m *migrate.Migrate) error {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		fmt.Println("Version: none")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if dirty {
+		fmt.Printf("Version: %d (dirty)\n", version)
+	} else {
+		fmt.Printf("Version: %d\n", version)
+	}
+
+	return nil
+}
+
+func intArg(command string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%s: укажите число", command)
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("%s: неверное число %q", command, args[0])
+	}
+
+	return n, nil
+}
+
+func positiveArg(command string, args []string) (int, error) {
+	n, err := intArg(command, args)
+	if err != nil {
+		return 0, err
+	}
+
+	if n <= 0 {
+		return 0, fmt.Errorf("%s: число должно быть положительным", command)
+	}
+
+	return n, nil
+}
+
+func envOrDefault(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return defaultValue
 }
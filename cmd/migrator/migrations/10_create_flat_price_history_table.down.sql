@@ -0,0 +1 @@
+DROP TABLE IF EXISTS flat_price_history;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- ключи с городом и индексом не подходят прежней версии; их пересчитает migrator.Backfill
+UPDATE houses SET address_key = NULL WHERE city <> '' OR postal_code <> '';
+
+ALTER TABLE houses ALTER COLUMN address_key TYPE VARCHAR(255);
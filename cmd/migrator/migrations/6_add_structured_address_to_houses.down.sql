@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS houses_address_key_idx;
+
+ALTER TABLE houses
+    DROP COLUMN IF EXISTS address_key,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude,
+    DROP COLUMN IF EXISTS postal_code,
+    DROP COLUMN IF EXISTS building,
+    DROP COLUMN IF EXISTS street,
+    DROP COLUMN IF EXISTS city;
\ No newline at end of file
@@ -0,0 +1,13 @@
+ALTER TABLE houses
+    ADD COLUMN IF NOT EXISTS city VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS street VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS building VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS postal_code VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS address_key VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS houses_address_key_idx ON houses (address_key);
+
+-- address_key домов, созданных до этой миграции, заполняет migrator.Backfill после применения миграций:
+-- правила нормализации адреса (регистр кириллицы, сокращения, служебные слова) не выражаются в SQL переносимо
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS houses_latitude_longitude_idx;
+DROP INDEX IF EXISTS houses_location_earth_idx;
+
+DROP EXTENSION IF EXISTS earthdistance;
+DROP EXTENSION IF EXISTS cube;
\ No newline at end of file
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS flats_house_id_price_idx;
+
+ALTER TABLE flats
+    DROP COLUMN IF EXISTS photos,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS floor,
+    DROP COLUMN IF EXISTS area;
\ No newline at end of file
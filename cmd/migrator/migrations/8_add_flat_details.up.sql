@@ -0,0 +1,7 @@
+ALTER TABLE flats
+    ADD COLUMN IF NOT EXISTS area DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS floor INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS photos TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS flats_house_id_price_idx ON flats (house_id, price);
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS flat_photos (
+    id SERIAL PRIMARY KEY,
+    flat_id INTEGER NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    thumbnail_key VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (flat_id) REFERENCES flats(id)
+);
+
+CREATE INDEX IF NOT EXISTS flat_photos_flat_id_idx ON flat_photos (flat_id);
\ No newline at end of file
@@ -0,0 +1,7 @@
+// Package migrations встраивает миграции схемы PostgreSQL в сервис и мигратор.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS flat_price_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    flat_id INTEGER NOT NULL,
+    price INTEGER NOT NULL,
+    changed_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    FOREIGN KEY (flat_id) REFERENCES flats(id)
+);
+
+CREATE INDEX IF NOT EXISTS flat_price_history_flat_id_idx ON flat_price_history (flat_id, changed_at);
+
+INSERT INTO flat_price_history (flat_id, price)
+SELECT id, price FROM flats;
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- ключи с городом и индексом не подходят прежней версии; их пересчитает migrator.Backfill
+UPDATE houses SET address_key = NULL WHERE city <> '' OR postal_code <> '';
@@ -0,0 +1,2 @@
+-- ключ адреса теперь включает город и индекс; ключи таких домов пересчитывает migrator.Backfill
+UPDATE houses SET address_key = NULL WHERE city <> '' OR postal_code <> '';
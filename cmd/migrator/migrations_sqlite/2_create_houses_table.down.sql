@@ -0,0 +1 @@
+DROP TABLE IF EXISTS houses;
\ No newline at end of file
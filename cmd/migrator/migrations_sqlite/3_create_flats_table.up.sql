@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS flats (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    flat_number INTEGER NOT NULL,
+    house_id INTEGER NOT NULL,
+    price INTEGER NOT NULL,
+    rooms INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    moderator_id TEXT,
+    CONSTRAINT unique_flat_number UNIQUE (house_id, flat_number),
+    FOREIGN KEY (house_id) REFERENCES houses(id),
+    FOREIGN KEY (moderator_id) REFERENCES users(id)
+);
\ No newline at end of file
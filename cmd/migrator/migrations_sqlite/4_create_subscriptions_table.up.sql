@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    house_id INTEGER NOT NULL,
+    email TEXT NOT NULL,
+    CONSTRAINT unique_subscription UNIQUE (house_id, email),
+    FOREIGN KEY (house_id) REFERENCES houses(id)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS flats_house_id_idx;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS flats_house_id_idx ON flats (house_id);
\ No newline at end of file
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS houses_address_key_idx;
+
+ALTER TABLE houses DROP COLUMN address_key;
+ALTER TABLE houses DROP COLUMN longitude;
+ALTER TABLE houses DROP COLUMN latitude;
+ALTER TABLE houses DROP COLUMN postal_code;
+ALTER TABLE houses DROP COLUMN building;
+ALTER TABLE houses DROP COLUMN street;
+ALTER TABLE houses DROP COLUMN city;
\ No newline at end of file
@@ -0,0 +1,12 @@
+ALTER TABLE houses ADD COLUMN city TEXT NOT NULL DEFAULT '';
+ALTER TABLE houses ADD COLUMN street TEXT NOT NULL DEFAULT '';
+ALTER TABLE houses ADD COLUMN building TEXT NOT NULL DEFAULT '';
+ALTER TABLE houses ADD COLUMN postal_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE houses ADD COLUMN latitude REAL;
+ALTER TABLE houses ADD COLUMN longitude REAL;
+ALTER TABLE houses ADD COLUMN address_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS houses_address_key_idx ON houses (address_key);
+
+-- address_key домов, созданных до этой миграции, заполняет migrator.Backfill после применения миграций:
+-- правила нормализации адреса (регистр кириллицы, сокращения, служебные слова) не выражаются в SQL переносимо
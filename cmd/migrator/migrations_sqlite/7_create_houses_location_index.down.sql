@@ -0,0 +1 @@
+DROP INDEX IF EXISTS houses_latitude_longitude_idx;
\ No newline at end of file
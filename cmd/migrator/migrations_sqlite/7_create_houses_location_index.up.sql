@@ -0,0 +1,2 @@
+-- earthdistance недоступен, поэтому поиск по радиусу сначала отбирает дома по прямоугольнику через этот индекс
+CREATE INDEX IF NOT EXISTS houses_latitude_longitude_idx ON houses (latitude, longitude);
\ No newline at end of file
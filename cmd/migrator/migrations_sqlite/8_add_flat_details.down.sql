@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS flats_house_id_price_idx;
+
+ALTER TABLE flats DROP COLUMN photos;
+ALTER TABLE flats DROP COLUMN description;
+ALTER TABLE flats DROP COLUMN floor;
+ALTER TABLE flats DROP COLUMN area;
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE flats ADD COLUMN area REAL NOT NULL DEFAULT 0;
+ALTER TABLE flats ADD COLUMN floor INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE flats ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE flats ADD COLUMN photos TEXT NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS flats_house_id_price_idx ON flats (house_id, price);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS flat_photos;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS flat_photos (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    flat_id INTEGER NOT NULL,
+    storage_key TEXT NOT NULL,
+    thumbnail_key TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+    FOREIGN KEY (flat_id) REFERENCES flats(id)
+);
+
+CREATE INDEX IF NOT EXISTS flat_photos_flat_id_idx ON flat_photos (flat_id);
\ No newline at end of file
@@ -0,0 +1,7 @@
+// Package migrations_sqlite встраивает миграции схемы SQLite в сервис и мигратор.
+package migrations_sqlite
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
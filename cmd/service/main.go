@@ -2,65 +2,430 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/cache"
 	"github.com/Vykiy/house-service/internal/config"
+	"github.com/Vykiy/house-service/internal/logging"
+	"github.com/Vykiy/house-service/internal/metrics"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/ratelimit"
 	"github.com/Vykiy/house-service/internal/repository"
+	"github.com/Vykiy/house-service/internal/repository/instrumented"
+	"github.com/Vykiy/house-service/internal/repository/sqlite"
 	"github.com/Vykiy/house-service/internal/router"
+	"github.com/Vykiy/house-service/internal/sender"
+	"github.com/Vykiy/house-service/internal/storage"
+	"github.com/Vykiy/house-service/internal/tlsutil"
+	"github.com/Vykiy/house-service/internal/tracing"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
 
+const (
+	rateLimitPruneInterval = time.Hour
+	// записи старше суток не влияют на ограничения, если LOGIN_LOCKOUT_WINDOW не больше суток
+	rateLimitRetention = 24 * time.Hour
+)
+
 func main() {
-	config := config.NewConfig()
+	config, command, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "ошибка конфигурации:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	if command.PrintConfig {
+		out, err := config.Redacted().YAML()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	logger, err := logging.Setup(config.LogLevel, os.Stdout)
+	if err != nil {
+		fatal("ошибка запуска сервиса", err)
+	}
 
-	db, err := sqlx.Connect("postgres", config.DBConnection)
+	shutdownTracing, err := tracing.Setup(context.Background(), config.TracingExporter, config.OTLPEndpoint, os.Stdout)
 	if err != nil {
-		log.Fatalln(err)
+		fatal("ошибка запуска сервиса", err)
+	}
+
+	if config.AutoMigrate {
+		if err := migrateDatabase(config); err != nil {
+			fatal("ошибка запуска сервиса", err)
+		}
+	}
+
+	db, repo, err := newRepository(config)
+	if err != nil {
+		fatal("ошибка запуска сервиса", err)
 	}
 	defer db.Close()
 
-	if err := db.Ping(); err != nil {
-		log.Fatalln(err)
+	if err := metrics.RegisterDB(db.DB, config.DBDriver); err != nil {
+		fatal("ошибка запуска сервиса", err)
 	}
 
-	repo := repository.NewRepository(db)
+	if err := metrics.RegisterStats(repo.GetStats); err != nil {
+		fatal("ошибка запуска сервиса", err)
+	}
 
-	app := app.NewApp(repo)
+	schema, err := checkSchema(config, db)
+	if err != nil {
+		fatal("ошибка запуска сервиса", err)
+	}
+
+	photoStorage, photos, err := newStorage(config)
+	if err != nil {
+		fatal("ошибка запуска сервиса", err)
+	}
+
+	senderBackend, err := newSenderBackend(config)
+	if err != nil {
+		fatal("ошибка запуска сервиса", err)
+	}
 
-	jwtIssuer := router.NewJWTIssuer(config.JWTSecret)
+	app := app.NewApp(repo, photoStorage)
+	app.SetSenderBackend(senderBackend)
+	if config.FlatsCacheSize > 0 {
+		app.SetFlatsCache(cache.NewLRU(config.FlatsCacheSize), config.FlatsCacheTTL)
+	}
+
+	jwtIssuer := router.NewJWTIssuer(config.JWTSecret, config.JWTPreviousSecrets...)
+
+	health := router.NewHealth(db, app, schema, func(ctx context.Context) (migrator.Schema, error) {
+		return migrator.CheckSchema(ctx, db.DB, config.DBDriver)
+	}, config.SchemaMismatch == "readonly")
+
+	authGuard := router.NewAuthGuard(newRateLimitStore(config, db), authLimits(config))
 
-	router := router.NewRouter(app, jwtIssuer)
+	cors := router.CORSConfig{
+		AllowedOrigins:   config.CORSAllowedOrigins,
+		AllowedMethods:   config.CORSAllowedMethods,
+		AllowedHeaders:   config.CORSAllowedHeaders,
+		ExposedHeaders:   config.CORSExposedHeaders,
+		AllowCredentials: config.CORSAllowCredentials,
+		MaxAge:           config.CORSMaxAge,
+	}
+
+	router := router.NewRouter(app, jwtIssuer, photos, health, authGuard, cors)
+
+	tlsReloader, err := newTLSReloader(config)
+	if err != nil {
+		fatal("ошибка запуска сервиса", err)
+	}
+
+	// при невалидном TLS_CLIENT_PRINCIPALS конфигурация не прошла бы проверку
+	principals, _ := tlsutil.ParsePrincipals(config.TLSClientPrincipals)
 
 	server := &http.Server{
-		Addr:    config.ServerAddress,
-		Handler: router,
+		Addr:              config.ServerAddress,
+		Handler:           principals.Middleware(router),
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
 	}
 
+	metricsServer := newMetricsServer(config, logger)
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			reloadConfig(config, jwtIssuer, authGuard, app, tlsReloader)
+		}
+	}()
+
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+
+	go health.Watch(watchCtx, config.SchemaCheckInterval)
+
+	if tlsReloader != nil {
+		server.TLSConfig = tlsReloader.TLSConfig()
+		go tlsReloader.Watch(watchCtx, config.TLSReloadInterval)
+	}
+
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Could not listen on %s: %v\n", server.Addr, err)
+		var err error
+		if tlsReloader != nil {
+			// сертификат берется из TLSConfig, пути к файлам не нужны
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("ошибка запуска сервера", err, "address", server.Addr)
 		}
 	}()
-	log.Printf("Server is ready to handle requests at %s", server.Addr)
+	slog.Info("сервер готов принимать запросы", "address", server.Addr, "tls", tlsReloader != nil)
+
+	if metricsServer != nil {
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("ошибка запуска сервера метрик", err, "address", metricsServer.Addr)
+			}
+		}()
+		slog.Info("метрики доступны", "address", metricsServer.Addr)
+	}
 
 	<-quit
-	log.Printf("Server is shutting down...")
+	slog.Info("остановка сервера")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	health.Drain()
+	time.Sleep(config.ShutdownDrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Could not gracefully shutdown the server: %v\n", err)
+		fatal("ошибка остановки сервера", err)
+	}
+	slog.Info("сервер остановлен")
+
+	// метрики отдаются до остановки основного сервера, чтобы последние запросы попали в сбор
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			slog.Error("ошибка остановки сервера метрик", "error", err)
+		}
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("ошибка отправки трасс", "error", err)
+	}
+}
+
+// reloadConfig перечитывает конфигурацию по SIGHUP и применяет уровень логов, секреты JWT, ограничения входа
+// и способ отправки уведомлений, а также перечитывает файлы сертификата TLS. Каждая часть заменяется атомарно, так что запросы в обработке дорабатывают со старыми настройками.
+// Если новая конфигурация некорректна, продолжает действовать прежняя. Остальные изменения
+// сравниваются с конфигурацией запуска и требуют перезапуска.
+func reloadConfig(initial *config.Config, jwtIssuer *router.JWTIssuer, authGuard *router.AuthGuard, application *app.App, tlsReloader *tlsutil.Reloader) {
+	next, _, err := config.Load(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		slog.Error("конфигурация не перечитана, действуют прежние настройки", "error", err)
+		return
+	}
+
+	senderBackend, err := newSenderBackend(next)
+	if err != nil {
+		slog.Error("конфигурация не перечитана, действуют прежние настройки", "error", err)
+		return
+	}
+
+	if err := logging.SetLevel(next.LogLevel); err != nil {
+		slog.Error("конфигурация не перечитана, действуют прежние настройки", "error", err)
+		return
+	}
+	jwtIssuer.SetSecrets(next.JWTSecret, next.JWTPreviousSecrets...)
+	authGuard.SetLimits(authLimits(next))
+	application.SetSenderBackend(senderBackend)
+
+	if tlsReloader != nil {
+		if err := tlsReloader.Reload(); err != nil {
+			slog.Error("сертификат TLS не перечитан, действует прежний", "error", err)
+		}
+	}
+
+	if fields := initial.RestartRequired(next); len(fields) > 0 {
+		slog.Warn("часть изменений вступит в силу только после перезапуска", "fields", fields)
+	}
+	slog.Info("конфигурация перечитана")
+}
+
+// fatal логирует ошибку и завершает процесс.
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append(args, "error", err)...)
+	os.Exit(1)
+}
+
+// newMetricsServer создает сервер /metrics на METRICS_ADDRESS. Адрес не должен публиковаться наружу:
+// метрики раскрывают внутреннее устройство сервиса, а сбор статистики нагружает базу. nil - адрес не задан.
+func newMetricsServer(config *config.Config, logger *slog.Logger) *http.Server {
+	if !config.MetricsEnabled() {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	return &http.Server{
+		Addr:              config.MetricsAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
+}
+
+// newTLSReloader загружает сертификат сервера, если он задан; без сертификата сервер работает по HTTP.
+func newTLSReloader(config *config.Config) (*tlsutil.Reloader, error) {
+	if config.TLSCertFile == "" {
+		return nil, nil
+	}
+
+	return tlsutil.NewReloader(config.TLSCertFile, config.TLSKeyFile, config.TLSClientCAFile, tlsutil.ClientAuth(config.TLSClientAuth))
+}
+
+// migrateDatabase применяет встроенные миграции. Реплики, запущенные одновременно, ждут друг друга
+// на блокировке, поэтому время ожидания ограничено не таймаутом запросов, а отдельной минутой.
+func migrateDatabase(config *config.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := migrator.Up(ctx, config.DBDriver, config.DBConnection); err != nil {
+		return fmt.Errorf("ошибка применения миграций: %w", err)
+	}
+
+	slog.Info("миграции базы данных применены")
+	return nil
+}
+
+// checkSchema сверяет версию схемы базы со встроенными миграциями. При расхождении сервис не запускается,
+// а с SCHEMA_MISMATCH=readonly запускается, если схема новее сервиса и не грязная, но отклоняет изменяющие
+// запросы: так старые реплики продолжают отдавать данные, пока идет выкатка новой версии. С устаревшей
+// или грязной схемой сервис не запускается ни в каком режиме. Дальше схема проверяется в фоне.
+func checkSchema(config *config.Config, db *sqlx.DB) (migrator.Schema, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	schema, err := migrator.CheckSchema(ctx, db.DB, config.DBDriver)
+	if err != nil {
+		return migrator.Schema{}, fmt.Errorf("ошибка проверки версии схемы базы данных: %w", err)
+	}
+
+	if err := schema.Err(); err != nil {
+		if config.SchemaMismatch != "readonly" || !schema.ReadOnlyCompatible() {
+			return schema, err
+		}
+
+		slog.Warn("схема базы данных не совпадает, сервис обслуживает только чтение", "error", err)
+	}
+
+	return schema, nil
+}
+
+// newRepository подключается к базе, выбранной в DB_DRIVER, и создает для нее репозиторий.
+func newRepository(config *config.Config) (*sqlx.DB, app.Repository, error) {
+	dsn := config.DBConnection
+	if config.DBDriver == "sqlite" {
+		dsn = sqlite.DSN(dsn)
+	}
+
+	db, err := tracing.OpenDB(config.DBDriver, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db.SetMaxOpenConns(config.DBMaxOpenConns)
+	db.SetMaxIdleConns(config.DBMaxIdleConns)
+	db.SetConnMaxLifetime(config.DBConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.DBConnMaxIdleTime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	switch config.DBDriver {
+	case "postgres":
+		return db, instrumented.NewRepository(repository.NewRepository(db, config.DBQueryTimeout)), nil
+	case "sqlite":
+		return db, instrumented.NewRepository(sqlite.NewRepository(db, config.DBQueryTimeout)), nil
+	default:
+		db.Close()
+		return nil, nil, fmt.Errorf("неизвестный драйвер базы данных: %s", config.DBDriver)
+	}
+}
+
+// newRateLimitStore создает хранилище ограничений входа. Для PostgreSQL старые записи удаляются раз в час.
+func newRateLimitStore(config *config.Config, db *sqlx.DB) ratelimit.Store {
+	if config.RateLimitStore != "postgres" {
+		return ratelimit.NewMemoryStore()
+	}
+
+	store := ratelimit.NewPostgresStore(db)
+	go func() {
+		for range time.Tick(rateLimitPruneInterval) {
+			ctx, cancel := context.WithTimeout(context.Background(), config.DBQueryTimeout)
+			if err := store.Prune(ctx, max(rateLimitRetention, config.LoginLockoutWindow)); err != nil {
+				slog.Error("очистка ограничений входа", "error", err)
+			}
+			cancel()
+		}
+	}()
+
+	return store
+}
+
+func authLimits(config *config.Config) router.AuthLimits {
+	// при невалидном TRUSTED_PROXIES конфигурация не прошла бы проверку
+	proxies := make([]netip.Prefix, 0, len(config.TrustedProxies))
+	for _, proxy := range config.TrustedProxies {
+		prefix, _ := netip.ParsePrefix(proxy)
+		proxies = append(proxies, prefix)
+	}
+
+	return router.AuthLimits{
+		IP:      ratelimit.Limit{Rate: config.AuthIPRate, Burst: config.AuthIPBurst},
+		Account: ratelimit.Limit{Rate: config.AuthAccountRate, Burst: config.AuthAccountBurst},
+		Lockout: ratelimit.LockoutPolicy{
+			Threshold: config.LoginLockoutThreshold,
+			BaseDelay: config.LoginLockoutBaseDelay,
+			MaxDelay:  config.LoginLockoutMaxDelay,
+			Window:    config.LoginLockoutWindow,
+		},
+		TrustedProxies: proxies,
+	}
+}
+
+// newSenderBackend создает способ отправки уведомлений подписчикам.
+func newSenderBackend(config *config.Config) (sender.Backend, error) {
+	return sender.NewBackend(config.SenderBackend, config.SenderMaxDelay, config.SenderFailureRate)
+}
+
+// newStorage создает хранилище фотографий. Для локального хранилища также возвращается
+// обработчик, раздающий файлы по подписанным ссылкам.
+func newStorage(config *config.Config) (storage.Storage, http.Handler, error) {
+	switch config.StorageBackend {
+	case "local":
+		local, err := storage.NewLocal(config.StoragePath, config.PhotosBaseURL, config.StorageURLSecret)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return local, local, nil
+	case "s3":
+		s3, err := storage.NewS3(config.S3Endpoint, config.S3Region, config.S3AccessKey, config.S3SecretKey, config.S3Bucket, config.S3UseSSL)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return s3, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("неизвестное хранилище фотографий: %s", config.StorageBackend)
 	}
-	log.Printf("Server stopped")
 }
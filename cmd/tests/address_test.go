@@ -0,0 +1,39 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+)
+
+func TestCreateHouseDuplicates(t *testing.T) {
+	ctx := context.Background()
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+
+	first, err := app.CreateHouse(ctx, models.House{City: "Москва", Street: "ул. Ленина", Building: "1", PostalCode: "101000", Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+
+	// тот же адрес строкой, город в начале адреса не мешает найти дубликат
+	existing, err := app.CreateHouse(ctx, models.House{Address: "г. Москва, улица Ленина, д. 1", City: "москва", PostalCode: "101000", Developer: "dev", YearBuilt: 2000})
+	if !errors.Is(err, appPkg.ErrHouseAlreadyExists) || existing.ID != first.ID {
+		t.Fatalf("дубликат не найден: %+v, %v", existing, err)
+	}
+
+	// та же улица в другом городе или с другим индексом - другой дом
+	for _, house := range []models.House{
+		{Address: "ул. Ленина, 1", City: "Казань", PostalCode: "101000"},
+		{Address: "ул. Ленина, 1", City: "Москва", PostalCode: "119019"},
+		{Address: "ул. Ленина, 1"},
+	} {
+		house.Developer, house.YearBuilt = "dev", 2000
+		if _, err := app.CreateHouse(ctx, house); err != nil {
+			t.Fatalf("дом %+v принят за дубликат: %v", house, err)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/cache"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/google/uuid"
+)
+
+// countingRepository считает выборки квартир и может задерживать их до закрытия gate.
+type countingRepository struct {
+	*memory.Repository
+	getFlats atomic.Int32
+	gate     chan struct{}
+}
+
+func (r *countingRepository) GetFlats(ctx context.Context, houseID int, filter models.FlatFilter) ([]models.Flat, error) {
+	r.getFlats.Add(1)
+	if r.gate != nil {
+		<-r.gate
+	}
+	return r.Repository.GetFlats(ctx, houseID, filter)
+}
+
+// failingCache - недоступный внешний кеш.
+type failingCache struct{}
+
+func (failingCache) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("кеш недоступен")
+}
+
+func (failingCache) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("кеш недоступен")
+}
+
+func (failingCache) Delete(context.Context, string) error {
+	return errors.New("кеш недоступен")
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU(2)
+
+	lru.Set(ctx, "a", []byte("1"), 0)
+	lru.Set(ctx, "b", []byte("2"), 0)
+	lru.Get(ctx, "a") // b становится самой давней
+	lru.Set(ctx, "c", []byte("3"), 0)
+
+	if _, found, _ := lru.Get(ctx, "b"); found {
+		t.Fatal("самая давняя запись должна быть вытеснена")
+	}
+	if value, found, _ := lru.Get(ctx, "a"); !found || string(value) != "1" {
+		t.Fatalf("недавно прочитанная запись вытеснена: %q", value)
+	}
+	if lru.Len() != 2 {
+		t.Fatalf("неверное число записей: %d", lru.Len())
+	}
+
+	lru.Delete(ctx, "a")
+	if _, found, _ := lru.Get(ctx, "a"); found {
+		t.Fatal("удаленная запись найдена")
+	}
+
+	lru.Set(ctx, "short", []byte("x"), 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, found, _ := lru.Get(ctx, "short"); found {
+		t.Fatal("устаревшая запись найдена")
+	}
+}
+
+func createFlat(t *testing.T, app *appPkg.App, houseID, price int) models.Flat {
+	t.Helper()
+
+	flat, err := app.CreateFlat(context.Background(), models.Flat{HouseID: houseID, Price: price, Rooms: 1, Area: 40})
+	if err != nil {
+		t.Fatalf("ошибка создания квартиры: %v", err)
+	}
+
+	return flat
+}
+
+func getFlats(t *testing.T, app *appPkg.App, houseID int, filter models.FlatFilter) []models.Flat {
+	t.Helper()
+
+	flats, err := app.GetFlats(context.Background(), houseID, filter)
+	if err != nil {
+		t.Fatalf("ошибка получения квартир: %v", err)
+	}
+
+	return flats
+}
+
+func TestFlatsCache(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingRepository{Repository: memory.NewRepository()}
+	app := appPkg.NewApp(repo, nil)
+	app.SetFlatsCache(cache.NewLRU(10), time.Minute)
+
+	house, err := app.CreateHouse(ctx, models.House{Address: "cache", Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+	createFlat(t, app, house.ID, 100)
+	createFlat(t, app, house.ID, 300)
+
+	if flats := getFlats(t, app, house.ID, models.FlatFilter{}); len(flats) != 2 || flats[0].PricePerSquareMeter != 2.5 {
+		t.Fatalf("неверные квартиры: %+v", flats)
+	}
+
+	// фильтр применяется к закешированному списку
+	minPrice := 200
+	if flats := getFlats(t, app, house.ID, models.FlatFilter{MinPrice: &minPrice}); len(flats) != 1 || flats[0].Price != 300 {
+		t.Fatalf("неверный результат фильтра: %+v", flats)
+	}
+	if calls := repo.getFlats.Load(); calls != 1 {
+		t.Fatalf("повторное чтение должно браться из кеша, выборок: %d", calls)
+	}
+
+	// изменение статуса сбрасывает кеш дома
+	if _, err := app.UpdateFlat(ctx, 1, models.FlatStatusApproved, uuid.Nil); err != nil {
+		t.Fatalf("ошибка обновления квартиры: %v", err)
+	}
+	if flats := getFlats(t, app, house.ID, models.FlatFilter{}); flats[0].Status != models.FlatStatusApproved {
+		t.Fatalf("после обновления отдан старый статус: %+v", flats[0])
+	}
+
+	createFlat(t, app, house.ID, 500)
+	if flats := getFlats(t, app, house.ID, models.FlatFilter{}); len(flats) != 3 {
+		t.Fatalf("после создания квартиры отдан старый список: %+v", flats)
+	}
+	if calls := repo.getFlats.Load(); calls != 3 {
+		t.Fatalf("ожидались выборки только после сбросов, выборок: %d", calls)
+	}
+
+	// другая реплика со своим кешем узнает об изменениях по времени изменения дома, не дожидаясь ttl
+	replica := appPkg.NewApp(repo, nil)
+	replica.SetFlatsCache(cache.NewLRU(10), time.Minute)
+	getFlats(t, replica, house.ID, models.FlatFilter{})
+	created := createFlat(t, app, house.ID, 700)
+	if flats := getFlats(t, replica, house.ID, models.FlatFilter{}); len(flats) != 4 {
+		t.Fatalf("реплика отдала устаревший список: %d квартир", len(flats))
+	}
+
+	if _, err := app.UpdateFlat(ctx, created.ID, models.FlatStatusApproved, uuid.Nil); err != nil {
+		t.Fatalf("ошибка обновления квартиры: %v", err)
+	}
+	if flats := getFlats(t, replica, house.ID, models.FlatFilter{}); flats[3].Status != models.FlatStatusApproved {
+		t.Fatalf("реплика отдала старый статус: %+v", flats[3])
+	}
+
+	if _, err := app.UpdateFlatPrice(ctx, created.ID, 800); err != nil {
+		t.Fatalf("ошибка изменения цены: %v", err)
+	}
+	if flats := getFlats(t, replica, house.ID, models.FlatFilter{}); flats[3].Price != 800 {
+		t.Fatalf("реплика отдала старую цену: %+v", flats[3])
+	}
+
+	if flats := getFlats(t, app, -1, models.FlatFilter{}); len(flats) != 0 {
+		t.Fatalf("у несуществующего дома не должно быть квартир: %+v", flats)
+	}
+}
+
+func TestFlatsCacheRoles(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingRepository{Repository: memory.NewRepository()}
+	app := appPkg.NewApp(repo, nil)
+	app.SetFlatsCache(cache.NewLRU(10), time.Minute)
+	server := newAPIServer(t, app)
+
+	house, err := app.CreateHouse(ctx, models.House{Address: "cache roles", Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+	approved := createFlat(t, app, house.ID, 100)
+	createFlat(t, app, house.ID, 200)
+	if _, err := app.UpdateFlat(ctx, approved.ID, models.FlatStatusApproved, uuid.Nil); err != nil {
+		t.Fatalf("ошибка обновления квартиры: %v", err)
+	}
+
+	list := func(userType models.UserType) []models.Flat {
+		t.Helper()
+
+		resp := doRequest(t, http.MethodGet, fmt.Sprintf("%s/house/%d", server.URL, house.ID), userType, "", nil)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: ожидался статус 200, получен %d", userType, resp.StatusCode)
+		}
+		var flats []models.Flat
+		if err := json.NewDecoder(resp.Body).Decode(&flats); err != nil {
+			t.Fatal(err)
+		}
+
+		return flats
+	}
+
+	// обе роли читают одну запись кеша, но видят разные списки, в любом порядке обращений
+	for _, userType := range []models.UserType{models.UserTypeModerator, models.UserTypeUser, models.UserTypeModerator, models.UserTypeUser} {
+		flats := list(userType)
+		if userType == models.UserTypeModerator && len(flats) != 2 {
+			t.Fatalf("модератор должен видеть все квартиры: %+v", flats)
+		}
+		if userType == models.UserTypeUser && (len(flats) != 1 || flats[0].ID != approved.ID) {
+			t.Fatalf("пользователь должен видеть только одобренные квартиры: %+v", flats)
+		}
+	}
+	if calls := repo.getFlats.Load(); calls != 1 {
+		t.Fatalf("все чтения после первого должны браться из кеша, выборок: %d", calls)
+	}
+}
+
+func TestFlatsCacheSingleflight(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingRepository{Repository: memory.NewRepository()}
+	app := appPkg.NewApp(repo, nil)
+	app.SetFlatsCache(cache.NewLRU(10), time.Minute)
+
+	house, err := app.CreateHouse(ctx, models.House{Address: "singleflight", Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+	createFlat(t, app, house.ID, 100)
+
+	repo.gate = make(chan struct{})
+
+	const readers = 20
+	var wg sync.WaitGroup
+	results := make(chan int, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			flats, err := app.GetFlats(ctx, house.ID, models.FlatFilter{})
+			if err != nil {
+				t.Error(err)
+			}
+			results <- len(flats)
+		}()
+	}
+
+	// даем остальным читателям дойти до ожидания первой загрузки
+	for repo.getFlats.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(repo.gate)
+	wg.Wait()
+	close(results)
+
+	for n := range results {
+		if n != 1 {
+			t.Fatalf("читатель получил неверный список: %d квартир", n)
+		}
+	}
+	if calls := repo.getFlats.Load(); calls != 1 {
+		t.Fatalf("одновременные промахи должны ждать одну загрузку, выборок: %d", calls)
+	}
+}
+
+func TestFlatsCacheUnavailable(t *testing.T) {
+	ctx := context.Background()
+	repo := &countingRepository{Repository: memory.NewRepository()}
+	app := appPkg.NewApp(repo, nil)
+	app.SetFlatsCache(failingCache{}, time.Minute)
+
+	house, err := app.CreateHouse(ctx, models.House{Address: "unavailable", Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+	createFlat(t, app, house.ID, 100)
+
+	// недоступный кеш не ломает чтение, данные берутся из хранилища
+	for i := 0; i < 2; i++ {
+		if flats := getFlats(t, app, house.ID, models.FlatFilter{}); len(flats) != 1 {
+			t.Fatalf("неверные квартиры: %+v", flats)
+		}
+	}
+	if calls := repo.getFlats.Load(); calls != 2 {
+		t.Fatalf("без кеша каждое чтение идет в хранилище, выборок: %d", calls)
+	}
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+func TestConcurrentFlatNumbering(t *testing.T) {
+	db, err := sqlx.Connect("postgres", os.Getenv("DB_CONNECTION"))
+	if err != nil {
+		t.Fatalf("ошибка подключения к базе данных: %v", err)
+	}
+	defer db.Close()
+
+	// запросов больше, чем соединений, чтобы транзакции действительно конкурировали за дом
+	db.SetMaxOpenConns(20)
+
+	ctx := context.Background()
+
+	app := appPkg.NewApp(repository.NewRepository(db, 0), nil)
+
+	house, err := app.CreateHouse(ctx, models.House{Address: "concurrency " + uuid.NewString(), Developer: "bar", YearBuilt: 2021})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+
+	const flatsCount = 300
+
+	var wg sync.WaitGroup
+	errs := make(chan error, flatsCount)
+	for i := 0; i < flatsCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := app.CreateFlat(ctx, models.Flat{HouseID: house.ID, Price: 1000, Rooms: 1}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("ошибка параллельного создания квартиры: %v", err)
+	}
+
+	flats, err := app.GetFlats(ctx, house.ID, models.FlatFilter{})
+	if err != nil {
+		t.Fatalf("ошибка получения квартир: %v", err)
+	}
+
+	if len(flats) != flatsCount {
+		t.Fatalf("неверное количество квартир: %d", len(flats))
+	}
+
+	for i, flat := range flats {
+		if flat.ID != i+1 {
+			t.Fatalf("номера квартир идут с пропуском: ожидался %d, получен %d", i+1, flat.ID)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/repository"
+	"github.com/Vykiy/house-service/internal/repository/instrumented"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/repository/repotest"
+	"github.com/Vykiy/house-service/internal/repository/sqlite"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+var (
+	_ app.Repository = (*repository.Repository)(nil)
+	_ app.Repository = (*memory.Repository)(nil)
+	_ app.Repository = (*sqlite.Repository)(nil)
+	_ app.Repository = (*instrumented.Repository)(nil)
+)
+
+func TestMemoryRepository(t *testing.T) {
+	repotest.Run(t, memory.NewRepository())
+}
+
+// TestInstrumentedRepository проверяет, что обертка с метриками не меняет поведение хранилища.
+func TestInstrumentedRepository(t *testing.T) {
+	repotest.Run(t, instrumented.NewRepository(memory.NewRepository()))
+}
+
+func TestPostgresRepository(t *testing.T) {
+	db, err := sqlx.Connect("postgres", os.Getenv("DB_CONNECTION"))
+	if err != nil {
+		t.Fatalf("ошибка подключения к базе данных: %v", err)
+	}
+	defer db.Close()
+
+	repotest.Run(t, repository.NewRepository(db, 0))
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "house-service.db")
+
+	db, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("ошибка открытия базы данных: %v", err)
+	}
+	defer db.Close()
+
+	if err := migrator.Up(context.Background(), "sqlite", path); err != nil {
+		t.Fatalf("ошибка применения миграций: %v", err)
+	}
+
+	repotest.Run(t, sqlite.NewRepository(db, 0))
+}
+
+func TestPostgresQueryTimeout(t *testing.T) {
+	db, err := sqlx.Connect("postgres", os.Getenv("DB_CONNECTION"))
+	if err != nil {
+		t.Fatalf("ошибка подключения к базе данных: %v", err)
+	}
+	defer db.Close()
+
+	testQueryTimeout(t, db, func(queryTimeout time.Duration) app.Repository {
+		return repository.NewRepository(db, queryTimeout)
+	})
+}
+
+func TestSQLiteQueryTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "house-service.db")
+
+	db, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("ошибка открытия базы данных: %v", err)
+	}
+	defer db.Close()
+
+	if err := migrator.Up(context.Background(), "sqlite", path); err != nil {
+		t.Fatalf("ошибка применения миграций: %v", err)
+	}
+
+	testQueryTimeout(t, db, func(queryTimeout time.Duration) app.Repository {
+		return sqlite.NewRepository(db, queryTimeout)
+	})
+}
+
+// testQueryTimeout проверяет, что запрос прерывается по истечении queryTimeout, по дедлайну и при отмене
+// контекста вызывающего. Единственное соединение пула занято транзакцией, поэтому запрос ждет его,
+// пока контекст не завершится.
+func testQueryTimeout(t *testing.T, db *sqlx.DB, newRepository func(queryTimeout time.Duration) app.Repository) {
+	db.SetMaxOpenConns(1)
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatalf("ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := func(ctx context.Context, queryTimeout time.Duration) error {
+		t.Helper()
+
+		start := time.Now()
+		_, err := newRepository(queryTimeout).GetFlat(ctx, 1)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("запрос не прерван вовремя: %s", elapsed)
+		}
+		return err
+	}
+
+	if err := query(context.Background(), 50*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("DB_QUERY_TIMEOUT: ожидалась context.DeadlineExceeded, получено %v", err)
+	}
+
+	// дедлайн вызывающего короче DB_QUERY_TIMEOUT
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := query(ctx, time.Hour); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("дедлайн контекста: ожидалась context.DeadlineExceeded, получено %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := query(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("отмена контекста: ожидалась context.Canceled, получено %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := query(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("отмененный контекст: ожидалась context.Canceled, получено %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/config"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/router"
+)
+
+const testOrigin = "https://app.example.com"
+
+func newCORSServer(t *testing.T, cors router.CORSConfig) *httptest.Server {
+	t.Helper()
+
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, nil, cors))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func preflight(t *testing.T, url, origin, method, headers string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodOptions, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp
+}
+
+func TestCORSPreflight(t *testing.T) {
+	defaults := config.Default()
+	server := newCORSServer(t, router.CORSConfig{
+		AllowedOrigins: []string{testOrigin},
+		AllowedMethods: defaults.CORSAllowedMethods,
+		AllowedHeaders: defaults.CORSAllowedHeaders,
+		ExposedHeaders: defaults.CORSExposedHeaders,
+		MaxAge:         10 * time.Minute,
+	})
+
+	// предварительный запрос проходит без токена и не доходит до обработчика
+	resp := preflight(t, server.URL+"/house/create", testOrigin, http.MethodPost, "authorization, content-type")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("ожидался статус 204, получен %d", resp.StatusCode)
+	}
+	for header, expected := range map[string]string{
+		"Access-Control-Allow-Origin":  testOrigin,
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Max-Age":       "600",
+		"Allow":                        "POST, OPTIONS",
+	} {
+		if value := resp.Header.Get(header); value != expected {
+			t.Fatalf("%s: ожидалось %q, получено %q", header, expected, value)
+		}
+	}
+	if !strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Fatalf("нет Authorization в Access-Control-Allow-Headers: %q", resp.Header.Get("Access-Control-Allow-Headers"))
+	}
+
+	if resp := preflight(t, server.URL+"/house/create", "https://evil.example.com", http.MethodPost, ""); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("чужой источник не должен получать разрешение")
+	}
+	if resp := preflight(t, server.URL+"/house/create", testOrigin, http.MethodGet, ""); resp.Header.Get("Access-Control-Allow-Methods") != "" {
+		t.Fatal("метод, которого нет у маршрута, не должен разрешаться")
+	}
+	if resp := preflight(t, server.URL+"/house/create", testOrigin, http.MethodPost, "X-Unknown"); resp.Header.Get("Access-Control-Allow-Methods") != "" {
+		t.Fatal("неразрешенный заголовок не должен пропускаться")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", testOrigin)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != testOrigin {
+		t.Fatalf("простой запрос: статус %d, Access-Control-Allow-Origin %q", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	if !strings.Contains(resp.Header.Get("Access-Control-Expose-Headers"), "X-Request-ID") || resp.Header.Get("Vary") != "Origin" {
+		t.Fatalf("неверные заголовки ответа: %v", resp.Header)
+	}
+}
+
+func TestCORSDisabled(t *testing.T) {
+	server := newCORSServer(t, router.CORSConfig{})
+
+	resp := preflight(t, server.URL+"/house/create", testOrigin, http.MethodPost, "")
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Allow") != "POST, OPTIONS" {
+		t.Fatalf("OPTIONS должен отвечать списком методов: статус %d, Allow %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("без настроенных источников CORS должен быть выключен")
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	server := newCORSServer(t, router.CORSConfig{})
+
+	resp, err := http.Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for header, expected := range map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "no-referrer",
+		"Content-Security-Policy": "default-src 'none'; frame-ancestors 'none'",
+	} {
+		if value := resp.Header.Get(header); value != expected {
+			t.Fatalf("%s: ожидалось %q, получено %q", header, expected, value)
+		}
+	}
+	if resp.Header.Get("Strict-Transport-Security") != "" {
+		t.Fatal("HSTS отправляется только по HTTPS")
+	}
+}
+
+func TestHeadersOnUnmatchedRoutes(t *testing.T) {
+	server := newCORSServer(t, router.CORSConfig{AllowedOrigins: []string{testOrigin}, AllowedMethods: config.Default().CORSAllowedMethods})
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/unknown", http.StatusNotFound},
+		{http.MethodOptions, "/unknown", http.StatusNotFound},
+		{http.MethodDelete, "/login", http.StatusMethodNotAllowed},
+	} {
+		req, err := http.NewRequest(tc.method, server.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", testOrigin)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%s %s: ожидался статус %d, получен %d", tc.method, tc.path, tc.status, resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Fatalf("%s %s: нет заголовков безопасности, X-Content-Type-Options = %q", tc.method, tc.path, got)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != testOrigin {
+			t.Fatalf("%s %s: нет заголовков CORS, Access-Control-Allow-Origin = %q", tc.method, tc.path, got)
+		}
+		if resp.Header.Get("X-Request-ID") == "" {
+			t.Fatalf("%s %s: нет идентификатора запроса", tc.method, tc.path)
+		}
+	}
+}
+
+func TestCORSConfigValidation(t *testing.T) {
+	env := map[string]string{"JWT_SECRET": "secret", "DB_CONNECTION": "db", "STORAGE_URL_SECRET": "photos-secret", "CORS_ALLOWED_ORIGINS": "*", "CORS_ALLOW_CREDENTIALS": "true"}
+	if _, _, err := config.Load(nil, envMap(env)); err == nil || !strings.Contains(err.Error(), "CORS_ALLOWED_ORIGINS") {
+		t.Fatalf("ожидалась ошибка для \"*\" вместе с передачей учетных данных: %v", err)
+	}
+
+	env = map[string]string{"JWT_SECRET": "secret", "DB_CONNECTION": "db", "STORAGE_URL_SECRET": "photos-secret", "CORS_ALLOWED_ORIGINS": "https://app.example.com, app.example.com"}
+	if _, _, err := config.Load(nil, envMap(env)); err == nil || !strings.Contains(err.Error(), `"app.example.com"`) {
+		t.Fatalf("ожидалась ошибка для источника без схемы: %v", err)
+	}
+}
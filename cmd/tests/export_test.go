@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/xuri/excelize/v2"
+)
+
+var (
+	exportHouseHeader = []string{"id", "address", "city", "street", "building", "postal_code", "latitude", "longitude", "year_built", "developer", "created_at", "updated_at"}
+	exportFlatHeader  = []string{"house_id", "flat_number", "status", "price", "rooms", "area", "price_per_square_meter", "floor", "description", "photos"}
+)
+
+// newExportServer создает дом в прямоугольнике (55..56, 37..38) с двумя квартирами, дом вне его с одной квартирой
+// и дом без координат.
+func newExportServer(t *testing.T) (string, []models.House) {
+	t.Helper()
+
+	ctx := context.Background()
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	server := newAPIServer(t, app)
+
+	var houses []models.House
+	for _, coordinates := range [][]float64{{55.75, 37.6}, {59.9, 30.3}, nil} {
+		house := models.House{Address: "export " + string(rune('a'+len(houses))), Developer: "dev", YearBuilt: 2000}
+		if coordinates != nil {
+			house.Latitude, house.Longitude = &coordinates[0], &coordinates[1]
+		}
+
+		created, err := app.CreateHouse(ctx, house)
+		if err != nil {
+			t.Fatalf("ошибка создания дома: %v", err)
+		}
+		houses = append(houses, created)
+	}
+
+	createFlat(t, app, houses[0].ID, 100)
+	createFlat(t, app, houses[0].ID, 300)
+	createFlat(t, app, houses[1].ID, 500)
+
+	return server.URL, houses
+}
+
+func exportRequest(t *testing.T, url string, contentType, filename string) *http.Response {
+	t.Helper()
+
+	resp := doRequest(t, http.MethodGet, url, models.UserTypeModerator, "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ожидался статус 200, получен %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Type") != contentType {
+		t.Fatalf("неверный Content-Type: %q", resp.Header.Get("Content-Type"))
+	}
+	if disposition := resp.Header.Get("Content-Disposition"); disposition != `attachment; filename="`+filename+`"` {
+		t.Fatalf("неверный Content-Disposition: %q", disposition)
+	}
+
+	return resp
+}
+
+func TestExportCSV(t *testing.T) {
+	url, houses := newExportServer(t)
+
+	resp := exportRequest(t, url+"/export/houses", "text/csv; charset=utf-8", "houses.csv")
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("ошибка разбора CSV: %v", err)
+	}
+	if len(records) != 4 || !slices.Equal(records[0], exportHouseHeader) {
+		t.Fatalf("неверная выгрузка домов: %v", records)
+	}
+	// у дома без координат широта и долгота пустые
+	if records[3][6] != "" || records[3][7] != "" || records[1][1] != houses[0].Address {
+		t.Fatalf("неверные строки домов: %v", records[1:])
+	}
+
+	resp = exportRequest(t, url+"/export/flats?format=csv&min_price=200", "text/csv; charset=utf-8", "flats.csv")
+	records, err = csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("ошибка разбора CSV: %v", err)
+	}
+	if len(records) != 3 || !slices.Equal(records[0], exportFlatHeader) || records[1][3] != "300" || records[2][3] != "500" {
+		t.Fatalf("неверная выгрузка квартир с фильтром: %v", records)
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	url, houses := newExportServer(t)
+
+	resp := exportRequest(t, url+"/export/houses?format=ndjson&min_lat=55&min_lon=37&max_lat=56&max_lon=38", "application/x-ndjson", "houses.ndjson")
+	var exported []models.House
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var house models.House
+		if err := json.Unmarshal(scanner.Bytes(), &house); err != nil {
+			t.Fatalf("ошибка разбора строки %q: %v", scanner.Text(), err)
+		}
+		exported = append(exported, house)
+	}
+	if len(exported) != 1 || exported[0].ID != houses[0].ID {
+		t.Fatalf("прямоугольник не применен к выгрузке: %+v", exported)
+	}
+
+	resp = exportRequest(t, url+"/export/flats?format=ndjson&house_id="+strconv.Itoa(houses[0].ID), "application/x-ndjson", "flats.ndjson")
+	var flats []models.Flat
+	scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var flat models.Flat
+		if err := json.Unmarshal(scanner.Bytes(), &flat); err != nil {
+			t.Fatalf("ошибка разбора строки %q: %v", scanner.Text(), err)
+		}
+		flats = append(flats, flat)
+	}
+	if len(flats) != 2 || flats[0].HouseID != houses[0].ID || flats[1].Price != 300 || flats[1].PricePerSquareMeter != 7.5 {
+		t.Fatalf("неверная выгрузка квартир дома: %+v", flats)
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	url, _ := newExportServer(t)
+
+	resp := exportRequest(t, url+"/export/flats?format=xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "flats.xlsx")
+	file, err := excelize.OpenReader(resp.Body)
+	if err != nil {
+		t.Fatalf("ошибка открытия XLSX: %v", err)
+	}
+	defer file.Close()
+
+	rows, err := file.GetRows("Sheet1")
+	if err != nil {
+		t.Fatalf("ошибка чтения листа: %v", err)
+	}
+	if len(rows) != 4 || !slices.Equal(rows[0], exportFlatHeader) || rows[3][3] != "500" {
+		t.Fatalf("неверная выгрузка XLSX: %v", rows)
+	}
+}
+
+func TestExportRejected(t *testing.T) {
+	url, _ := newExportServer(t)
+
+	for _, tc := range []struct {
+		path     string
+		userType models.UserType
+		status   int
+	}{
+		{"/export/houses", models.UserTypeUser, http.StatusForbidden},
+		{"/export/flats", models.UserTypeUser, http.StatusForbidden},
+		{"/export/flats", "", http.StatusForbidden},
+		{"/export/houses?format=xml", models.UserTypeModerator, http.StatusBadRequest},
+		{"/export/houses?min_lat=55&min_lon=37&max_lat=56", models.UserTypeModerator, http.StatusBadRequest},
+		{"/export/houses?min_lat=56&min_lon=37&max_lat=55&max_lon=38", models.UserTypeModerator, http.StatusBadRequest},
+		{"/export/flats?format=pdf", models.UserTypeModerator, http.StatusBadRequest},
+		{"/export/flats?house_id=abc", models.UserTypeModerator, http.StatusBadRequest},
+		{"/export/flats?min_price=-1", models.UserTypeModerator, http.StatusBadRequest},
+	} {
+		if resp := doRequest(t, http.MethodGet, url+tc.path, tc.userType, "", nil); resp.StatusCode != tc.status {
+			t.Fatalf("%s (%q): ожидался статус %d, получен %d", tc.path, tc.userType, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestExportEscapesFormulas(t *testing.T) {
+	ctx := context.Background()
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	server := newAPIServer(t, app)
+
+	house, err := app.CreateHouse(ctx, models.House{Address: "@export formulas", Developer: "-dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+
+	const description = `=HYPERLINK("http://example.com","x")`
+	if _, err := app.CreateFlat(ctx, models.Flat{HouseID: house.ID, Price: 100, Rooms: 1, Area: 40, Description: description}); err != nil {
+		t.Fatalf("ошибка создания квартиры: %v", err)
+	}
+
+	// текст, с которого табличный редактор начал бы формулу, выгружается с префиксом "'"
+	resp := exportRequest(t, server.URL+"/export/flats", "text/csv; charset=utf-8", "flats.csv")
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("ошибка разбора CSV: %v", err)
+	}
+	if len(records) != 2 || records[1][8] != "'"+description || records[1][3] != "100" {
+		t.Fatalf("формула в CSV не экранирована: %v", records)
+	}
+
+	resp = exportRequest(t, server.URL+"/export/houses", "text/csv; charset=utf-8", "houses.csv")
+	if records, err = csv.NewReader(resp.Body).ReadAll(); err != nil {
+		t.Fatalf("ошибка разбора CSV: %v", err)
+	}
+	if len(records) != 2 || records[1][1] != "'@export formulas" || records[1][9] != "'-dev" {
+		t.Fatalf("адрес и застройщик в CSV не экранированы: %v", records)
+	}
+
+	resp = exportRequest(t, server.URL+"/export/flats?format=xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "flats.xlsx")
+	file, err := excelize.OpenReader(resp.Body)
+	if err != nil {
+		t.Fatalf("ошибка открытия XLSX: %v", err)
+	}
+	defer file.Close()
+
+	if formula, err := file.GetCellFormula("Sheet1", "I2"); err != nil || formula != "" {
+		t.Fatalf("описание выгружено как формула %q: %v", formula, err)
+	}
+	if value, err := file.GetCellValue("Sheet1", "I2"); err != nil || value != "'"+description {
+		t.Fatalf("формула в XLSX не экранирована: %q, %v", value, err)
+	}
+
+	// NDJSON в табличных редакторах не открывается и выгружается как есть
+	resp = exportRequest(t, server.URL+"/export/flats?format=ndjson", "application/x-ndjson", "flats.ndjson")
+	var flat models.Flat
+	if err := json.NewDecoder(resp.Body).Decode(&flat); err != nil || flat.Description != description {
+		t.Fatalf("неверное описание в NDJSON: %q, %v", flat.Description, err)
+	}
+}
+
+// failingExportRepository - хранилище, в котором выгрузка квартир обрывается ошибкой.
+type failingExportRepository struct {
+	*memory.Repository
+}
+
+func (failingExportRepository) StreamFlats(context.Context, *int, models.FlatFilter, func(models.Flat) error) error {
+	return errors.New("база недоступна")
+}
+
+func TestExportFailure(t *testing.T) {
+	server := newAPIServer(t, appPkg.NewApp(failingExportRepository{memory.NewRepository()}, nil))
+
+	// ошибка до начала передачи возвращается обычным ответом, а не вложением
+	for _, format := range []string{"csv", "xlsx"} {
+		resp := doRequest(t, http.MethodGet, server.URL+"/export/flats?format="+format, models.UserTypeModerator, "", nil)
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("%s: ожидался статус 500, получен %d", format, resp.StatusCode)
+		}
+		if disposition := resp.Header.Get("Content-Disposition"); disposition != "" {
+			t.Fatalf("%s: ошибка отдана как вложение: %q", format, disposition)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(body)) != "ошибка выгрузки" {
+			t.Fatalf("%s: в ответ попали данные выгрузки: %q", format, body)
+		}
+	}
+}
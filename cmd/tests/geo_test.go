@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/router"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+func TestHousesNearby(t *testing.T) {
+	db, err := sqlx.Connect("postgres", os.Getenv("DB_CONNECTION"))
+	if err != nil {
+		t.Fatalf("ошибка подключения к базе данных: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	app := appPkg.NewApp(repository.NewRepository(db, 0), nil)
+
+	// случайная точка, чтобы дома из прошлых запусков не попадали в выборку
+	lat := rand.Float64()*100 - 50
+	lon := rand.Float64()*300 - 150
+
+	// смещения по широте: ~0 м, ~550 м, ~5.5 км
+	offsets := []float64{0, 0.005, 0.05}
+	ids := make([]int, 0, len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		houseLat, houseLon := lat+offsets[i], lon
+		house, err := app.CreateHouse(ctx, models.House{
+			Address:   "geo " + uuid.NewString(),
+			Developer: "geo",
+			YearBuilt: 2020,
+			Latitude:  &houseLat,
+			Longitude: &houseLon,
+		})
+		if err != nil {
+			t.Fatalf("ошибка создания дома: %v", err)
+		}
+		ids = append([]int{house.ID}, ids...)
+	}
+
+	houses, err := app.GetHousesNearby(ctx, lat, lon, 1000, 10)
+	if err != nil {
+		t.Fatalf("ошибка поиска домов в радиусе: %v", err)
+	}
+
+	if len(houses) != 2 {
+		t.Fatalf("неверное количество домов в радиусе: %d", len(houses))
+	} else if houses[0].ID != ids[0] || houses[1].ID != ids[1] {
+		t.Fatalf("неверный порядок домов в радиусе")
+	} else if houses[1].Distance < 500 || houses[1].Distance > 600 {
+		t.Fatalf("неверное расстояние до дома: %f", houses[1].Distance)
+	}
+
+	houses, err = app.GetHousesInBox(ctx, lat-0.01, lon-0.01, lat+0.1, lon+0.01, lat+0.1, lon, 10)
+	if err != nil {
+		t.Fatalf("ошибка поиска домов в прямоугольнике: %v", err)
+	}
+
+	if len(houses) != 3 {
+		t.Fatalf("неверное количество домов в прямоугольнике: %d", len(houses))
+	} else if houses[0].ID != ids[2] || houses[2].ID != ids[0] {
+		t.Fatalf("неверный порядок домов в прямоугольнике")
+	}
+}
+
+// newAPIServer запускает API поверх репозитория в памяти.
+func newAPIServer(t *testing.T, app *appPkg.App) *httptest.Server {
+	t.Helper()
+
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, nil, router.CORSConfig{}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// doRequest выполняет запрос с токеном пользователя userType; пустой userType - без токена.
+func doRequest(t *testing.T, method, url string, userType models.UserType, contentType string, body io.Reader) *http.Response {
+	t.Helper()
+
+	return doRequestAs(t, method, url, userType, uuid.New(), contentType, body)
+}
+
+// doRequestAs выполняет запрос с токеном пользователя userID.
+func doRequestAs(t *testing.T, method, url string, userType models.UserType, userID uuid.UUID, contentType string, body io.Reader) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userType != "" {
+		token, err := router.NewJWTIssuer("secret").IssueToken(userType, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func TestHousesInBoxAntimeridian(t *testing.T) {
+	ctx := context.Background()
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	server := newAPIServer(t, app)
+
+	ids := make([]int, 0, 3)
+	for _, lon := range []float64{179.9, -179.99, 0} {
+		lat, lon := 10.0, lon
+		house, err := app.CreateHouse(ctx, models.House{Address: "meridian " + uuid.NewString(), Developer: "geo", YearBuilt: 2020, Latitude: &lat, Longitude: &lon})
+		if err != nil {
+			t.Fatalf("ошибка создания дома: %v", err)
+		}
+		ids = append(ids, house.ID)
+	}
+
+	// min_lon > max_lon - прямоугольник через 180-й меридиан, центр на -180
+	resp := doRequest(t, http.MethodGet, server.URL+"/houses/nearby?min_lat=9&max_lat=11&min_lon=179&max_lon=-179", models.UserTypeUser, "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ожидался статус 200, получен %d", resp.StatusCode)
+	}
+
+	var houses []models.NearbyHouse
+	if err := json.NewDecoder(resp.Body).Decode(&houses); err != nil {
+		t.Fatalf("ошибка разбора ответа: %v", err)
+	}
+	if len(houses) != 2 || houses[0].ID != ids[1] || houses[1].ID != ids[0] {
+		t.Fatalf("неверные дома в прямоугольнике через меридиан: %+v", houses)
+	}
+
+	for _, query := range []string{
+		"min_lat=11&max_lat=9&min_lon=179&max_lon=-179",
+		"min_lat=9&max_lat=11&min_lon=181&max_lon=-179",
+		"min_lat=9&max_lat=11&min_lon=179",
+	} {
+		if resp := doRequest(t, http.MethodGet, server.URL+"/houses/nearby?"+query, models.UserTypeUser, "", nil); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: ожидался статус 400, получен %d", query, resp.StatusCode)
+		}
+	}
+}
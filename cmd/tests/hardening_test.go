@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/logging"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/router"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestMalformedTokens(t *testing.T) {
+	const secret = "secret"
+
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	validUserID := uuid.NewString()
+
+	tokens := map[string]string{
+		"мусор":                  "not-a-jwt",
+		"три точки":              "a.b.c",
+		"чужой секрет":           sign(jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{"user_type": "moderator", "user_id": validUserID}),
+		"алгоритм none":          sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{"user_type": "moderator", "user_id": validUserID}),
+		"другой HMAC":            sign(jwt.SigningMethodHS512, []byte(secret), jwt.MapClaims{"user_type": "moderator", "user_id": validUserID}),
+		"нет user_id":            sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"user_type": "moderator"}),
+		"user_id не строка":      sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"user_type": "moderator", "user_id": 42}),
+		"user_id не UUID":        sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"user_type": "moderator", "user_id": "42"}),
+		"нет user_type":          sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"user_id": validUserID}),
+		"user_type не строка":    sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"user_type": true, "user_id": validUserID}),
+		"истекший срок действия": sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"user_type": "moderator", "user_id": validUserID, "exp": 1}),
+	}
+
+	issuer := router.NewJWTIssuer(secret)
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	server := httptest.NewServer(router.NewRouter(app, issuer, nil, health, nil, router.CORSConfig{}))
+	defer server.Close()
+
+	for name, token := range tokens {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := issuer.ParseToken(token); err == nil {
+				t.Fatal("ожидалась ошибка разбора токена")
+			}
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/house/1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", token)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Fatalf("ожидался статус 401, получен %d", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRecoverPanic(t *testing.T) {
+	logs := setupLogging(t)
+
+	handler := logging.RequestIDMiddleware(router.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("неожиданная ошибка")
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(logging.RequestIDHeader, "panic-request")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("ожидался статус 500, получен %d", recorder.Code)
+	}
+
+	var body struct {
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("ответ не в формате JSON: %v: %s", err, recorder.Body.String())
+	}
+	if body.Message == "" || body.RequestID != "panic-request" {
+		t.Fatalf("неверный ответ: %+v", body)
+	}
+
+	for _, record := range logs.records(t) {
+		if record["panic"] == "неожиданная ошибка" {
+			if stack, _ := record["stack"].(string); !strings.Contains(stack, "TestRecoverPanic") {
+				t.Fatalf("в логе нет стека паники: %v", record["stack"])
+			}
+			return
+		}
+	}
+
+	t.Fatalf("паника не залогирована:\n%s", logs.String())
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, nil, router.CORSConfig{}))
+	defer server.Close()
+
+	body := `{"email":"` + strings.Repeat("a", 2<<20) + `@example.com","password":"password","user_type":"user"}`
+	resp, err := http.Post(server.URL+"/register", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("ожидался статус 413, получен %d", resp.StatusCode)
+	}
+}
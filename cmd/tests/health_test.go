@@ -0,0 +1,279 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/repository/sqlite"
+	"github.com/Vykiy/house-service/internal/router"
+)
+
+func TestSQLiteSchemaCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "house-service.db")
+
+	db, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("ошибка открытия базы данных: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	schema, err := migrator.CheckSchema(ctx, db.DB, "sqlite")
+	if err != nil {
+		t.Fatalf("ошибка проверки схемы: %v", err)
+	}
+
+	if schema.Version != 0 || schema.Expected == 0 || schema.Err() == nil {
+		t.Fatalf("пустая база должна считаться устаревшей: %+v", schema)
+	}
+
+	if err := migrator.Up(ctx, "sqlite", path); err != nil {
+		t.Fatalf("ошибка применения миграций: %v", err)
+	}
+
+	schema, err = migrator.CheckSchema(ctx, db.DB, "sqlite")
+	if err != nil {
+		t.Fatalf("ошибка проверки схемы: %v", err)
+	}
+
+	if schema.Version != schema.Expected || schema.Err() != nil {
+		t.Fatalf("после миграций схема должна совпадать: %+v", schema)
+	}
+
+	if (migrator.Schema{Version: schema.Expected + 1, Expected: schema.Expected}).Err() == nil {
+		t.Fatal("схема новее сервиса должна считаться расхождением")
+	}
+
+	if (migrator.Schema{Version: schema.Expected, Expected: schema.Expected, Dirty: true}).Err() == nil {
+		t.Fatal("схема в состоянии dirty должна считаться расхождением")
+	}
+}
+
+// schemaServer поднимает сервис, который видит схему из current; изменения схемы сервис замечает
+// только после RefreshSchema, как при фоновой проверке.
+func schemaServer(t *testing.T, current *atomic.Pointer[migrator.Schema], readOnly bool) (*httptest.Server, *router.Health) {
+	t.Helper()
+
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, *current.Load(), func(context.Context) (migrator.Schema, error) {
+		return *current.Load(), nil
+	}, readOnly)
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, nil, router.CORSConfig{}))
+	t.Cleanup(server.Close)
+
+	return server, health
+}
+
+type schemaReadyResponse struct {
+	Status string `json:"status"`
+	Schema struct {
+		Status   string `json:"status"`
+		Version  uint   `json:"version"`
+		Expected uint   `json:"expected"`
+		Error    string `json:"error"`
+	} `json:"schema"`
+}
+
+func schemaReady(t *testing.T, server *httptest.Server) (int, schemaReadyResponse) {
+	t.Helper()
+
+	resp, err := http.Get(server.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body schemaReadyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("ошибка разбора ответа /readyz: %v", err)
+	}
+
+	return resp.StatusCode, body
+}
+
+func schemaRegister(t *testing.T, server *httptest.Server, email string) int {
+	t.Helper()
+
+	resp, err := http.Post(server.URL+"/register", "application/json", strings.NewReader(`{"email":"`+email+`","password":"password","user_type":"user"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	// схема, которую видит сервис; меняется по ходу теста, как при выкатке миграций другой репликой
+	var current atomic.Pointer[migrator.Schema]
+	current.Store(&migrator.Schema{Version: 11, Expected: 10})
+	server, health := schemaServer(t, &current, true)
+
+	if status := schemaRegister(t, server, "first@example.com"); status != http.StatusServiceUnavailable {
+		t.Fatalf("изменяющий запрос в режиме только для чтения: ожидался статус 503, получен %d", status)
+	}
+
+	resp, err := http.Get(server.URL + "/dummyLogin?user_type=user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("чтение в режиме только для чтения: ожидался статус 200, получен %d", resp.StatusCode)
+	}
+
+	// вход ничего не меняет в схеме, поэтому пропускается: неверный пароль, а не 503
+	resp, err = http.Post(server.URL+"/login", "application/json", strings.NewReader(`{"id":"00000000-0000-0000-0000-000000000000","password":"password"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		t.Fatal("вход не должен отклоняться в режиме только для чтения")
+	}
+
+	if code, body := schemaReady(t, server); code != http.StatusOK || body.Schema.Status != "read-only" || body.Schema.Version != 11 || body.Schema.Expected != 10 || body.Schema.Error == "" {
+		t.Fatalf("неверный ответ /readyz: %d %+v", code, body)
+	}
+
+	// проверки готовности не перечитывают схему: до фоновой проверки режим не меняется
+	current.Store(&migrator.Schema{Version: 10, Expected: 10})
+	if code, body := schemaReady(t, server); code != http.StatusOK || body.Schema.Version != 11 {
+		t.Fatalf("схема должна меняться только фоновой проверкой: %d %+v", code, body)
+	}
+
+	health.RefreshSchema(context.Background())
+	if code, body := schemaReady(t, server); code != http.StatusOK || body.Schema.Status != "ok" || body.Schema.Version != 10 {
+		t.Fatalf("схема должна совпадать: %d %+v", code, body)
+	}
+	if status := schemaRegister(t, server, "second@example.com"); status != http.StatusCreated && status != http.StatusOK {
+		t.Fatalf("при совпадающей схеме изменяющие запросы должны проходить, получен статус %d", status)
+	}
+
+	// устаревшая и грязная схемы недопустимы и в режиме только для чтения
+	for _, schema := range []migrator.Schema{{Version: 9, Expected: 10}, {Version: 11, Expected: 10, Dirty: true}} {
+		current.Store(&schema)
+		health.RefreshSchema(context.Background())
+
+		if code, body := schemaReady(t, server); code != http.StatusServiceUnavailable || body.Status != "fail" || body.Schema.Status != "fail" {
+			t.Fatalf("схема %+v: ожидалась неготовность, получено %d %+v", schema, code, body)
+		}
+		if status := schemaRegister(t, server, "third@example.com"); status != http.StatusServiceUnavailable {
+			t.Fatalf("схема %+v: ожидался статус 503 для изменяющего запроса, получен %d", schema, status)
+		}
+	}
+}
+
+func TestSchemaMismatchFailMode(t *testing.T) {
+	var current atomic.Pointer[migrator.Schema]
+	current.Store(&migrator.Schema{Version: 10, Expected: 10})
+	server, health := schemaServer(t, &current, false)
+
+	// схему обновила новая версия сервиса: без режима только для чтения реплика выходит из ротации
+	current.Store(&migrator.Schema{Version: 11, Expected: 10})
+	health.RefreshSchema(context.Background())
+
+	if code, body := schemaReady(t, server); code != http.StatusServiceUnavailable || body.Status != "fail" || body.Schema.Status != "fail" || body.Schema.Error == "" {
+		t.Fatalf("расхождение схемы в режиме fail: ожидалась неготовность, получено %d %+v", code, body)
+	}
+
+	// запрет изменений включается только режимом только для чтения
+	if status := schemaRegister(t, server, "fail@example.com"); status == http.StatusServiceUnavailable {
+		t.Fatal("в режиме fail изменяющие запросы не должны отклоняться шлюзом только для чтения")
+	}
+
+	current.Store(&migrator.Schema{Version: 10, Expected: 10})
+	health.RefreshSchema(context.Background())
+	if code, body := schemaReady(t, server); code != http.StatusOK || body.Schema.Status != "ok" {
+		t.Fatalf("после совпадения схемы сервис должен быть готов: %d %+v", code, body)
+	}
+}
+
+func TestSchemaRefreshError(t *testing.T) {
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{Version: 10, Expected: 10}, func(context.Context) (migrator.Schema, error) {
+		return migrator.Schema{}, errors.New("нет соединения")
+	}, false)
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, nil, router.CORSConfig{}))
+	defer server.Close()
+
+	health.RefreshSchema(context.Background())
+	if code, body := schemaReady(t, server); code != http.StatusServiceUnavailable || body.Schema.Status != "fail" || body.Schema.Version != 10 {
+		t.Fatalf("ошибка проверки схемы: ожидалась неготовность с прежней версией, получено %d %+v", code, body)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	var dbErr error
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return dbErr }), app, migrator.Schema{Version: 10, Expected: 10}, nil, false)
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, nil, router.CORSConfig{}))
+	defer server.Close()
+
+	ready := func() (int, string, string) {
+		t.Helper()
+
+		resp, err := http.Get(server.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var body struct {
+			Status   string `json:"status"`
+			Database struct {
+				Status string `json:"status"`
+			} `json:"database"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("ошибка разбора ответа /readyz: %v", err)
+		}
+
+		return resp.StatusCode, body.Status, body.Database.Status
+	}
+
+	if code, status, database := ready(); code != http.StatusOK || status != "ok" || database != "ok" {
+		t.Fatalf("исправный сервис должен быть готов: %d %s %s", code, status, database)
+	}
+
+	dbErr = errors.New("connection refused")
+	if code, status, database := ready(); code != http.StatusServiceUnavailable || status != "fail" || database != "fail" {
+		t.Fatalf("без базы сервис не должен быть готов: %d %s %s", code, status, database)
+	}
+
+	dbErr = nil
+	health.Drain()
+	if code, status, _ := ready(); code != http.StatusServiceUnavailable || status != "draining" {
+		t.Fatalf("при остановке сервис не должен быть готов: %d %s", code, status)
+	}
+
+	// живость не зависит ни от базы, ни от остановки
+	resp, err := http.Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/healthz: ожидался статус 200, получен %d", resp.StatusCode)
+	}
+}
+
+type pingerFunc func(ctx context.Context) error
+
+func (f pingerFunc) PingContext(ctx context.Context) error {
+	return f(ctx)
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+)
+
+type importReport struct {
+	Errors []struct {
+		Row   int    `json:"row"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+func TestImportFlats(t *testing.T) {
+	ctx := context.Background()
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	server := newAPIServer(t, app)
+
+	house, err := app.CreateHouse(ctx, models.House{Address: "import", Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+	url := fmt.Sprintf("%s/house/%d/flats:import", server.URL, house.ID)
+
+	importFlats := func(contentType, body string) *http.Response {
+		t.Helper()
+		return doRequest(t, http.MethodPost, url, models.UserTypeUser, contentType, strings.NewReader(body))
+	}
+
+	// ошибки формата и проверки перечисляются вместе, строки нумеруются по порядку в файле
+	resp := importFlats("application/json", `[
+		{"price": 100, "rooms": 1},
+		{"price": "дорого", "rooms": 1},
+		{"price": 100, "rooms": 0},
+		{"price": 100, "rooms": 1, "balcony": true},
+		{"price": -1, "rooms": 2}
+	]`)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("ожидался статус 422, получен %d", resp.StatusCode)
+	}
+
+	var report importReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("ошибка разбора отчета: %v", err)
+	}
+	if len(report.Errors) != 4 {
+		t.Fatalf("неверный отчет об ошибках: %+v", report)
+	}
+	for i, expected := range []struct {
+		row   int
+		error string
+	}{{2, "неверный формат строки"}, {3, "неверное количество комнат"}, {4, "неверный формат строки"}, {5, "неверная цена"}} {
+		if report.Errors[i].Row != expected.row || !strings.Contains(report.Errors[i].Error, expected.error) {
+			t.Fatalf("ошибка %d: ожидалась строка %d с %q, получено %+v", i, expected.row, expected.error, report.Errors[i])
+		}
+	}
+
+	resp = importFlats("text/csv", "price,rooms,area\n100,1,40\n200,x,50\n300,2\n-1,1,10\n")
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("CSV: ожидался статус 422, получен %d", resp.StatusCode)
+	}
+
+	report = importReport{}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("ошибка разбора отчета: %v", err)
+	}
+	if len(report.Errors) != 3 || report.Errors[0].Row != 2 || report.Errors[1].Row != 3 || report.Errors[2].Row != 4 {
+		t.Fatalf("неверный отчет об ошибках CSV: %+v", report)
+	}
+
+	// отклоненный импорт не создает ни одной квартиры, даже из верных строк
+	if flats := getFlats(t, app, house.ID, models.FlatFilter{}); len(flats) != 0 {
+		t.Fatalf("после отклоненного импорта созданы квартиры: %+v", flats)
+	}
+
+	resp = importFlats("text/csv; charset=utf-8", "Price, rooms ,area,floor,description,photos\n100,1,\"40,5\",3,с балконом,a.jpg|b.jpg\n200,2,,,,\n")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("ожидался статус 201, получен %d", resp.StatusCode)
+	}
+
+	var created []models.Flat
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("ошибка разбора ответа: %v", err)
+	}
+	if len(created) != 2 || created[0].Area != 40.5 || created[0].Floor != 3 || len(created[0].Photos) != 2 || created[1].Price != 200 {
+		t.Fatalf("неверные квартиры: %+v", created)
+	}
+	if flats := getFlats(t, app, house.ID, models.FlatFilter{}); len(flats) != 2 {
+		t.Fatalf("неверное число квартир после импорта: %d", len(flats))
+	}
+}
+
+func TestImportFlatsRejected(t *testing.T) {
+	ctx := context.Background()
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	server := newAPIServer(t, app)
+
+	house, err := app.CreateHouse(ctx, models.House{Address: "import rejected", Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+
+	tooManyRows := "[" + strings.Repeat(`{"price":1,"rooms":1},`, 5000) + `{"price":1,"rooms":1}]`
+	tooLarge := `[{"price":1,"rooms":1,"description":"` + strings.Repeat("x", 10<<20) + `"}]`
+
+	for _, tc := range []struct {
+		name        string
+		houseID     int
+		contentType string
+		body        string
+		status      int
+		message     string
+	}{
+		{"неизвестная колонка", house.ID, "text/csv", "price,rooms,balcony\n1,1,yes\n", http.StatusBadRequest, "неизвестная колонка"},
+		{"повтор колонки", house.ID, "text/csv", "price,rooms,Price\n1,1,2\n", http.StatusBadRequest, "повторяется колонка"},
+		{"нет обязательной колонки", house.ID, "text/csv", "price,area\n1,40\n", http.StatusBadRequest, "нет обязательной колонки \"rooms\""},
+		{"пустой CSV", house.ID, "text/csv", "", http.StatusBadRequest, "нет квартир"},
+		{"не массив", house.ID, "application/json", `{"price":1,"rooms":1}`, http.StatusBadRequest, "неверный формат запроса"},
+		{"слишком много строк", house.ID, "application/json", tooManyRows, http.StatusRequestEntityTooLarge, "максимум 5000"},
+		{"слишком большой файл", house.ID, "application/json", tooLarge, http.StatusRequestEntityTooLarge, "слишком большой"},
+		{"неподдерживаемый тип", house.ID, "application/xml", "<flats/>", http.StatusUnsupportedMediaType, ""},
+		{"без типа", house.ID, "", "[]", http.StatusUnsupportedMediaType, ""},
+		{"нет дома", house.ID + 1000, "application/json", `[{"price":1,"rooms":1}]`, http.StatusNotFound, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			url := fmt.Sprintf("%s/house/%d/flats:import", server.URL, tc.houseID)
+			resp := doRequest(t, http.MethodPost, url, models.UserTypeUser, tc.contentType, strings.NewReader(tc.body))
+			if resp.StatusCode != tc.status {
+				t.Fatalf("ожидался статус %d, получен %d", tc.status, resp.StatusCode)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(body), tc.message) {
+				t.Fatalf("в ответе нет %q: %s", tc.message, body)
+			}
+		})
+	}
+
+	if flats := getFlats(t, app, house.ID, models.FlatFilter{}); len(flats) != 0 {
+		t.Fatalf("отклоненные импорты создали квартиры: %+v", flats)
+	}
+}
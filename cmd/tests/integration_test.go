@@ -1,12 +1,16 @@
 package tests
 
 import (
+	"context"
+	"errors"
 	"os"
+	"strings"
 	"testing"
 
-	"github.com/Vykiy/house-service/internal/app"
+	appPkg "github.com/Vykiy/house-service/internal/app"
 	"github.com/Vykiy/house-service/internal/models"
 	"github.com/Vykiy/house-service/internal/repository"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 )
@@ -23,21 +27,23 @@ func TestIntegration(t *testing.T) {
 		t.Fatalf("ошибка пинга базы данных: %v", err)
 	}
 
-	repo := repository.NewRepository(db)
+	repo := repository.NewRepository(db, 0)
 
-	app := app.NewApp(repo)
+	ctx := context.Background()
+
+	app := appPkg.NewApp(repo, nil)
 
 	const (
 		mail     = "bla"
 		password = "blabla"
 	)
 
-	userID, err := app.CreateUser(mail, password, models.UserTypeModerator)
+	userID, err := app.CreateUser(ctx, mail, password, models.UserTypeModerator)
 	if err != nil {
 		t.Fatalf("ошибка создания пользователя: %v", err)
 	}
 
-	ok, userType, err := app.CheckUserPassword(userID, password)
+	ok, userType, err := app.CheckUserPassword(ctx, userID, password)
 	if err != nil {
 		t.Fatalf("ошибка проверки пароля: %v", err)
 	}
@@ -51,12 +57,13 @@ func TestIntegration(t *testing.T) {
 	}
 
 	const (
-		address   = "foo"
 		developer = "bar"
 		yearBuilt = 2021
 	)
 
-	house, err := app.CreateHouse(address, developer, yearBuilt)
+	address := "foo " + uuid.NewString() // адрес должен быть уникальным между запусками
+
+	house, err := app.CreateHouse(ctx, models.House{Address: address, Developer: developer, YearBuilt: yearBuilt})
 	if err != nil {
 		t.Fatalf("ошибка создания дома: %v", err)
 	}
@@ -69,12 +76,23 @@ func TestIntegration(t *testing.T) {
 		t.Fatalf("неверный год постройки")
 	}
 
+	duplicate, err := app.CreateHouse(ctx, models.House{Address: "  " + strings.ToUpper(address) + ". ", Developer: developer, YearBuilt: yearBuilt})
+	if !errors.Is(err, appPkg.ErrHouseAlreadyExists) {
+		t.Fatalf("дубликат дома не обнаружен: %v", err)
+	}
+
+	if duplicate.ID != house.ID {
+		t.Fatalf("неверный ID существующего дома")
+	}
+
 	const (
 		price = 1000000
 		rooms = 3
+		area  = 62.5
+		floor = 4
 	)
 
-	flat, err := app.CreateFlat(house.ID, price, rooms)
+	flat, err := app.CreateFlat(ctx, models.Flat{HouseID: house.ID, Price: price, Rooms: rooms, Area: area, Floor: floor, Photos: []string{"photo.jpg"}})
 	if err != nil {
 		t.Fatalf("ошибка создания квартиры: %v", err)
 	}
@@ -85,7 +103,7 @@ func TestIntegration(t *testing.T) {
 		t.Fatalf("неверное количество комнат")
 	}
 
-	flats, err := app.GetFlats(house.ID)
+	flats, err := app.GetFlats(ctx, house.ID, models.FlatFilter{})
 	if err != nil {
 		t.Fatalf("ошибка получения квартир: %v", err)
 	}
@@ -98,9 +116,23 @@ func TestIntegration(t *testing.T) {
 		t.Fatalf("неверная цена квартиры")
 	} else if flats[0].Rooms != rooms {
 		t.Fatalf("неверное количество комнат")
+	} else if flats[0].Area != area || flats[0].Floor != floor || len(flats[0].Photos) != 1 {
+		t.Fatalf("неверные характеристики квартиры")
+	} else if flats[0].PricePerSquareMeter != 16000 {
+		t.Fatalf("неверная цена квадратного метра")
 	}
 
-	updatedFlat, err := app.UpdateFlat(flat.ID, models.FlatStatusOnModeration)
+	minPrice := price + 1
+	flats, err = app.GetFlats(ctx, house.ID, models.FlatFilter{MinPrice: &minPrice})
+	if err != nil {
+		t.Fatalf("ошибка получения квартир: %v", err)
+	}
+
+	if len(flats) != 0 {
+		t.Fatalf("фильтр по цене не применен")
+	}
+
+	updatedFlat, err := app.UpdateFlat(ctx, flat.ID, models.FlatStatusOnModeration, uuid.Nil)
 	if err != nil {
 		t.Fatalf("ошибка обновления статуса квартиры: %v", err)
 	}
@@ -108,4 +140,42 @@ func TestIntegration(t *testing.T) {
 	if updatedFlat.Status != models.FlatStatusOnModeration {
 		t.Fatalf("неверный статус квартиры")
 	}
+
+	const newPrice = 900000
+
+	pricedFlat, err := app.UpdateFlatPrice(ctx, flat.ID, newPrice)
+	if err != nil {
+		t.Fatalf("ошибка обновления цены квартиры: %v", err)
+	}
+
+	if pricedFlat.Price != newPrice {
+		t.Fatalf("неверная цена квартиры после обновления")
+	}
+
+	prices, err := app.GetFlatPrices(ctx, flat.ID)
+	if err != nil {
+		t.Fatalf("ошибка получения истории цен: %v", err)
+	}
+
+	if len(prices) != 2 || prices[0].Price != price || prices[1].Price != newPrice {
+		t.Fatalf("неверная история цен: %v", prices)
+	}
+
+	imported, err := app.ImportFlats(ctx, house.ID, []models.Flat{{Price: 1, Rooms: 1}, {Price: 2, Rooms: 2}})
+	if err != nil {
+		t.Fatalf("ошибка импорта квартир: %v", err)
+	}
+
+	if len(imported) != 2 {
+		t.Fatalf("неверное количество импортированных квартир")
+	}
+
+	flats, err = app.GetFlats(ctx, house.ID, models.FlatFilter{})
+	if err != nil {
+		t.Fatalf("ошибка получения квартир: %v", err)
+	}
+
+	if len(flats) != 3 || flats[1].ID != 2 || flats[2].ID != 3 {
+		t.Fatalf("неверная нумерация импортированных квартир")
+	}
 }
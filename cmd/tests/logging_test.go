@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/logging"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/router"
+	"github.com/google/uuid"
+)
+
+// logBuffer собирает JSON-записи логов; в него пишут обработчики запросов из разных горутин.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *logBuffer) records(t *testing.T) []map[string]interface{} {
+	t.Helper()
+
+	var result []map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(b.String()))
+	for {
+		var record map[string]interface{}
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("ошибка разбора записи лога: %v", err)
+		}
+		result = append(result, record)
+	}
+
+	return result
+}
+
+// setupLogging перенаправляет логгер по умолчанию в буфер до конца теста.
+func setupLogging(t *testing.T) *logBuffer {
+	t.Helper()
+
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	logs := &logBuffer{}
+	if _, err := logging.Setup("debug", logs); err != nil {
+		t.Fatalf("ошибка настройки логов: %v", err)
+	}
+
+	return logs
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := setupLogging(t)
+
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, nil, router.CORSConfig{}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/dummyLogin?user_type=moderator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generated := resp.Header.Get(logging.RequestIDHeader)
+	if _, err := uuid.Parse(generated); err != nil {
+		t.Fatalf("ожидался сгенерированный идентификатор запроса, получено %q", generated)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/house/create", strings.NewReader(`{"address":"logging `+uuid.NewString()+`","year":2000,"developer":"dev"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", string(token))
+	req.Header.Set(logging.RequestIDHeader, "test-request-id")
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ошибка создания дома: статус %d", resp.StatusCode)
+	}
+	if requestID := resp.Header.Get(logging.RequestIDHeader); requestID != "test-request-id" {
+		t.Fatalf("идентификатор запроса не передан в ответ: %q", requestID)
+	}
+
+	if strings.Contains(logs.String(), string(token)) {
+		t.Fatal("токен попал в логи")
+	}
+
+	for _, record := range logs.records(t) {
+		if record["msg"] != "запрос обработан" || record["route"] != "/house/create" {
+			continue
+		}
+
+		if record["request_id"] != "test-request-id" {
+			t.Fatalf("неверный request_id в журнале доступа: %v", record["request_id"])
+		}
+		if record["status"] != float64(http.StatusOK) {
+			t.Fatalf("неверный статус в журнале доступа: %v", record["status"])
+		}
+		if _, err := uuid.Parse(record["user_id"].(string)); err != nil {
+			t.Fatalf("нет user_id в журнале доступа: %v", record["user_id"])
+		}
+		if _, ok := record["latency_ms"]; !ok {
+			t.Fatal("нет latency_ms в журнале доступа")
+		}
+		return
+	}
+
+	t.Fatalf("нет записи журнала доступа для /house/create:\n%s", logs.String())
+}
+
+func TestLogRedaction(t *testing.T) {
+	logs := setupLogging(t)
+
+	slog.Info("вход", "password", "p@ssw0rd", "password_hash", "$2a$10$hash", "token", "jwt-value", "Authorization", "Bearer value")
+
+	output := logs.String()
+	for _, secret := range []string{"p@ssw0rd", "$2a$10$hash", "jwt-value", "Bearer value"} {
+		if strings.Contains(output, secret) {
+			t.Fatalf("значение %q попало в логи: %s", secret, output)
+		}
+	}
+
+	if !strings.Contains(output, "[REDACTED]") {
+		t.Fatalf("ожидались скрытые значения: %s", output)
+	}
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/metrics"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/repository/instrumented"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/router"
+	"github.com/google/uuid"
+)
+
+func TestMetrics(t *testing.T) {
+	repo := instrumented.NewRepository(memory.NewRepository())
+	app := appPkg.NewApp(repo, nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, nil, router.CORSConfig{}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/dummyLogin?user_type=user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if _, err := repo.GetUser(context.Background(), uuid.New()); err == nil {
+		t.Fatal("ожидалась ошибка для несуществующего пользователя")
+	}
+
+	// основной API метрики не отдает, они доступны только на METRICS_ADDRESS
+	resp, err = http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("/metrics на основном адресе: ожидался статус 404, получен %d", resp.StatusCode)
+	}
+
+	metricsServer := httptest.NewServer(metrics.Handler())
+	defer metricsServer.Close()
+
+	resp, err = http.Get(metricsServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, metric := range []string{
+		`house_service_http_request_duration_seconds_count{method="GET",route="/dummyLogin",status="200"}`,
+		`house_service_db_query_duration_seconds_count{operation="get_user",result="not_found"}`,
+	} {
+		if !strings.Contains(string(body), metric) {
+			t.Fatalf("в /metrics нет метрики %s", metric)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository/sqlite"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/google/uuid"
+)
+
+// TestPostgresMigrationsUpDownUp откатывает все миграции, поэтому работает с отдельной временной базой,
+// а не с базой из DB_CONNECTION.
+func TestPostgresMigrationsUpDownUp(t *testing.T) {
+	testMigrationsUpDownUp(t, "postgres", throwawayDatabase(t, os.Getenv("DB_CONNECTION")), "../migrator/migrations")
+}
+
+func TestSQLiteMigrationsUpDownUp(t *testing.T) {
+	testMigrationsUpDownUp(t, "sqlite", filepath.Join(t.TempDir(), "house-service.db"), "../migrator/migrations_sqlite")
+}
+
+// TestPostgresAutoMigrateConcurrent имитирует одновременный запуск нескольких реплик с AUTO_MIGRATE.
+func TestPostgresAutoMigrateConcurrent(t *testing.T) {
+	const replicas = 5
+
+	// реплики должны применять миграции с нуля, иначе одновременный запуск ничего не проверяет
+	dsn := throwawayDatabase(t, os.Getenv("DB_CONNECTION"))
+	m, err := migrator.New("postgres", dsn, "")
+	if err != nil {
+		t.Fatalf("ошибка подготовки миграций: %v", err)
+	}
+	if err := m.Down(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("ошибка отката миграций: %v", err)
+	}
+	if _, _, err := m.Version(); !errors.Is(err, migrate.ErrNilVersion) {
+		t.Fatalf("перед запуском реплик версия схемы должна отсутствовать: %v", err)
+	}
+	m.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, replicas)
+	for i := 0; i < replicas; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := migrator.Up(context.Background(), "postgres", dsn); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("ошибка применения миграций: %v", err)
+	}
+
+	assertEmbeddedVersion(t, "postgres", dsn, "../migrator/migrations")
+}
+
+func TestSQLiteAutoMigrate(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "house-service.db")
+
+	// повторный запуск не должен ничего менять и не должен считаться ошибкой
+	for i := 0; i < 2; i++ {
+		if err := migrator.Up(context.Background(), "sqlite", dsn); err != nil {
+			t.Fatalf("ошибка применения миграций: %v", err)
+		}
+	}
+
+	assertEmbeddedVersion(t, "sqlite", dsn, "../migrator/migrations_sqlite")
+}
+
+// assertEmbeddedVersion проверяет, что встроенные миграции довели схему до последней версии из каталога path.
+func assertEmbeddedVersion(t *testing.T, driver, dsn, path string) {
+	t.Helper()
+
+	m, err := migrator.New(driver, dsn, path)
+	if err != nil {
+		t.Fatalf("ошибка подготовки миграций: %v", err)
+	}
+	defer m.Close()
+
+	version, dirty, err := m.Version()
+	if err != nil || dirty {
+		t.Fatalf("неверная версия схемы: %d, dirty=%v, %v", version, dirty, err)
+	}
+
+	if err := m.Up(); !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("после автоматического применения остались миграции: %v", err)
+	}
+}
+
+// TestAddressKeyBackfill проверяет, что дома, созданные до появления address_key, получают ключ
+// и находятся как дубликаты при создании дома с тем же адресом.
+func TestAddressKeyBackfill(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "house-service.db")
+
+	m, err := migrator.New("sqlite", dsn, "")
+	if err != nil {
+		t.Fatalf("ошибка подготовки миграций: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Migrate(5); err != nil {
+		t.Fatalf("ошибка применения миграций до версии 5: %v", err)
+	}
+
+	db, err := sqlite.Open(dsn)
+	if err != nil {
+		t.Fatalf("ошибка открытия базы данных: %v", err)
+	}
+	defer db.Close()
+
+	for _, address := range []string{"г. Москва, ул. Ленина, д. 1", "Москва, улица Ленина, 1", "Казань, пр. Победы 5", "---"} {
+		if _, err := db.ExecContext(ctx, "INSERT INTO houses (year_built, address, developer) VALUES (2000, ?, 'dev')", address); err != nil {
+			t.Fatalf("ошибка создания дома: %v", err)
+		}
+	}
+
+	// повторный запуск не должен ничего менять
+	for i := 0; i < 2; i++ {
+		if err := migrator.Up(ctx, "sqlite", dsn); err != nil {
+			t.Fatalf("ошибка применения миграций: %v", err)
+		}
+	}
+
+	var keys []sql.NullString
+	if err := db.SelectContext(ctx, &keys, "SELECT address_key FROM houses ORDER BY id"); err != nil {
+		t.Fatalf("ошибка чтения ключей адреса: %v", err)
+	}
+
+	// второй дом - дубликат первого, у адреса из одной пунктуации ключа нет
+	want := []sql.NullString{{String: "москва улица ленина 1", Valid: true}, {}, {String: "казань проспект победы 5", Valid: true}, {}}
+	if len(keys) != len(want) {
+		t.Fatalf("неверное число домов: %d", len(keys))
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("неверный ключ адреса дома %d: %+v, ожидался %+v", i+1, keys[i], want[i])
+		}
+	}
+
+	app := appPkg.NewApp(sqlite.NewRepository(db, 0), nil)
+	existing, err := app.CreateHouse(ctx, models.House{Address: "Казань, проспект Победы, дом 5", Developer: "dev", YearBuilt: 2000})
+	if !errors.Is(err, appPkg.ErrHouseAlreadyExists) || existing.ID != 3 {
+		t.Fatalf("дом, созданный до миграции, не найден как дубликат: %+v, %v", existing, err)
+	}
+}
+
+// TestAddressKeyCityBackfill проверяет, что ключи домов с городом, заполненные до миграции 12 по одному
+// адресу, пересчитываются с городом и индексом.
+func TestAddressKeyCityBackfill(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "house-service.db")
+
+	m, err := migrator.New("sqlite", dsn, "")
+	if err != nil {
+		t.Fatalf("ошибка подготовки миграций: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Migrate(10); err != nil {
+		t.Fatalf("ошибка применения миграций до версии 10: %v", err)
+	}
+
+	db, err := sqlite.Open(dsn)
+	if err != nil {
+		t.Fatalf("ошибка открытия базы данных: %v", err)
+	}
+	defer db.Close()
+
+	for _, house := range [][]string{{"ул. Ленина, 1", "", "", "улица ленина 1"}, {"Москва, ул. Мира, 2", "Москва", "101000", "москва улица мира 2"}} {
+		if _, err := db.ExecContext(ctx, "INSERT INTO houses (year_built, address, city, postal_code, address_key, developer) VALUES (2000, ?, ?, ?, ?, 'dev')", house[0], house[1], house[2], house[3]); err != nil {
+			t.Fatalf("ошибка создания дома: %v", err)
+		}
+	}
+
+	if err := migrator.Up(ctx, "sqlite", dsn); err != nil {
+		t.Fatalf("ошибка применения миграций: %v", err)
+	}
+
+	var keys []sql.NullString
+	if err := db.SelectContext(ctx, &keys, "SELECT address_key FROM houses ORDER BY id"); err != nil {
+		t.Fatalf("ошибка чтения ключей адреса: %v", err)
+	}
+
+	want := []sql.NullString{{String: "улица ленина 1", Valid: true}, {String: "москва|улица мира 2|101000", Valid: true}}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("неверный ключ адреса дома %d: %+v, ожидался %+v", i+1, keys[i], want[i])
+		}
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"1_init.up.sql", "1_init.down.sql", "12_add_index.up.sql", "12_add_index.down.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	up, down, err := migrator.Create(dir, "add_flats_view")
+	if err != nil {
+		t.Fatalf("ошибка создания миграции: %v", err)
+	}
+
+	if filepath.Base(up) != "13_add_flats_view.up.sql" || filepath.Base(down) != "13_add_flats_view.down.sql" {
+		t.Fatalf("неверные имена файлов миграции: %s, %s", up, down)
+	}
+
+	if _, _, err := migrator.Create(dir, "Add Flats"); err == nil {
+		t.Fatal("ожидалась ошибка для недопустимого имени миграции")
+	}
+}
+
+// testMigrationsUpDownUp применяет все миграции, откатывает их и применяет снова:
+// down-миграции должны полностью убирать то, что создали up-миграции.
+func testMigrationsUpDownUp(t *testing.T, driver, dsn, path string) {
+	m, err := migrator.New(driver, dsn, path)
+	if err != nil {
+		t.Fatalf("ошибка подготовки миграций: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("ошибка применения миграций: %v", err)
+	}
+
+	latest, dirty, err := m.Version()
+	if err != nil || dirty {
+		t.Fatalf("неверная версия после применения миграций: %d, dirty=%v, %v", latest, dirty, err)
+	}
+
+	if err := m.Down(); err != nil {
+		t.Fatalf("ошибка отката миграций: %v", err)
+	}
+
+	if _, _, err := m.Version(); !errors.Is(err, migrate.ErrNilVersion) {
+		t.Fatalf("после отката всех миграций версия должна отсутствовать: %v", err)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("ошибка повторного применения миграций: %v", err)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil || dirty || version != latest {
+		t.Fatalf("неверная версия после повторного применения: %d, dirty=%v, %v", version, dirty, err)
+	}
+}
+
+// throwawayDatabase создает пустую базу на сервере из dsn и возвращает строку подключения к ней.
+// База удаляется после теста. Пользователю из dsn нужно право CREATEDB.
+func throwawayDatabase(t *testing.T, dsn string) string {
+	t.Helper()
+
+	parsed, err := url.Parse(dsn)
+	if err != nil || parsed.Scheme == "" {
+		t.Fatalf("строка подключения должна быть URL вида postgres://...: %q", dsn)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("ошибка подключения к базе данных: %v", err)
+	}
+
+	name := "house_service_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := db.Exec("CREATE DATABASE " + name); err != nil {
+		db.Close()
+		t.Fatalf("ошибка создания временной базы: %v", err)
+	}
+
+	t.Cleanup(func() {
+		defer db.Close()
+		// WITH (FORCE) закрывает соединения, которые мог оставить пул мигратора
+		if _, err := db.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)"); err != nil {
+			t.Errorf("ошибка удаления временной базы %s: %v", name, err)
+		}
+	})
+
+	parsed.Path = "/" + name
+	return parsed.String()
+}
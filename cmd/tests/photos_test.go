@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/router"
+	"github.com/Vykiy/house-service/internal/storage"
+)
+
+// newPhotosServer запускает API с локальным хранилищем фотографий и создает квартиру с ID 1.
+func newPhotosServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	local, err := storage.NewLocal(t.TempDir(), "/photos", "photos-secret")
+	if err != nil {
+		t.Fatalf("ошибка создания хранилища: %v", err)
+	}
+
+	app := appPkg.NewApp(memory.NewRepository(), local)
+	house, err := app.CreateHouse(context.Background(), models.House{Address: "photos", Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+	createFlat(t, app, house.ID, 100)
+
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), local, health, nil, router.CORSConfig{}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// photosForm собирает multipart-запрос с файлами в поле photo.
+func photosForm(t *testing.T, files ...[]byte) (string, *bytes.Buffer) {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, data := range files {
+		part, err := writer.CreateFormFile("photo", "photo.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+	}
+	writer.Close()
+
+	return writer.FormDataContentType(), &body
+}
+
+func uploadPhotos(t *testing.T, url string, userType models.UserType, files ...[]byte) *http.Response {
+	t.Helper()
+
+	contentType, body := photosForm(t, files...)
+	return doRequest(t, http.MethodPost, url, userType, contentType, body)
+}
+
+func TestUploadFlatPhotos(t *testing.T) {
+	server := newPhotosServer(t)
+
+	resp := uploadPhotos(t, server.URL+"/flat/1/photos", models.UserTypeModerator, pngImage(t, 1000, 500))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("ожидался статус 201, получен %d", resp.StatusCode)
+	}
+
+	var photos []models.FlatPhoto
+	if err := json.NewDecoder(resp.Body).Decode(&photos); err != nil {
+		t.Fatalf("ошибка разбора ответа: %v", err)
+	}
+	if len(photos) != 1 || photos[0].Width != 1000 || photos[0].Height != 500 || photos[0].ContentType != "image/png" || photos[0].ThumbnailURL == "" {
+		t.Fatalf("неверные фотографии: %+v", photos)
+	}
+
+	// превью - JPEG, уменьшенный до 320 пикселей по большей стороне
+	thumbnail := doRequest(t, http.MethodGet, server.URL+photos[0].ThumbnailURL, "", "", nil)
+	if thumbnail.StatusCode != http.StatusOK {
+		t.Fatalf("превью недоступно: %d", thumbnail.StatusCode)
+	}
+	config, err := jpeg.DecodeConfig(thumbnail.Body)
+	if err != nil {
+		t.Fatalf("превью не является JPEG: %v", err)
+	}
+	if config.Width != 320 || config.Height != 160 {
+		t.Fatalf("неверный размер превью: %dx%d", config.Width, config.Height)
+	}
+
+	flats := doRequest(t, http.MethodGet, server.URL+"/house/1", models.UserTypeModerator, "", nil)
+	var house []models.Flat
+	if err := json.NewDecoder(flats.Body).Decode(&house); err != nil {
+		t.Fatalf("ошибка разбора квартир: %v", err)
+	}
+	if len(house) != 1 || len(house[0].UploadedPhotos) != 1 || house[0].UploadedPhotos[0].ID != photos[0].ID {
+		t.Fatalf("фотография не появилась в списке квартир: %+v", house)
+	}
+}
+
+func TestUploadFlatPhotosErrors(t *testing.T) {
+	server := newPhotosServer(t)
+	photo := pngImage(t, 10, 10)
+
+	tooMany := make([][]byte, 11)
+	for i := range tooMany {
+		tooMany[i] = photo
+	}
+
+	for _, tc := range []struct {
+		name     string
+		url      string
+		userType models.UserType
+		files    [][]byte
+		status   int
+	}{
+		{"без токена", "/flat/1/photos", "", [][]byte{photo}, http.StatusForbidden},
+		{"не модератор", "/flat/1/photos", models.UserTypeUser, [][]byte{photo}, http.StatusForbidden},
+		{"нет квартиры", "/flat/999/photos", models.UserTypeModerator, [][]byte{photo}, http.StatusNotFound},
+		{"не изображение", "/flat/1/photos", models.UserTypeModerator, [][]byte{[]byte("просто текст")}, http.StatusUnsupportedMediaType},
+		{"поврежденное изображение", "/flat/1/photos", models.UserTypeModerator, [][]byte{photo[:len(photo)/2]}, http.StatusBadRequest},
+		{"без файлов", "/flat/1/photos", models.UserTypeModerator, nil, http.StatusBadRequest},
+		{"слишком много файлов", "/flat/1/photos", models.UserTypeModerator, tooMany, http.StatusBadRequest},
+		{"слишком большой файл", "/flat/1/photos", models.UserTypeModerator, [][]byte{append(photo, make([]byte, 10<<20)...)}, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if resp := uploadPhotos(t, server.URL+tc.url, tc.userType, tc.files...); resp.StatusCode != tc.status {
+				t.Fatalf("ожидался статус %d, получен %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+
+	// запрос больше общего ограничения отклоняется до разбора файлов
+	huge := make([][]byte, 6)
+	for i := range huge {
+		huge[i] = make([]byte, 9<<20)
+	}
+	if resp := uploadPhotos(t, server.URL+"/flat/1/photos", models.UserTypeModerator, huge...); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("слишком большой запрос: ожидался статус 413, получен %d", resp.StatusCode)
+	}
+
+	// после отклоненных загрузок у квартиры нет фотографий
+	flats := doRequest(t, http.MethodGet, server.URL+"/house/1", models.UserTypeModerator, "", nil)
+	var house []models.Flat
+	if err := json.NewDecoder(flats.Body).Decode(&house); err != nil {
+		t.Fatalf("ошибка разбора квартир: %v", err)
+	}
+	if len(house) != 1 || len(house[0].UploadedPhotos) != 0 {
+		t.Fatalf("отклоненная загрузка сохранила фотографии: %+v", house)
+	}
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/google/uuid"
+)
+
+func TestUpdateFlatPrice(t *testing.T) {
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	server := newAPIServer(t, app)
+
+	house, err := app.CreateHouse(context.Background(), models.House{Address: "prices", Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+	createFlat(t, app, house.ID, 100)
+
+	// цену меняет только модератор, как и статус
+	for _, userType := range []models.UserType{"", models.UserTypeUser} {
+		if resp := doRequest(t, http.MethodPost, server.URL+"/flat/1/price", userType, "application/json", strings.NewReader(`{"price":1}`)); resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("%q: ожидался статус 403, получен %d", userType, resp.StatusCode)
+		}
+	}
+
+	resp := doRequest(t, http.MethodPost, server.URL+"/flat/1/price", models.UserTypeModerator, "application/json", strings.NewReader(`{"price":200}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ожидался статус 200, получен %d", resp.StatusCode)
+	}
+
+	resp = doRequest(t, http.MethodGet, server.URL+"/flat/1/prices", models.UserTypeUser, "", nil)
+	var prices []models.FlatPrice
+	if err := json.NewDecoder(resp.Body).Decode(&prices); err != nil {
+		t.Fatalf("ошибка разбора истории цен: %v", err)
+	}
+	if len(prices) != 2 || prices[0].Price != 100 || prices[1].Price != 200 {
+		t.Fatalf("отклоненные запросы изменили историю цен: %+v", prices)
+	}
+
+	if resp := doRequest(t, http.MethodPost, server.URL+"/flat/999/price", models.UserTypeModerator, "application/json", strings.NewReader(`{"price":1}`)); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("нет квартиры: ожидался статус 404, получен %d", resp.StatusCode)
+	}
+}
+
+func TestUpdateFlatPriceOtherModerator(t *testing.T) {
+	ctx := context.Background()
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	server := newAPIServer(t, app)
+
+	house, err := app.CreateHouse(ctx, models.House{Address: "prices moderation", Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+	createFlat(t, app, house.ID, 100)
+
+	var moderators [2]uuid.UUID
+	for i := range moderators {
+		if moderators[i], err = app.CreateUser(ctx, fmt.Sprintf("moderator%d@example.com", i), "password", models.UserTypeModerator); err != nil {
+			t.Fatalf("ошибка создания модератора: %v", err)
+		}
+	}
+
+	setPrice := func(moderator uuid.UUID, price int) int {
+		t.Helper()
+		return doRequestAs(t, http.MethodPost, server.URL+"/flat/1/price", models.UserTypeModerator, moderator, "application/json", strings.NewReader(fmt.Sprintf(`{"price":%d}`, price))).StatusCode
+	}
+
+	if resp := doRequestAs(t, http.MethodPost, server.URL+"/flat/update", models.UserTypeModerator, moderators[0], "application/json", strings.NewReader(`{"flat_id":1,"status":"on_moderation"}`)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("ошибка взятия квартиры на модерацию: %d", resp.StatusCode)
+	}
+
+	// пока квартиру проверяет первый модератор, второй не может менять ее цену
+	if status := setPrice(moderators[1], 50); status != http.StatusForbidden {
+		t.Fatalf("второй модератор: ожидался статус 403, получен %d", status)
+	}
+	if status := setPrice(moderators[0], 90); status != http.StatusOK {
+		t.Fatalf("проверяющий модератор: ожидался статус 200, получен %d", status)
+	}
+
+	prices, err := app.GetFlatPrices(ctx, 1)
+	if err != nil {
+		t.Fatalf("ошибка получения истории цен: %v", err)
+	}
+	if len(prices) != 2 || prices[1].Price != 90 {
+		t.Fatalf("отклоненный запрос изменил историю цен: %+v", prices)
+	}
+
+	// после окончания проверки цену снова может менять любой модератор
+	if resp := doRequestAs(t, http.MethodPost, server.URL+"/flat/update", models.UserTypeModerator, moderators[0], "application/json", strings.NewReader(`{"flat_id":1,"status":"approved"}`)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("ошибка одобрения квартиры: %d", resp.StatusCode)
+	}
+	if status := setPrice(moderators[1], 80); status != http.StatusOK {
+		t.Fatalf("после проверки: ожидался статус 200, получен %d", status)
+	}
+}
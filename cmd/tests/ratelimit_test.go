@@ -0,0 +1,254 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/ratelimit"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/router"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+var (
+	_ ratelimit.Store = (*ratelimit.MemoryStore)(nil)
+	_ ratelimit.Store = (*ratelimit.PostgresStore)(nil)
+)
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	policy := ratelimit.LockoutPolicy{Threshold: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	for failures, expected := range map[int]time.Duration{
+		0: 0, 2: 0, 3: time.Second, 4: 2 * time.Second, 5: 4 * time.Second, 7: 10 * time.Second, 1000: 10 * time.Second,
+	} {
+		if delay := policy.Delay(failures); delay != expected {
+			t.Fatalf("после %d неудач ожидалась блокировка %v, получено %v", failures, expected, delay)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	testRateLimitStore(t, ratelimit.NewMemoryStore())
+}
+
+func TestPostgresRateLimitStore(t *testing.T) {
+	if err := migrator.Up(context.Background(), "postgres", os.Getenv("DB_CONNECTION")); err != nil {
+		t.Fatalf("ошибка применения миграций: %v", err)
+	}
+
+	db, err := sqlx.Connect("postgres", os.Getenv("DB_CONNECTION"))
+	if err != nil {
+		t.Fatalf("ошибка подключения к базе данных: %v", err)
+	}
+	defer db.Close()
+
+	testRateLimitStore(t, ratelimit.NewPostgresStore(db))
+}
+
+func testRateLimitStore(t *testing.T, store ratelimit.Store) {
+	ctx := context.Background()
+
+	t.Run("token bucket", func(t *testing.T) {
+		limiter := ratelimit.NewLimiter(store, "test:", ratelimit.Limit{Rate: 0.01, Burst: 2})
+		key := uuid.NewString()
+
+		for i := 0; i < 2; i++ {
+			if wait, err := limiter.Allow(ctx, key); err != nil || wait != 0 {
+				t.Fatalf("запрос %d в пределах запаса отклонен: %v, %v", i+1, wait, err)
+			}
+		}
+
+		wait, err := limiter.Allow(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait <= 0 || wait > 100*time.Second {
+			t.Fatalf("ожидалось ожидание до 100s, получено %v", wait)
+		}
+
+		if wait, err := limiter.Allow(ctx, uuid.NewString()); err != nil || wait != 0 {
+			t.Fatalf("другой ключ не должен ограничиваться: %v, %v", wait, err)
+		}
+
+		limiter.SetLimit(ratelimit.Limit{})
+		if wait, err := limiter.Allow(ctx, key); err != nil || wait != 0 {
+			t.Fatalf("нулевая частота должна отключать ограничение: %v, %v", wait, err)
+		}
+	})
+
+	t.Run("refill", func(t *testing.T) {
+		limiter := ratelimit.NewLimiter(store, "test:", ratelimit.Limit{Rate: 20, Burst: 1})
+		key := uuid.NewString()
+
+		if wait, _ := limiter.Allow(ctx, key); wait != 0 {
+			t.Fatal("первый запрос отклонен")
+		}
+		if wait, _ := limiter.Allow(ctx, key); wait == 0 {
+			t.Fatal("второй запрос сразу после первого должен быть отклонен")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		if wait, err := limiter.Allow(ctx, key); err != nil || wait != 0 {
+			t.Fatalf("корзина не пополнилась: %v, %v", wait, err)
+		}
+	})
+
+	t.Run("lockout", func(t *testing.T) {
+		lockout := ratelimit.NewLockout(store, ratelimit.LockoutPolicy{Threshold: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour})
+		account := uuid.NewString()
+
+		if wait, err := lockout.Failure(ctx, account); err != nil || wait != 0 {
+			t.Fatalf("первая неудача не должна блокировать: %v, %v", wait, err)
+		}
+		if wait, err := lockout.Failure(ctx, account); err != nil || wait != time.Minute {
+			t.Fatalf("после порога ожидалась блокировка на минуту: %v, %v", wait, err)
+		}
+		if wait, err := lockout.Failure(ctx, account); err != nil || wait != 2*time.Minute {
+			t.Fatalf("следующая неудача должна удвоить блокировку: %v, %v", wait, err)
+		}
+
+		wait, err := lockout.Check(ctx, account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait <= time.Minute || wait > 2*time.Minute {
+			t.Fatalf("ожидалась оставшаяся блокировка около двух минут, получено %v", wait)
+		}
+
+		if err := lockout.Success(ctx, account); err != nil {
+			t.Fatal(err)
+		}
+		if wait, err := lockout.Check(ctx, account); err != nil || wait != 0 {
+			t.Fatalf("после успешного входа блокировка должна сниматься: %v, %v", wait, err)
+		}
+	})
+}
+
+func TestAuthRateLimiting(t *testing.T) {
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	guard := router.NewAuthGuard(ratelimit.NewMemoryStore(), router.AuthLimits{
+		Account: ratelimit.Limit{Rate: 100, Burst: 100},
+		Lockout: ratelimit.LockoutPolicy{Threshold: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour},
+	})
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, guard, router.CORSConfig{}))
+	defer server.Close()
+
+	post := func(path, body string) *http.Response {
+		t.Helper()
+
+		resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	userID, err := app.CreateUser(context.Background(), "lockout@example.com", "password", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := func(password string) *http.Response {
+		return post("/login", fmt.Sprintf(`{"id":%q,"password":%q}`, userID, password))
+	}
+
+	if resp := login("wrong"); resp.StatusCode != http.StatusForbidden || resp.Header.Get("Retry-After") != "" {
+		t.Fatalf("первая неудача: статус %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if resp := login("wrong"); resp.StatusCode != http.StatusForbidden || resp.Header.Get("Retry-After") != "60" {
+		t.Fatalf("неудача на пороге должна сообщать о блокировке: статус %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	resp := login("password")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("во время блокировки ожидался статус 429 даже с верным паролем, получен %d", resp.StatusCode)
+	}
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 60 {
+		t.Fatalf("неверный Retry-After: %q", resp.Header.Get("Retry-After"))
+	}
+
+	// после снятия ограничений на лету вход снова работает
+	guard.SetLimits(router.AuthLimits{})
+	if resp := login("password"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("после отключения блокировки ожидался успешный вход, статус %d", resp.StatusCode)
+	}
+
+	guard.SetLimits(router.AuthLimits{IP: ratelimit.Limit{Rate: 0.01, Burst: 2}})
+	for i := 0; i < 2; i++ {
+		if resp := post("/register", `{"email":"ip@example.com","password":"password","user_type":"user"}`); resp.StatusCode == http.StatusTooManyRequests {
+			t.Fatalf("запрос %d в пределах запаса отклонен", i+1)
+		}
+	}
+
+	resp = post("/register", `{"email":"ip@example.com","password":"password","user_type":"user"}`)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("ожидался статус 429 с Retry-After, получен %d, %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestAuthRateLimitingTrustedProxies(t *testing.T) {
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	limit := ratelimit.Limit{Rate: 0.01, Burst: 1}
+	guard := router.NewAuthGuard(ratelimit.NewMemoryStore(), router.AuthLimits{IP: limit})
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, guard, router.CORSConfig{}))
+	defer server.Close()
+
+	register := func(forwardedFor string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/register", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// соединение не от доверенного прокси: заголовок игнорируется, все запросы считаются с 127.0.0.1
+	guard.SetLimits(router.AuthLimits{IP: limit, TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}})
+	if status := register("203.0.113.1"); status == http.StatusTooManyRequests {
+		t.Fatal("первый запрос отклонен")
+	}
+	if status := register("203.0.113.2"); status != http.StatusTooManyRequests {
+		t.Fatalf("X-Forwarded-For от недоверенного адреса не должен менять ключ ограничения, статус %d", status)
+	}
+
+	// за доверенным прокси ограничение считается по адресу клиента из заголовка
+	guard.SetLimits(router.AuthLimits{IP: limit, TrustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("10.0.0.0/8")}})
+	if status := register("203.0.113.10, 10.0.0.5"); status == http.StatusTooManyRequests {
+		t.Fatal("первый запрос клиента за прокси отклонен")
+	}
+	if status := register("203.0.113.11"); status == http.StatusTooManyRequests {
+		t.Fatal("запрос другого клиента за прокси отклонен")
+	}
+	if status := register("203.0.113.10"); status != http.StatusTooManyRequests {
+		t.Fatalf("повторный запрос клиента за прокси: ожидался статус 429, получен %d", status)
+	}
+
+	// адрес, дописанный клиентом левее, не помогает обойти ограничение: учитывается адрес,
+	// который добавил доверенный прокси
+	if status := register("198.51.100.1, 203.0.113.10"); status != http.StatusTooManyRequests {
+		t.Fatalf("подделанный X-Forwarded-For обошел ограничение, статус %d", status)
+	}
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Vykiy/house-service/internal/config"
+	"github.com/Vykiy/house-service/internal/logging"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/router"
+	"github.com/Vykiy/house-service/internal/sender"
+	"github.com/google/uuid"
+)
+
+func TestJWTSecretRotation(t *testing.T) {
+	issuer := router.NewJWTIssuer("old-secret")
+
+	oldToken, err := issuer.IssueToken(models.UserTypeModerator, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer.SetSecrets("new-secret", "old-secret")
+
+	newToken, err := issuer.IssueToken(models.UserTypeUser, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{oldToken, newToken} {
+		if _, _, err := issuer.ParseToken(token); err != nil {
+			t.Fatalf("токен должен приниматься после смены секрета: %v", err)
+		}
+	}
+
+	if _, _, err := router.NewJWTIssuer("new-secret").ParseToken(newToken); err != nil {
+		t.Fatalf("новый токен должен быть подписан новым секретом: %v", err)
+	}
+
+	issuer.SetSecrets("new-secret")
+	if _, _, err := issuer.ParseToken(oldToken); err == nil {
+		t.Fatal("токен со снятым с ротации секретом не должен приниматься")
+	}
+}
+
+func TestConfigRestartRequired(t *testing.T) {
+	env := map[string]string{"JWT_SECRET": "secret", "DB_CONNECTION": "db", "STORAGE_URL_SECRET": "photos-secret"}
+	initial, _, err := config.Load(nil, envMap(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env["JWT_SECRET"] = "rotated"
+	env["JWT_PREVIOUS_SECRETS"] = "secret, older"
+	env["LOG_LEVEL"] = "debug"
+	env["SENDER_BACKEND"] = "discard"
+	env["SERVER_ADDRESS"] = ":9091"
+	next, _, err := config.Load(nil, envMap(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(next.JWTPreviousSecrets, []string{"secret", "older"}) {
+		t.Fatalf("неверный разбор списка секретов: %q", next.JWTPreviousSecrets)
+	}
+
+	if fields := initial.RestartRequired(next); !slices.Equal(fields, []string{"SERVER_ADDRESS"}) {
+		t.Fatalf("перезапуска должен требовать только SERVER_ADDRESS, получено %v", fields)
+	}
+
+	out, err := next.Redacted().YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "older") {
+		t.Fatalf("прежние секреты попали в вывод конфигурации:\n%s", out)
+	}
+}
+
+// recordingBackend запоминает получателей уведомлений.
+type recordingBackend struct {
+	mu         sync.Mutex
+	recipients []string
+}
+
+func (b *recordingBackend) Send(ctx context.Context, recipient, message string, headers map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recipients = append(b.recipients, recipient)
+	return nil
+}
+
+func TestSenderBackendSwap(t *testing.T) {
+	s := sender.New()
+
+	first, second := &recordingBackend{}, &recordingBackend{}
+
+	s.SetBackend(first)
+	s.SendEmail(context.Background(), "first@example.com", "message")
+
+	s.SetBackend(second)
+	s.SendEmail(context.Background(), "second@example.com", "message")
+
+	if len(first.recipients) != 1 || first.recipients[0] != "first@example.com" {
+		t.Fatalf("неверные уведомления первого отправителя: %v", first.recipients)
+	}
+	if len(second.recipients) != 1 || second.recipients[0] != "second@example.com" {
+		t.Fatalf("неверные уведомления второго отправителя: %v", second.recipients)
+	}
+}
+
+func TestLogLevelReload(t *testing.T) {
+	logs := setupLogging(t)
+	t.Cleanup(func() { logging.SetLevel("info") })
+
+	if err := logging.SetLevel("warn"); err != nil {
+		t.Fatal(err)
+	}
+	slog.Info("скрытая запись")
+
+	if err := logging.SetLevel("loud"); err == nil {
+		t.Fatal("ожидалась ошибка для неизвестного уровня")
+	}
+
+	if err := logging.SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	slog.Debug("видимая запись")
+
+	output := logs.String()
+	if strings.Contains(output, "скрытая запись") || !strings.Contains(output, "видимая запись") {
+		t.Fatalf("уровень логов не изменился на лету:\n%s", output)
+	}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/storage"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+func TestLocalStorage(t *testing.T) {
+	local, err := storage.NewLocal(t.TempDir(), "/photos", "secret")
+	if err != nil {
+		t.Fatalf("ошибка создания хранилища: %v", err)
+	}
+
+	testStorage(t, local)
+
+	if err := local.Put(context.Background(), "../escape.jpg", "image/jpeg", strings.NewReader("x"), 1); err == nil {
+		t.Fatalf("ключ вне каталога хранилища не отклонен")
+	}
+
+	signedURL, err := local.SignedURL(context.Background(), "flats/1/photo.jpg", time.Minute)
+	if err != nil {
+		t.Fatalf("ошибка подписи ссылки: %v", err)
+	}
+
+	if err := local.Put(context.Background(), "flats/1/photo.jpg", "image/jpeg", strings.NewReader("photo"), 5); err != nil {
+		t.Fatalf("ошибка сохранения объекта: %v", err)
+	}
+
+	server := httptest.NewServer(http.StripPrefix("/photos/", local))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + signedURL)
+	if err != nil {
+		t.Fatalf("ошибка запроса по подписанной ссылке: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("неверный статус ответа по подписанной ссылке: %d", resp.StatusCode)
+	}
+
+	tampered, _ := url.Parse(signedURL)
+	query := tampered.Query()
+	query.Set("expires", "9999999999")
+	tampered.RawQuery = query.Encode()
+
+	resp, err = http.Get(server.URL + tampered.String())
+	if err != nil {
+		t.Fatalf("ошибка запроса по измененной ссылке: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("измененная ссылка не отклонена: %d", resp.StatusCode)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	// gofakes3 - локальная замена S3, чтобы не зависеть от внешнего сервиса
+	backend := s3mem.New()
+	if err := backend.CreateBucket("photos"); err != nil {
+		t.Fatalf("ошибка создания бакета: %v", err)
+	}
+
+	server := httptest.NewServer(gofakes3.New(backend).Server())
+	defer server.Close()
+
+	s3, err := storage.NewS3(strings.TrimPrefix(server.URL, "http://"), "us-east-1", "key", "secret", "photos", false)
+	if err != nil {
+		t.Fatalf("ошибка создания хранилища: %v", err)
+	}
+
+	testStorage(t, s3)
+
+	signedURL, err := s3.SignedURL(context.Background(), "flats/1/photo.jpg", time.Minute)
+	if err != nil {
+		t.Fatalf("ошибка подписи ссылки: %v", err)
+	} else if !strings.Contains(signedURL, "X-Amz-Signature=") {
+		t.Fatalf("ссылка не подписана: %s", signedURL)
+	}
+}
+
+// testStorage проверяет общее поведение всех реализаций storage.Storage.
+func testStorage(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	data := []byte("\xff\xd8\xff photo")
+
+	if err := s.Put(ctx, "flats/1/test.jpg", "image/jpeg", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("ошибка сохранения объекта: %v", err)
+	}
+
+	body, contentType, err := s.Get(ctx, "flats/1/test.jpg")
+	if err != nil {
+		t.Fatalf("ошибка чтения объекта: %v", err)
+	}
+
+	got, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatalf("ошибка чтения объекта: %v", err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Fatalf("неверное содержимое объекта")
+	} else if contentType != "image/jpeg" {
+		t.Fatalf("неверный тип объекта: %s", contentType)
+	}
+
+	if err := s.Delete(ctx, "flats/1/test.jpg"); err != nil {
+		t.Fatalf("ошибка удаления объекта: %v", err)
+	}
+
+	if _, _, err := s.Get(ctx, "flats/1/test.jpg"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("удаленный объект все еще доступен: %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/config"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/router"
+	"github.com/Vykiy/house-service/internal/tlsutil"
+	"github.com/google/uuid"
+)
+
+// testCA выпускает сертификаты для тестов TLS.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue выпускает сертификат сервера (для 127.0.0.1) или клиента с заданным Common Name и серийным номером.
+func (ca *testCA) issue(t *testing.T, commonName string, serial int64, client bool) (certPEM, keyPEM []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if client {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		template.IPAddresses = nil
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tlsServer - сервис за TLS с сертификатом сервера из файлов в каталоге dir.
+type tlsServer struct {
+	url                       string
+	dir                       string
+	certFile, keyFile, caFile string
+	reloader                  *tlsutil.Reloader
+}
+
+func newTLSServer(t *testing.T, ca *testCA, clientAuth tlsutil.ClientAuth, principals tlsutil.Principals) *tlsServer {
+	t.Helper()
+
+	s := &tlsServer{dir: t.TempDir()}
+	s.certFile = filepath.Join(s.dir, "server.crt")
+	s.keyFile = filepath.Join(s.dir, "server.key")
+	s.caFile = filepath.Join(s.dir, "ca.crt")
+
+	certPEM, keyPEM := ca.issue(t, "house-service", 100, false)
+	writeFile(t, s.certFile, certPEM)
+	writeFile(t, s.keyFile, keyPEM)
+	writeFile(t, s.caFile, ca.pem)
+
+	reloader, err := tlsutil.NewReloader(s.certFile, s.keyFile, s.caFile, clientAuth)
+	if err != nil {
+		t.Fatalf("ошибка загрузки сертификата: %v", err)
+	}
+	s.reloader = reloader
+
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	handler := router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, nil, router.CORSConfig{})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: principals.Middleware(handler), TLSConfig: reloader.TLSConfig()}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+
+	s.url = "https://" + listener.Addr().String()
+	return s
+}
+
+// tlsClient возвращает HTTP-клиента, доверяющего ca и предъявляющего сертификат клиента, если он задан.
+func tlsClient(t *testing.T, ca *testCA, certPEM, keyPEM []byte) *http.Client {
+	t.Helper()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.pem)
+	config := &tls.Config{RootCAs: pool}
+
+	if certPEM != nil {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}, Timeout: 5 * time.Second}
+}
+
+func createHouseStatus(t *testing.T, client *http.Client, url string) int {
+	t.Helper()
+
+	resp, err := client.Post(url+"/house/create", "application/json", strings.NewReader(`{"address":"tls `+uuid.NewString()+`","year":2000,"developer":"dev"}`))
+	if err != nil {
+		t.Fatalf("ошибка запроса: %v", err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestMutualTLSPrincipal(t *testing.T) {
+	ca := newTestCA(t)
+	server := newTLSServer(t, ca, tlsutil.ClientAuthOptional, tlsutil.Principals{"billing": models.UserTypeModerator})
+
+	certPEM, keyPEM := ca.issue(t, "billing", 200, true)
+	if status := createHouseStatus(t, tlsClient(t, ca, certPEM, keyPEM), server.url); status != http.StatusOK {
+		t.Fatalf("сервис с сертификатом должен создавать дома без токена: статус %d", status)
+	}
+
+	if status := createHouseStatus(t, tlsClient(t, ca, nil, nil), server.url); status != http.StatusForbidden {
+		t.Fatalf("без сертификата и токена ожидался 403, получен %d", status)
+	}
+
+	certPEM, keyPEM = ca.issue(t, "stranger", 201, true)
+	if status := createHouseStatus(t, tlsClient(t, ca, certPEM, keyPEM), server.url); status != http.StatusForbidden {
+		t.Fatalf("сертификат неизвестного сервиса не должен давать прав: статус %d", status)
+	}
+
+	// сертификат с тем же именем, но от чужого CA, отклоняется при рукопожатии
+	certPEM, keyPEM = newTestCA(t).issue(t, "billing", 202, true)
+	if _, err := tlsClient(t, ca, certPEM, keyPEM).Get(server.url + "/healthz"); err == nil {
+		t.Fatal("сертификат чужого CA должен быть отклонен")
+	}
+}
+
+func TestMutualTLSRequired(t *testing.T) {
+	ca := newTestCA(t)
+	server := newTLSServer(t, ca, tlsutil.ClientAuthRequire, nil)
+
+	if _, err := tlsClient(t, ca, nil, nil).Get(server.url + "/healthz"); err == nil {
+		t.Fatal("без клиентского сертификата соединение должно быть отклонено")
+	}
+
+	certPEM, keyPEM := ca.issue(t, "billing", 200, true)
+	resp, err := tlsClient(t, ca, certPEM, keyPEM).Get(server.url + "/healthz")
+	if err != nil {
+		t.Fatalf("ошибка запроса с клиентским сертификатом: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("неверный статус: %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Strict-Transport-Security") == "" {
+		t.Fatal("по HTTPS ожидался заголовок Strict-Transport-Security")
+	}
+}
+
+func TestTLSCertificateReload(t *testing.T) {
+	ca := newTestCA(t)
+	server := newTLSServer(t, ca, tlsutil.ClientAuthNone, nil)
+
+	serial := func() int64 {
+		t.Helper()
+
+		// новое соединение на каждый запрос, чтобы увидеть текущий сертификат
+		client := tlsClient(t, ca, nil, nil)
+		client.Transport.(*http.Transport).DisableKeepAlives = true
+
+		resp, err := client.Get(server.url + "/healthz")
+		if err != nil {
+			t.Fatalf("ошибка запроса: %v", err)
+		}
+		resp.Body.Close()
+
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	if got := serial(); got != 100 {
+		t.Fatalf("ожидался исходный сертификат, серийный номер %d", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.reloader.Watch(ctx, 10*time.Millisecond)
+
+	// битый сертификат не заменяет действующий
+	writeFile(t, server.certFile, []byte("not a certificate"))
+	if err := server.reloader.Reload(); err == nil {
+		t.Fatal("ожидалась ошибка загрузки битого сертификата")
+	}
+	if got := serial(); got != 100 {
+		t.Fatalf("после ошибки должен действовать прежний сертификат, серийный номер %d", got)
+	}
+
+	certPEM, keyPEM := ca.issue(t, "house-service", 101, false)
+	writeFile(t, server.keyFile, keyPEM)
+	writeFile(t, server.certFile, certPEM)
+	// время изменения сдвигается явно: у файловой системы оно может быть грубее интервала проверки
+	future := time.Now().Add(time.Minute)
+	for _, file := range []string{server.certFile, server.keyFile} {
+		if err := os.Chtimes(file, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for serial() != 101 {
+		if time.Now().After(deadline) {
+			t.Fatal("новый сертификат не подхвачен после изменения файлов")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestTLSConfigValidation(t *testing.T) {
+	base := map[string]string{"JWT_SECRET": "secret", "DB_CONNECTION": "db", "STORAGE_URL_SECRET": "photos-secret"}
+	with := func(values map[string]string) map[string]string {
+		env := map[string]string{}
+		for k, v := range base {
+			env[k] = v
+		}
+		for k, v := range values {
+			env[k] = v
+		}
+		return env
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"сертификат без ключа", with(map[string]string{"TLS_CERT_FILE": "server.crt"}), "TLS_KEY_FILE"},
+		{"проверка клиентов без CA", with(map[string]string{"TLS_CERT_FILE": "server.crt", "TLS_KEY_FILE": "server.key", "TLS_CLIENT_AUTH": "require"}), "TLS_CLIENT_CA_FILE"},
+		{"CA без сертификата сервера", with(map[string]string{"TLS_CLIENT_CA_FILE": "ca.crt"}), "TLS_CLIENT_CA_FILE"},
+		{"нулевой интервал проверки сертификата", with(map[string]string{"TLS_CERT_FILE": "server.crt", "TLS_KEY_FILE": "server.key", "TLS_RELOAD_INTERVAL": "0s"}), "TLS_RELOAD_INTERVAL"},
+		{"неизвестный режим", with(map[string]string{"TLS_CLIENT_AUTH": "always"}), "TLS_CLIENT_AUTH"},
+		{"сервисы без проверки клиентов", with(map[string]string{"TLS_CLIENT_PRINCIPALS": "billing=moderator"}), "TLS_CLIENT_PRINCIPALS"},
+		{"неверная роль сервиса", with(map[string]string{"TLS_CERT_FILE": "server.crt", "TLS_KEY_FILE": "server.key", "TLS_CLIENT_AUTH": "optional", "TLS_CLIENT_CA_FILE": "ca.crt", "TLS_CLIENT_PRINCIPALS": "billing=admin"}), "billing=admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := config.Load(nil, envMap(tt.env)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ожидалась ошибка с %s: %v", tt.want, err)
+			}
+		})
+	}
+
+	env := with(map[string]string{"TLS_CERT_FILE": "server.crt", "TLS_KEY_FILE": "server.key", "TLS_CLIENT_AUTH": "optional", "TLS_CLIENT_CA_FILE": "ca.crt", "TLS_CLIENT_PRINCIPALS": "billing=moderator, reports=user"})
+	if _, _, err := config.Load(nil, envMap(env)); err != nil {
+		t.Fatalf("ошибка корректной конфигурации TLS: %v", err)
+	}
+}
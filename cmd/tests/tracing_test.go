@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	appPkg "github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/migrator"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository/memory"
+	"github.com/Vykiy/house-service/internal/repository/sqlite"
+	"github.com/Vykiy/house-service/internal/router"
+	"github.com/Vykiy/house-service/internal/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+var (
+	spansOnce sync.Once
+	spans     = &spanBuffer{}
+)
+
+// spanBuffer собирает спаны, которые stdout-экспортер пишет в формате JSON.
+// Провайдер трассировки глобальный и устанавливается один раз, поэтому буфер общий для тестов.
+type spanBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *spanBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+type exportedSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+	}
+}
+
+// take возвращает экспортированные спаны и очищает буфер.
+func (b *spanBuffer) take(t *testing.T) []exportedSpan {
+	t.Helper()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var result []exportedSpan
+	decoder := json.NewDecoder(&b.buf)
+	for {
+		var span exportedSpan
+		if err := decoder.Decode(&span); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("ошибка разбора спана: %v", err)
+		}
+		result = append(result, span)
+	}
+	b.buf.Reset()
+
+	return result
+}
+
+func setupTracing(t *testing.T) {
+	t.Helper()
+
+	spansOnce.Do(func() {
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(spans))
+		if err != nil {
+			t.Fatalf("ошибка создания экспортера: %v", err)
+		}
+
+		otel.SetTracerProvider(tracing.NewProvider(sdktrace.WithSyncer(exporter)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	spans.take(t)
+}
+
+func TestTracingPropagation(t *testing.T) {
+	setupTracing(t)
+
+	app := appPkg.NewApp(memory.NewRepository(), nil)
+	health := router.NewHealth(pingerFunc(func(context.Context) error { return nil }), app, migrator.Schema{}, nil, false)
+	server := httptest.NewServer(router.NewRouter(app, router.NewJWTIssuer("secret"), nil, health, nil, router.CORSConfig{}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/dummyLogin?user_type=moderator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/house/create", strings.NewReader(`{"address":"tracing `+uuid.NewString()+`","year":2000,"developer":"dev"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", string(token))
+	req.Header.Set("traceparent", "00-"+testTraceID+"-00f067aa0ba902b7-01")
+
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ошибка создания дома: статус %d", resp.StatusCode)
+	}
+
+	found := map[string]bool{}
+	for _, span := range spans.take(t) {
+		if span.SpanContext.TraceID == testTraceID {
+			found[span.Name] = true
+		}
+	}
+
+	for _, name := range []string{"/house/create", "App.CreateHouse"} {
+		if !found[name] {
+			t.Fatalf("нет спана %s в трассе входящего запроса, найдены: %v", name, found)
+		}
+	}
+}
+
+func TestTracingSQL(t *testing.T) {
+	setupTracing(t)
+
+	path := filepath.Join(t.TempDir(), "house-service.db")
+	if err := migrator.Up(context.Background(), "sqlite", path); err != nil {
+		t.Fatalf("ошибка применения миграций: %v", err)
+	}
+
+	db, err := tracing.OpenDB("sqlite", sqlite.DSN(path))
+	if err != nil {
+		t.Fatalf("ошибка открытия базы данных: %v", err)
+	}
+	defer db.Close()
+
+	app := appPkg.NewApp(sqlite.NewRepository(db, 0), nil)
+
+	ctx, span := otel.Tracer("tests").Start(context.Background(), "test")
+	if _, err := app.CreateHouse(ctx, models.House{Address: "tracing " + uuid.NewString(), Developer: "dev", YearBuilt: 2000}); err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+	span.End()
+
+	traceID := span.SpanContext().TraceID().String()
+	for _, exported := range spans.take(t) {
+		if exported.SpanContext.TraceID == traceID && strings.HasPrefix(exported.Name, "sql.") {
+			return
+		}
+	}
+
+	t.Fatal("нет спанов SQL-запросов в трассе")
+}
@@ -0,0 +1,100 @@
+// Package address нормализует адреса домов. По нормализованному адресу ищутся дубликаты
+// при создании дома и заполняется ключ у домов, созданных до его появления.
+package address
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Сокращения, которые приводятся к полной форме, чтобы "ул. Ленина" и "улица Ленина" считались одним адресом.
+var addressAbbreviations = map[string]string{
+	"ул":    "улица",
+	"пр":    "проспект",
+	"пр-т":  "проспект",
+	"просп": "проспект",
+	"пер":   "переулок",
+	"пл":    "площадь",
+	"наб":   "набережная",
+	"б-р":   "бульвар",
+	"бул":   "бульвар",
+	"ш":     "шоссе",
+	"мкр":   "микрорайон",
+	"корп":  "корпус",
+	"к":     "корпус",
+	"стр":   "строение",
+	"st":    "street",
+	"ave":   "avenue",
+	"rd":    "road",
+	"blvd":  "boulevard",
+	"bldg":  "building",
+	"apt":   "apartment",
+	"sq":    "square",
+	"ln":    "lane",
+	"hwy":   "highway",
+	"pkwy":  "parkway",
+	"str":   "street",
+}
+
+// Служебные слова, которые не влияют на идентичность адреса.
+var addressNoiseWords = map[string]struct{}{
+	"г":     {},
+	"город": {},
+	"д":     {},
+	"дом":   {},
+}
+
+// Normalize приводит адрес к каноническому виду: нижний регистр, без пунктуации и служебных слов,
+// с раскрытыми сокращениями. Два адреса одного дома должны давать одинаковый результат.
+func Normalize(address string) string {
+	address = strings.ToLower(address)
+	address = strings.ReplaceAll(address, "ё", "е")
+
+	fields := strings.FieldsFunc(address, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '/'
+	})
+
+	tokens := make([]string, 0, len(fields))
+	for _, field := range fields {
+		field = strings.Trim(field, "-/")
+		if field == "" {
+			continue
+		}
+
+		if _, ok := addressNoiseWords[field]; ok {
+			continue
+		}
+
+		if full, ok := addressAbbreviations[field]; ok {
+			field = full
+		}
+
+		tokens = append(tokens, field)
+	}
+
+	return strings.Join(tokens, " ")
+}
+
+// Key возвращает ключ дома для поиска дубликатов: нормализованный адрес, город и индекс, разделенные "|".
+// Одинаковые улица и дом в разных городах или с разными индексами дают разные ключи. Город в начале
+// адреса не повторяется, поэтому "Москва, ул. Ленина, 1" и "ул. Ленина, 1" с городом Москва - один ключ.
+// Без города и индекса ключ совпадает с Normalize(address). Пустой адрес ключа не дает.
+func Key(address, city, postalCode string) string {
+	key := Normalize(address)
+	if key == "" {
+		return ""
+	}
+
+	if city := Normalize(city); city != "" {
+		if rest := strings.TrimPrefix(key, city+" "); rest != key {
+			key = rest
+		}
+		key = city + "|" + key
+	}
+
+	if postalCode := Normalize(postalCode); postalCode != "" {
+		key += "|" + postalCode
+	}
+
+	return key
+}
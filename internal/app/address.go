@@ -0,0 +1,39 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/Vykiy/house-service/internal/address"
+	"github.com/Vykiy/house-service/internal/models"
+)
+
+// FormatAddress собирает адрес в одну строку из структурированных полей.
+func FormatAddress(city, street, building string) string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{city, street, building} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// normalizeHouse заполняет строковый адрес и ключ для поиска дубликатов.
+func normalizeHouse(house models.House) models.House {
+	house.City = strings.TrimSpace(house.City)
+	house.Street = strings.TrimSpace(house.Street)
+	house.Building = strings.TrimSpace(house.Building)
+	house.PostalCode = strings.TrimSpace(house.PostalCode)
+	house.Address = strings.TrimSpace(house.Address)
+
+	if house.Address == "" {
+		house.Address = FormatAddress(house.City, house.Street, house.Building)
+	}
+
+	if key := address.Key(house.Address, house.City, house.PostalCode); key != "" {
+		house.AddressKey = &key
+	}
+
+	return house
+}
@@ -2,44 +2,72 @@ package app
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 
 	"github.com/Vykiy/house-service/internal/models"
 	"github.com/Vykiy/house-service/internal/repository"
 	"github.com/Vykiy/house-service/internal/sender"
+	"github.com/Vykiy/house-service/internal/storage"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var tracer = otel.Tracer("github.com/Vykiy/house-service/internal/app")
+
+var ErrHouseAlreadyExists = errors.New("дом с таким адресом уже существует")
+
 type App struct {
-	repository *repository.Repository
+	repository Repository
 	sender     *sender.Sender
+	storage    storage.Storage
+	flatsCache *flatsCache
+}
+
+// NewApp создает приложение. storage может быть nil, тогда загрузка фотографий недоступна.
+func NewApp(repository Repository, storage storage.Storage) *App {
+	return &App{repository: repository, sender: sender.New(), storage: storage}
+}
+
+// SetSenderBackend меняет способ отправки уведомлений подписчикам без остановки сервиса.
+func (a *App) SetSenderBackend(backend sender.Backend) {
+	a.sender.SetBackend(backend)
 }
 
-func NewApp(repository *repository.Repository) *App {
-	return &App{repository: repository}
+// SenderBacklog возвращает число уведомлений подписчикам, которые еще отправляются.
+func (a *App) SenderBacklog() int64 {
+	return a.sender.Backlog()
 }
 
-func (a *App) CreateUser(email, password string, userType models.UserType) (uuid.UUID, error) {
+func (a *App) CreateUser(ctx context.Context, email, password string, userType models.UserType) (uuid.UUID, error) {
+	ctx, span := tracer.Start(ctx, "App.CreateUser")
+	defer span.End()
+
 	passwordHash, err := hashAndSalt([]byte(password))
 	if err != nil {
-		log.Println(fmt.Errorf("хеширование пароля: %v", err))
+		slog.ErrorContext(ctx, "хеширование пароля", "error", err)
 		return uuid.Nil, err
 	}
-	userID, err := a.repository.CreateUser(email, passwordHash, userType)
+	userID, err := a.repository.CreateUser(ctx, email, passwordHash, userType)
 	if err != nil {
-		log.Println(fmt.Errorf("создание пользователя: %v", err))
+		slog.ErrorContext(ctx, "создание пользователя", "error", err)
 		return uuid.Nil, err
 	}
 
 	return userID, nil
 }
 
-func (a *App) CheckUserPassword(userID uuid.UUID, password string) (bool, models.UserType, error) {
-	user, err := a.repository.GetUser(userID)
+func (a *App) CheckUserPassword(ctx context.Context, userID uuid.UUID, password string) (bool, models.UserType, error) {
+	ctx, span := tracer.Start(ctx, "App.CheckUserPassword")
+	defer span.End()
+
+	user, err := a.repository.GetUser(ctx, userID)
 	if err != nil {
-		log.Println(fmt.Errorf("получение пользователя: %v", err))
+		slog.ErrorContext(ctx, "получение пользователя", "error", err)
 		return false, user.UserType, err
 	}
 
@@ -50,59 +78,239 @@ func (a *App) CheckUserPassword(userID uuid.UUID, password string) (bool, models
 	return true, user.UserType, nil
 }
 
-func (a *App) CreateHouse(address, developer string, yearBuilt int) (models.House, error) {
-	house, err := a.repository.CreateHouse(address, developer, yearBuilt)
-	if err != nil {
-		log.Println(fmt.Errorf("создание дома: %v", err))
+// CreateHouse создает дом. Если дом с тем же нормализованным адресом уже есть,
+// возвращает существующую запись вместе с ErrHouseAlreadyExists.
+func (a *App) CreateHouse(ctx context.Context, house models.House) (models.House, error) {
+	ctx, span := tracer.Start(ctx, "App.CreateHouse")
+	defer span.End()
+
+	house = normalizeHouse(house)
+
+	if house.AddressKey != nil {
+		existing, err := a.repository.GetHouseByAddressKey(ctx, *house.AddressKey)
+		if err == nil {
+			return existing, ErrHouseAlreadyExists
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "поиск дома по адресу", "error", err)
+			return models.House{}, err
+		}
+	}
+
+	created, err := a.repository.CreateHouse(ctx, house)
+	if errors.Is(err, repository.ErrAlreadyExists) && house.AddressKey != nil {
+		// дом успели создать параллельным запросом
+		existing, err := a.repository.GetHouseByAddressKey(ctx, *house.AddressKey)
+		if err != nil {
+			slog.ErrorContext(ctx, "поиск дома по адресу", "error", err)
+			return models.House{}, err
+		}
+		return existing, ErrHouseAlreadyExists
+	} else if err != nil {
+		slog.ErrorContext(ctx, "создание дома", "error", err)
 		return models.House{}, err
 	}
 
-	return house, nil
+	return created, nil
 }
 
-func (a *App) GetFlats(houseID int) ([]models.Flat, error) {
-	flats, err := a.repository.GetFlats(houseID)
+// GetHousesNearby возвращает дома в радиусе radius метров от точки, ближайшие первыми.
+func (a *App) GetHousesNearby(ctx context.Context, lat, lon, radius float64, limit int) ([]models.NearbyHouse, error) {
+	ctx, span := tracer.Start(ctx, "App.GetHousesNearby")
+	defer span.End()
+
+	houses, err := a.repository.GetHousesNearby(ctx, lat, lon, radius, limit)
 	if err != nil {
-		log.Println(fmt.Errorf("получение квартир: %v", err))
+		slog.ErrorContext(ctx, "поиск домов в радиусе", "error", err)
 		return nil, err
 	}
 
-	return flats, nil
+	return houses, nil
 }
 
-func (a *App) CreateFlat(houseID int, price, rooms int) (models.Flat, error) {
-	flat, err := a.repository.CreateFlat(houseID, price, rooms)
+// GetHousesInBox возвращает дома внутри прямоугольника, отсортированные по расстоянию до точки (lat, lon).
+func (a *App) GetHousesInBox(ctx context.Context, minLat, minLon, maxLat, maxLon, lat, lon float64, limit int) ([]models.NearbyHouse, error) {
+	ctx, span := tracer.Start(ctx, "App.GetHousesInBox")
+	defer span.End()
+
+	houses, err := a.repository.GetHousesInBox(ctx, minLat, minLon, maxLat, maxLon, lat, lon, limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "поиск домов в прямоугольнике", "error", err)
+		return nil, err
+	}
+
+	return houses, nil
+}
+
+func (a *App) GetFlats(ctx context.Context, houseID int, filter models.FlatFilter) ([]models.Flat, error) {
+	ctx, span := tracer.Start(ctx, "App.GetFlats")
+	defer span.End()
+
+	if a.flatsCache != nil {
+		if cached, ok := a.cachedFlats(ctx, houseID); ok {
+			var flats []models.Flat
+			for _, flat := range cached.Flats {
+				if filter.Match(flat) {
+					flats = append(flats, flat)
+				}
+			}
+
+			return a.withPhotos(ctx, flats, cached.Photos), nil
+		}
+	}
+
+	flats, err := a.repository.GetFlats(ctx, houseID, filter)
 	if err != nil {
-		log.Println(fmt.Errorf("создание квартиры: %v", err))
+		slog.ErrorContext(ctx, "получение квартир", "error", err)
+		return nil, err
+	}
+
+	for i := range flats {
+		flats[i] = withPricePerSquareMeter(flats[i])
+	}
+
+	return a.attachPhotos(ctx, houseID, flats), nil
+}
+
+// ExportFlats построчно передает квартиры в fn для выгрузки.
+func (a *App) ExportFlats(ctx context.Context, houseID *int, filter models.FlatFilter, fn func(models.Flat) error) error {
+	ctx, span := tracer.Start(ctx, "App.ExportFlats")
+	defer span.End()
+
+	if err := a.repository.StreamFlats(ctx, houseID, filter, func(flat models.Flat) error {
+		return fn(withPricePerSquareMeter(flat))
+	}); err != nil {
+		slog.ErrorContext(ctx, "выгрузка квартир", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// ExportHouses построчно передает дома в fn для выгрузки.
+func (a *App) ExportHouses(ctx context.Context, box *[4]float64, fn func(models.House) error) error {
+	ctx, span := tracer.Start(ctx, "App.ExportHouses")
+	defer span.End()
+
+	if err := a.repository.StreamHouses(ctx, box, fn); err != nil {
+		slog.ErrorContext(ctx, "выгрузка домов", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (a *App) CreateFlat(ctx context.Context, flat models.Flat) (models.Flat, error) {
+	ctx, span := tracer.Start(ctx, "App.CreateFlat")
+	defer span.End()
+
+	flat, err := a.repository.CreateFlat(ctx, flat)
+	if err != nil {
+		slog.ErrorContext(ctx, "создание квартиры", "error", err)
 		return models.Flat{}, err
 	}
+	a.invalidateFlats(ctx, flat.HouseID)
+
+	subscribers, err := a.repository.GetSubscribers(ctx, flat.HouseID)
+	if err != nil {
+		slog.ErrorContext(ctx, "получение подписчиков", "error", err) // не хотим прерывать выполнение функции из-за ошибки
+	}
+
+	for _, subscriber := range subscribers {
+		go a.sender.SendEmail(context.WithoutCancel(ctx), subscriber, fmt.Sprintf("В доме №%d появилась новая квартира!", flat.HouseID))
+	}
+
+	return withPricePerSquareMeter(flat), nil
+}
+
+// ImportFlats атомарно создает несколько квартир в доме и один раз уведомляет подписчиков.
+func (a *App) ImportFlats(ctx context.Context, houseID int, flats []models.Flat) ([]models.Flat, error) {
+	ctx, span := tracer.Start(ctx, "App.ImportFlats")
+	defer span.End()
+
+	created, err := a.repository.CreateFlats(ctx, houseID, flats)
+	if err != nil {
+		slog.ErrorContext(ctx, "импорт квартир", "error", err)
+		return nil, err
+	}
+	a.invalidateFlats(ctx, houseID)
 
-	subscribers, err := a.repository.GetSubscribers(houseID)
+	subscribers, err := a.repository.GetSubscribers(ctx, houseID)
 	if err != nil {
-		log.Println(fmt.Errorf("получение подписчиков: %v", err)) // не хотим прерывать выполнение функции из-за ошибки
+		slog.ErrorContext(ctx, "получение подписчиков", "error", err) // не хотим прерывать выполнение функции из-за ошибки
 	}
 
 	for _, subscriber := range subscribers {
-		go a.sender.SendEmail(context.Background(), subscriber, fmt.Sprintf("В доме №%d появилась новая квартира!", houseID))
+		go a.sender.SendEmail(context.WithoutCancel(ctx), subscriber, fmt.Sprintf("В доме №%d появилось новых квартир: %d!", houseID, len(created)))
 	}
 
-	return flat, nil
+	for i := range created {
+		created[i] = withPricePerSquareMeter(created[i])
+	}
+
+	return created, nil
 }
 
-func (a *App) UpdateFlat(flatID int, status models.FlatStatus) (models.Flat, error) {
-	flat, err := a.repository.UpdateFlat(flatID, status)
+// UpdateFlat меняет статус квартиры. Статус on_moderation закрепляет квартиру за moderatorID до конца проверки.
+func (a *App) UpdateFlat(ctx context.Context, flatID int, status models.FlatStatus, moderatorID uuid.UUID) (models.Flat, error) {
+	ctx, span := tracer.Start(ctx, "App.UpdateFlat")
+	defer span.End()
+
+	flat, err := a.repository.UpdateFlat(ctx, flatID, status, moderatorID)
 	if err != nil {
-		log.Println(fmt.Errorf("обновление квартиры: %v", err))
+		slog.ErrorContext(ctx, "обновление квартиры", "error", err)
 		return models.Flat{}, err
 	}
+	a.invalidateFlats(ctx, flat.HouseID)
 
-	return flat, nil
+	return withPricePerSquareMeter(flat), nil
 }
 
-func (a *App) CheckFlatModerator(flatID int, userID uuid.UUID) (bool, error) {
-	moderatorID, err := a.repository.GetFlatModerator(flatID)
+// UpdateFlatPrice меняет цену квартиры. О снижении цены одобренной квартиры уведомляются подписчики дома.
+func (a *App) UpdateFlatPrice(ctx context.Context, flatID int, price int) (models.Flat, error) {
+	ctx, span := tracer.Start(ctx, "App.UpdateFlatPrice")
+	defer span.End()
+
+	flat, oldPrice, err := a.repository.UpdateFlatPrice(ctx, flatID, price)
 	if err != nil {
-		log.Println(fmt.Errorf("получение модератора квартиры: %v", err))
+		slog.ErrorContext(ctx, "обновление цены квартиры", "error", err)
+		return models.Flat{}, err
+	}
+	a.invalidateFlats(ctx, flat.HouseID)
+
+	if flat.Status == models.FlatStatusApproved && price < oldPrice {
+		subscribers, err := a.repository.GetSubscribers(ctx, flat.HouseID)
+		if err != nil {
+			slog.ErrorContext(ctx, "получение подписчиков", "error", err) // не хотим прерывать выполнение функции из-за ошибки
+		}
+
+		for _, subscriber := range subscribers {
+			go a.sender.SendEmail(context.WithoutCancel(ctx), subscriber, fmt.Sprintf("В доме №%d квартира №%d подешевела с %d до %d!", flat.HouseID, flat.ID, oldPrice, price))
+		}
+	}
+
+	return withPricePerSquareMeter(flat), nil
+}
+
+func (a *App) GetFlatPrices(ctx context.Context, flatID int) ([]models.FlatPrice, error) {
+	ctx, span := tracer.Start(ctx, "App.GetFlatPrices")
+	defer span.End()
+
+	prices, err := a.repository.GetFlatPrices(ctx, flatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "получение истории цен", "error", err)
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+func (a *App) CheckFlatModerator(ctx context.Context, flatID int, userID uuid.UUID) (bool, error) {
+	ctx, span := tracer.Start(ctx, "App.CheckFlatModerator")
+	defer span.End()
+
+	moderatorID, err := a.repository.GetFlatModerator(ctx, flatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "получение модератора квартиры", "error", err)
 		return false, err
 	}
 
@@ -113,9 +321,12 @@ func (a *App) CheckFlatModerator(flatID int, userID uuid.UUID) (bool, error) {
 	return userID == moderatorID, nil
 }
 
-func (a *App) SubscribeToNewFlats(houseID int, email string) error {
-	if err := a.repository.SubscribeToNewFlats(houseID, email); err != nil {
-		log.Println(fmt.Errorf("подписка на новые квартиры: %v", err))
+func (a *App) SubscribeToNewFlats(ctx context.Context, houseID int, email string) error {
+	ctx, span := tracer.Start(ctx, "App.SubscribeToNewFlats")
+	defer span.End()
+
+	if err := a.repository.SubscribeToNewFlats(ctx, houseID, email); err != nil {
+		slog.ErrorContext(ctx, "подписка на новые квартиры", "error", err)
 		return err
 	}
 
@@ -134,3 +345,12 @@ func comparePasswords(hashedPwd, plainPwd []byte) bool {
 	err := bcrypt.CompareHashAndPassword(hashedPwd, plainPwd)
 	return err == nil
 }
+
+// withPricePerSquareMeter рассчитывает цену квадратного метра, если известна площадь.
+func withPricePerSquareMeter(flat models.Flat) models.Flat {
+	if flat.Area > 0 {
+		flat.PricePerSquareMeter = math.Round(float64(flat.Price)/flat.Area*100) / 100
+	}
+
+	return flat
+}
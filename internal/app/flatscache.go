@@ -0,0 +1,202 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/cache"
+	"github.com/Vykiy/house-service/internal/metrics"
+	"github.com/Vykiy/house-service/internal/models"
+	"golang.org/x/sync/singleflight"
+)
+
+// flatsCacheName - метка кеша списков квартир в метриках
+const flatsCacheName = "flats"
+
+// flatsCache кеширует полный список квартир дома вместе с фотографиями. Фильтр, включая видимость
+// по роли (FlatFilter.Status), применяется к списку при каждом чтении, поэтому роль в ключ не входит:
+// на дом приходится одна запись и сбросить ее можно одним удалением.
+type flatsCache struct {
+	cache cache.Cache
+	ttl   time.Duration
+	group singleflight.Group
+
+	mu    sync.Mutex
+	loads map[int]*flatsLoad // по ID дома, только пока идут загрузки его квартир
+}
+
+// flatsLoad - загрузки квартир одного дома. Поколение растет при каждом сбросе и сравнивается только
+// в пределах загрузки, поэтому, когда загрузок не остается, запись удаляется и поколение начинается с нуля.
+type flatsLoad struct {
+	generation uint64
+	running    int
+}
+
+// houseFlats - запись кеша. UpdatedAt - время изменения дома, для которого собран список: если в базе
+// оно другое, квартиры или их фотографии изменили через другую реплику и запись устарела.
+type houseFlats struct {
+	UpdatedAt string
+	Flats     []models.Flat
+	Photos    []models.FlatPhoto
+}
+
+// SetFlatsCache включает кеширование списков квартир в c. Запись сверяется со временем изменения дома,
+// которое обновляет любое изменение его квартир, поэтому изменения других реплик видны сразу; ttl лишь
+// ограничивает, сколько запись занимает место в кеше. nil выключает кеш. Вызывается до начала обработки запросов.
+func (a *App) SetFlatsCache(c cache.Cache, ttl time.Duration) {
+	if c == nil {
+		a.flatsCache = nil
+		return
+	}
+
+	a.flatsCache = &flatsCache{cache: c, ttl: ttl, loads: make(map[int]*flatsLoad)}
+}
+
+func flatsCacheKey(houseID int) string {
+	return "flats:" + strconv.Itoa(houseID)
+}
+
+// cachedFlats возвращает квартиры дома из кеша, а при промахе загружает их из хранилища и кладет в кеш.
+// Одновременные промахи по одному дому ждут одну загрузку. ok == false, если кеш использовать не удалось
+// и квартиры нужно взять из хранилища напрямую.
+func (a *App) cachedFlats(ctx context.Context, houseID int) (houseFlats, bool) {
+	c := a.flatsCache
+
+	// дешевый запрос по первичному ключу вместо выборки квартир
+	updatedAt, err := a.repository.GetHouseUpdatedAt(ctx, houseID)
+	if err != nil {
+		return houseFlats{}, false
+	}
+
+	key := flatsCacheKey(houseID)
+	data, found, err := c.cache.Get(ctx, key)
+	if err != nil {
+		metrics.ObserveCache(flatsCacheName, "error")
+		slog.WarnContext(ctx, "ошибка чтения кеша квартир", "house_id", houseID, "error", err)
+	} else if found {
+		if entry, err := decodeHouseFlats(data); err == nil && entry.UpdatedAt == updatedAt {
+			metrics.ObserveCache(flatsCacheName, "hit")
+			return entry, true
+		}
+		metrics.ObserveCache(flatsCacheName, "stale")
+	} else {
+		metrics.ObserveCache(flatsCacheName, "miss")
+	}
+
+	// загрузка, начатая до сброса, не должна ни вернуть старый список новым читателям, ни попасть в кеш
+	generation := c.startLoad(houseID)
+	defer c.finishLoad(houseID)
+
+	loaded, err, _ := c.group.Do(key+":"+strconv.FormatUint(generation, 10), func() (interface{}, error) {
+		// загрузку ждут и другие запросы, отмена первого не должна ее прерывать
+		return a.loadHouseFlats(context.WithoutCancel(ctx), houseID, updatedAt, generation)
+	})
+	if err != nil {
+		return houseFlats{}, false
+	}
+
+	entry, err := decodeHouseFlats(loaded.([]byte))
+	if err != nil {
+		return houseFlats{}, false
+	}
+
+	return entry, true
+}
+
+func (a *App) loadHouseFlats(ctx context.Context, houseID int, updatedAt string, generation uint64) ([]byte, error) {
+	c := a.flatsCache
+
+	flats, err := a.repository.GetFlats(ctx, houseID, models.FlatFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range flats {
+		flats[i] = withPricePerSquareMeter(flats[i])
+	}
+
+	entry := houseFlats{UpdatedAt: updatedAt, Flats: flats}
+	if a.storage != nil && len(flats) > 0 {
+		if entry.Photos, err = a.repository.GetHousePhotos(ctx, houseID); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return nil, err
+	}
+
+	if c.currentGeneration(houseID) == generation {
+		key := flatsCacheKey(houseID)
+		if err := c.cache.Set(ctx, key, buf.Bytes(), c.ttl); err != nil {
+			slog.WarnContext(ctx, "ошибка записи в кеш квартир", "house_id", houseID, "error", err)
+		} else if c.currentGeneration(houseID) != generation {
+			// сброс успел пройти между проверкой и записью
+			c.cache.Delete(ctx, key)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// invalidateFlats сбрасывает кеш квартир дома после изменения его квартир или фотографий.
+func (a *App) invalidateFlats(ctx context.Context, houseID int) {
+	c := a.flatsCache
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if load := c.loads[houseID]; load != nil {
+		load.generation++
+	}
+	c.mu.Unlock()
+
+	if err := c.cache.Delete(ctx, flatsCacheKey(houseID)); err != nil {
+		slog.WarnContext(ctx, "ошибка сброса кеша квартир", "house_id", houseID, "error", err)
+	}
+}
+
+// startLoad учитывает загрузку квартир дома и возвращает текущее поколение. Парный вызов - finishLoad.
+func (c *flatsCache) startLoad(houseID int) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	load := c.loads[houseID]
+	if load == nil {
+		load = &flatsLoad{}
+		c.loads[houseID] = load
+	}
+	load.running++
+
+	return load.generation
+}
+
+func (c *flatsCache) finishLoad(houseID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	load := c.loads[houseID]
+	if load.running--; load.running == 0 {
+		delete(c.loads, houseID)
+	}
+}
+
+// currentGeneration вызывается между startLoad и finishLoad.
+func (c *flatsCache) currentGeneration(houseID int) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.loads[houseID].generation
+}
+
+func decodeHouseFlats(data []byte) (houseFlats, error) {
+	var entry houseFlats
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry)
+	return entry, err
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log/slog"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/google/uuid"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	thumbnailSize  = 320 // максимальная сторона превью в пикселях
+	photoURLTTL    = time.Hour
+	maxPhotoPixels = 50_000_000 // защита от "бомб" с огромным разрешением
+)
+
+var (
+	ErrStorageDisabled = errors.New("хранилище фотографий не настроено")
+	ErrInvalidImage    = errors.New("не удалось прочитать изображение")
+)
+
+var photoExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// IsSupportedPhotoType сообщает, можно ли загрузить фотографию с таким типом содержимого.
+func IsSupportedPhotoType(contentType string) bool {
+	_, ok := photoExtensions[contentType]
+	return ok
+}
+
+// AddFlatPhoto сохраняет фотографию квартиры и ее превью в хранилище.
+func (a *App) AddFlatPhoto(ctx context.Context, flatID int, data []byte, contentType string) (models.FlatPhoto, error) {
+	ctx, span := tracer.Start(ctx, "App.AddFlatPhoto")
+	defer span.End()
+
+	if a.storage == nil {
+		return models.FlatPhoto{}, ErrStorageDisabled
+	}
+
+	flat, err := a.repository.GetFlat(ctx, flatID)
+	if err != nil {
+		slog.ErrorContext(ctx, "получение квартиры", "error", err)
+		return models.FlatPhoto{}, err
+	}
+
+	thumbnail, width, height, err := makeThumbnail(data)
+	if err != nil {
+		return models.FlatPhoto{}, err
+	}
+
+	name := uuid.NewString()
+	photo := models.FlatPhoto{
+		FlatID:       flatID,
+		FlatNumber:   flat.ID,
+		Key:          fmt.Sprintf("flats/%d/%s.%s", flatID, name, photoExtensions[contentType]),
+		ThumbnailKey: fmt.Sprintf("flats/%d/%s_thumb.jpg", flatID, name),
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		Width:        width,
+		Height:       height,
+	}
+
+	if err := a.storage.Put(ctx, photo.Key, contentType, bytes.NewReader(data), int64(len(data))); err != nil {
+		slog.ErrorContext(ctx, "сохранение фотографии", "error", err)
+		return models.FlatPhoto{}, err
+	}
+
+	if err := a.storage.Put(ctx, photo.ThumbnailKey, "image/jpeg", bytes.NewReader(thumbnail), int64(len(thumbnail))); err != nil {
+		slog.ErrorContext(ctx, "сохранение превью", "error", err)
+		a.deletePhotoObjects(ctx, photo)
+		return models.FlatPhoto{}, err
+	}
+
+	created, err := a.repository.CreateFlatPhoto(ctx, photo)
+	if err != nil {
+		slog.ErrorContext(ctx, "сохранение метаданных фотографии", "error", err)
+		a.deletePhotoObjects(ctx, photo)
+		return models.FlatPhoto{}, err
+	}
+	a.invalidateFlats(ctx, flat.HouseID)
+
+	return a.signPhoto(ctx, created), nil
+}
+
+// attachPhotos добавляет к квартирам дома загруженные фотографии с подписанными ссылками.
+func (a *App) attachPhotos(ctx context.Context, houseID int, flats []models.Flat) []models.Flat {
+	if a.storage == nil || len(flats) == 0 {
+		return flats
+	}
+
+	photos, err := a.repository.GetHousePhotos(ctx, houseID)
+	if err != nil {
+		slog.ErrorContext(ctx, "получение фотографий", "error", err) // список квартир важнее фотографий
+		return flats
+	}
+
+	return a.withPhotos(ctx, flats, photos)
+}
+
+// withPhotos раскладывает фотографии дома по квартирам и подписывает ссылки.
+func (a *App) withPhotos(ctx context.Context, flats []models.Flat, photos []models.FlatPhoto) []models.Flat {
+	if a.storage == nil || len(photos) == 0 {
+		return flats
+	}
+
+	byFlat := make(map[int][]models.FlatPhoto)
+	for _, photo := range photos {
+		byFlat[photo.FlatNumber] = append(byFlat[photo.FlatNumber], a.signPhoto(ctx, photo))
+	}
+
+	for i := range flats {
+		flats[i].UploadedPhotos = byFlat[flats[i].ID]
+	}
+
+	return flats
+}
+
+func (a *App) signPhoto(ctx context.Context, photo models.FlatPhoto) models.FlatPhoto {
+	var err error
+	if photo.URL, err = a.storage.SignedURL(ctx, photo.Key, photoURLTTL); err != nil {
+		slog.ErrorContext(ctx, "подпись ссылки на фотографию", "error", err)
+	}
+
+	if photo.ThumbnailURL, err = a.storage.SignedURL(ctx, photo.ThumbnailKey, photoURLTTL); err != nil {
+		slog.ErrorContext(ctx, "подпись ссылки на превью", "error", err)
+	}
+
+	return photo
+}
+
+// deletePhotoObjects удаляет объекты фотографии даже после отмены запроса, чтобы не оставлять мусор в хранилище.
+func (a *App) deletePhotoObjects(ctx context.Context, photo models.FlatPhoto) {
+	ctx = context.WithoutCancel(ctx)
+
+	for _, key := range []string{photo.Key, photo.ThumbnailKey} {
+		if err := a.storage.Delete(ctx, key); err != nil {
+			slog.ErrorContext(ctx, "удаление объекта", "key", key, "error", err)
+		}
+	}
+}
+
+// makeThumbnail уменьшает изображение так, чтобы большая сторона не превышала thumbnailSize.
+func makeThumbnail(data []byte) ([]byte, int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxPhotoPixels {
+		return nil, 0, 0, ErrInvalidImage
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, ErrInvalidImage
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	thumbWidth, thumbHeight := width, height
+	if width > thumbnailSize || height > thumbnailSize {
+		if width >= height {
+			thumbWidth, thumbHeight = thumbnailSize, max(1, height*thumbnailSize/width)
+		} else {
+			thumbWidth, thumbHeight = max(1, width*thumbnailSize/height), thumbnailSize
+		}
+	}
+
+	// JPEG не поддерживает прозрачность, поэтому подкладываем белый фон
+	dst := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return buf.Bytes(), width, height, nil
+}
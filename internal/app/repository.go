@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// Ниже описаны хранилища, от которых зависит App. Реализации должны вести себя одинаково:
+// отсутствующие записи - sql.ErrNoRows, нарушение уникальности - repository.ErrAlreadyExists,
+// номера квартир - последовательные в пределах дома. Поведение проверяется общим набором тестов repotest.
+
+type UserRepository interface {
+	CreateUser(ctx context.Context, email, passwordHash string, userType models.UserType) (uuid.UUID, error)
+	GetUser(ctx context.Context, userID uuid.UUID) (models.User, error)
+}
+
+type HouseRepository interface {
+	CreateHouse(ctx context.Context, house models.House) (models.House, error)
+	GetHouseByAddressKey(ctx context.Context, addressKey string) (models.House, error)
+	// GetHouseUpdatedAt возвращает время последнего изменения списка квартир дома
+	GetHouseUpdatedAt(ctx context.Context, houseID int) (string, error)
+	GetHousesNearby(ctx context.Context, lat, lon, radius float64, limit int) ([]models.NearbyHouse, error)
+	GetHousesInBox(ctx context.Context, minLat, minLon, maxLat, maxLon, lat, lon float64, limit int) ([]models.NearbyHouse, error)
+	StreamHouses(ctx context.Context, box *[4]float64, fn func(models.House) error) error
+}
+
+type FlatRepository interface {
+	GetFlats(ctx context.Context, houseID int, filter models.FlatFilter) ([]models.Flat, error)
+	StreamFlats(ctx context.Context, houseID *int, filter models.FlatFilter, fn func(models.Flat) error) error
+	GetFlat(ctx context.Context, flatID int) (models.Flat, error)
+	CreateFlat(ctx context.Context, flat models.Flat) (models.Flat, error)
+	CreateFlats(ctx context.Context, houseID int, flats []models.Flat) ([]models.Flat, error)
+	// UpdateFlat меняет статус квартиры. При статусе on_moderation квартира закрепляется за moderatorID,
+	// если такой пользователь есть; при остальных статусах закрепление снимается.
+	UpdateFlat(ctx context.Context, flatID int, status models.FlatStatus, moderatorID uuid.UUID) (models.Flat, error)
+	UpdateFlatPrice(ctx context.Context, flatID int, price int) (models.Flat, int, error)
+	GetFlatPrices(ctx context.Context, flatID int) ([]models.FlatPrice, error)
+	GetFlatModerator(ctx context.Context, flatID int) (uuid.UUID, error)
+}
+
+type PhotoRepository interface {
+	CreateFlatPhoto(ctx context.Context, photo models.FlatPhoto) (models.FlatPhoto, error)
+	GetHousePhotos(ctx context.Context, houseID int) ([]models.FlatPhoto, error)
+}
+
+type SubscriptionRepository interface {
+	SubscribeToNewFlats(ctx context.Context, houseID int, email string) error
+	GetSubscribers(ctx context.Context, houseID int) ([]string, error)
+}
+
+type StatsRepository interface {
+	GetStats(ctx context.Context) (models.Stats, error)
+}
+
+// Repository объединяет все хранилища приложения.
+type Repository interface {
+	UserRepository
+	HouseRepository
+	FlatRepository
+	PhotoRepository
+	SubscriptionRepository
+	StatsRepository
+}
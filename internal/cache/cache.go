@@ -0,0 +1,20 @@
+// Package cache описывает кеш, через который приложение читает горячие данные, и его реализацию в памяти процесса.
+// Внешний кеш (например, Redis) подключается реализацией того же интерфейса.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache хранит байтовые значения по строковым ключам. Реализации должны быть безопасны для
+// одновременного использования. Ошибка кеша не должна ломать чтение: вызывающий код в этом
+// случае идет в хранилище напрямую.
+type Cache interface {
+	// Get возвращает значение и true, если оно есть и не устарело
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set сохраняет значение на ttl; ttl 0 - без ограничения времени
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete удаляет значение; отсутствие ключа не является ошибкой
+	Delete(ctx context.Context, key string) error
+}
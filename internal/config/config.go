@@ -1,23 +1,555 @@
 package config
 
-import "os"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Vykiy/house-service/internal/tlsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted подставляется вместо секретов при выводе конфигурации
+const redacted = "[REDACTED]"
+
+// Config - настройки сервиса. Каждое поле задается ключом YAML-файла из тега yaml, переменной окружения
+// из тега env и флагом командной строки с именем ключа, где "_" заменено на "-" (server_address -> -server-address).
+// Поля с тегом secret не выводятся в --print-config, поля с тегом reload применяются по SIGHUP без перезапуска.
+// Списки в переменных окружения и флагах перечисляются через запятую.
 type Config struct {
-	ServerAddress string
-	JWTSecret     string
-	DBConnection  string
-}
+	ServerAddress string `yaml:"server_address" env:"SERVER_ADDRESS"`
+	// MetricsAddress - отдельный внутренний адрес для /metrics, чтобы метрики не были доступны снаружи;
+	// MetricsDisabled - не отдавать. Пустая переменная окружения считается незаданной, поэтому отключение задается явно
+	MetricsAddress string `yaml:"metrics_address" env:"METRICS_ADDRESS"`
+	// Таймауты http.Server; 0 - без ограничения
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	// ShutdownTimeout ограничивает ожидание завершения принятых запросов при остановке
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDrainDelay - сколько /readyz отвечает неготовностью перед остановкой сервера,
+	// чтобы балансировщики успели убрать экземпляр из ротации
+	ShutdownDrainDelay time.Duration `yaml:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY"`
+
+	// TLS: пути к сертификату и ключу (пусто - обычный HTTP); файлы перечитываются при изменении
+	// раз в TLSReloadInterval и по SIGHUP
+	TLSCertFile       string        `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile        string        `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	TLSReloadInterval time.Duration `yaml:"tls_reload_interval" env:"TLS_RELOAD_INTERVAL"`
+	// TLSClientAuth - проверка клиентских сертификатов по TLSClientCAFile: none, optional или require
+	TLSClientAuth   string `yaml:"tls_client_auth" env:"TLS_CLIENT_AUTH"`
+	TLSClientCAFile string `yaml:"tls_client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	// TLSClientPrincipals сопоставляет имя из проверенного клиентского сертификата с ролью сервиса,
+	// записи вида "имя=user" или "имя=moderator"; такой сервис обращается к API без токена
+	TLSClientPrincipals []string `yaml:"tls_client_principals" env:"TLS_CLIENT_PRINCIPALS"`
+
+	JWTSecret string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true" reload:"true"`
+	// JWTPreviousSecrets - прежние секреты, токены с которыми еще принимаются; нужны для смены секрета
+	JWTPreviousSecrets []string `yaml:"jwt_previous_secrets" env:"JWT_PREVIOUS_SECRETS" secret:"true" reload:"true"`
+
+	// DBDriver - postgres или sqlite; для sqlite DBConnection содержит путь к файлу базы
+	DBDriver     string `yaml:"db_driver" env:"DB_DRIVER"`
+	DBConnection string `yaml:"db_connection" env:"DB_CONNECTION"`
+	// SchemaMismatch задает поведение при расхождении версии схемы базы со встроенными миграциями:
+	// fail - не запускаться, readonly - обслуживать только чтение, если схема новее сервиса
+	SchemaMismatch string `yaml:"schema_mismatch" env:"SCHEMA_MISMATCH"`
+	// SchemaCheckInterval - как часто работающий сервис заново сверяет схему базы
+	SchemaCheckInterval time.Duration `yaml:"schema_check_interval" env:"SCHEMA_CHECK_INTERVAL"`
+	// AutoMigrate включает применение встроенных миграций при запуске сервиса
+	AutoMigrate bool `yaml:"auto_migrate" env:"AUTO_MIGRATE"`
+	// DBQueryTimeout ограничивает время одной операции с базой в рамках запроса
+	DBQueryTimeout time.Duration `yaml:"db_query_timeout" env:"DB_QUERY_TIMEOUT"`
+	// Настройки пула соединений database/sql; 0 - без ограничения
+	DBMaxOpenConns    int           `yaml:"db_max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	DBMaxIdleConns    int           `yaml:"db_max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	DBConnMaxLifetime time.Duration `yaml:"db_conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	DBConnMaxIdleTime time.Duration `yaml:"db_conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+
+	// LogLevel - минимальный уровень логов: debug, info, warn или error
+	LogLevel string `yaml:"log_level" env:"LOG_LEVEL" reload:"true"`
+
+	// CORS: источники, которым браузер разрешит обращаться к API ("*" - любой; пусто - CORS выключен),
+	// разрешенные методы и заголовки запросов, заголовки ответа, доступные скриптам, передача cookie
+	// и авторизации, время кеширования предварительного запроса
+	CORSAllowedOrigins   []string      `yaml:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	CORSAllowedMethods   []string      `yaml:"cors_allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	CORSAllowedHeaders   []string      `yaml:"cors_allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	CORSExposedHeaders   []string      `yaml:"cors_exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	CORSAllowCredentials bool          `yaml:"cors_allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	CORSMaxAge           time.Duration `yaml:"cors_max_age" env:"CORS_MAX_AGE"`
 
-func NewConfig() *Config {
-	serverAddress := os.Getenv("SERVER_ADDRESS")
+	// FlatsCacheSize - сколько списков квартир домов хранится в памяти процесса; 0 выключает кеш.
+	// FlatsCacheTTL - сколько хранится запись; изменения других реплик видны сразу по времени изменения дома
+	FlatsCacheSize int           `yaml:"flats_cache_size" env:"FLATS_CACHE_SIZE"`
+	FlatsCacheTTL  time.Duration `yaml:"flats_cache_ttl" env:"FLATS_CACHE_TTL"`
 
-	jwtSecret := os.Getenv("JWT_SECRET")
+	// RateLimitStore - где хранятся ограничения входа: memory (в процессе) или postgres (общие для реплик)
+	RateLimitStore string `yaml:"rate_limit_store" env:"RATE_LIMIT_STORE"`
+	// Ограничения /login и /register: запросов в секунду и запас корзины, с одного IP и для одной учетной записи;
+	// частота 0 отключает ограничение
+	AuthIPRate       float64 `yaml:"auth_ip_rate" env:"AUTH_IP_RATE" reload:"true"`
+	AuthIPBurst      int     `yaml:"auth_ip_burst" env:"AUTH_IP_BURST" reload:"true"`
+	AuthAccountRate  float64 `yaml:"auth_account_rate" env:"AUTH_ACCOUNT_RATE" reload:"true"`
+	AuthAccountBurst int     `yaml:"auth_account_burst" env:"AUTH_ACCOUNT_BURST" reload:"true"`
+	// После LoginLockoutThreshold неверных паролей подряд вход блокируется на LoginLockoutBaseDelay,
+	// каждая следующая неудача удваивает блокировку до LoginLockoutMaxDelay; счетчик забывается
+	// через LoginLockoutWindow без неудач. Порог 0 отключает блокировку
+	LoginLockoutThreshold int           `yaml:"login_lockout_threshold" env:"LOGIN_LOCKOUT_THRESHOLD" reload:"true"`
+	LoginLockoutBaseDelay time.Duration `yaml:"login_lockout_base_delay" env:"LOGIN_LOCKOUT_BASE_DELAY" reload:"true"`
+	LoginLockoutMaxDelay  time.Duration `yaml:"login_lockout_max_delay" env:"LOGIN_LOCKOUT_MAX_DELAY" reload:"true"`
+	LoginLockoutWindow    time.Duration `yaml:"login_lockout_window" env:"LOGIN_LOCKOUT_WINDOW" reload:"true"`
+	// TrustedProxies - подсети обратных прокси (например, 10.0.0.0/8), от которых принимается
+	// X-Forwarded-For при ограничении запросов по IP; пусто - адрес берется только из соединения
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" reload:"true"`
 
-	dbConnection := os.Getenv("DB_CONNECTION")
+	// SenderBackend - способ отправки уведомлений: simulated (имитация почтового сервиса) или discard
+	SenderBackend     string        `yaml:"sender_backend" env:"SENDER_BACKEND" reload:"true"`
+	SenderMaxDelay    time.Duration `yaml:"sender_max_delay" env:"SENDER_MAX_DELAY" reload:"true"`
+	SenderFailureRate float64       `yaml:"sender_failure_rate" env:"SENDER_FAILURE_RATE" reload:"true"`
 
+	TracingExporter string `yaml:"tracing_exporter" env:"TRACING_EXPORTER"` // otlp, stdout или пусто - без экспорта
+	OTLPEndpoint    string `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+
+	StorageBackend   string `yaml:"storage_backend" env:"STORAGE_BACKEND"` // local или s3
+	StoragePath      string `yaml:"storage_path" env:"STORAGE_PATH"`
+	StorageURLSecret string `yaml:"storage_url_secret" env:"STORAGE_URL_SECRET" secret:"true"`
+	PhotosBaseURL    string `yaml:"photos_base_url" env:"PHOTOS_BASE_URL"`
+	S3Endpoint       string `yaml:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Region         string `yaml:"s3_region" env:"S3_REGION"`
+	S3Bucket         string `yaml:"s3_bucket" env:"S3_BUCKET"`
+	S3AccessKey      string `yaml:"s3_access_key" env:"S3_ACCESS_KEY" secret:"true"`
+	S3SecretKey      string `yaml:"s3_secret_key" env:"S3_SECRET_KEY" secret:"true"`
+	S3UseSSL         bool   `yaml:"s3_use_ssl" env:"S3_USE_SSL"`
+}
+
+// Default возвращает конфигурацию со значениями по умолчанию. Обязательные поля в ней пустые.
+func Default() *Config {
 	return &Config{
-		ServerAddress: serverAddress,
-		JWTSecret:     jwtSecret,
-		DBConnection:  dbConnection,
+		ServerAddress:      ":8080",
+		MetricsAddress:     ":9090",
+		ReadHeaderTimeout:  5 * time.Second,
+		ReadTimeout:        30 * time.Second,
+		WriteTimeout:       5 * time.Minute,
+		IdleTimeout:        2 * time.Minute,
+		ShutdownTimeout:    30 * time.Second,
+		ShutdownDrainDelay: 5 * time.Second,
+
+		TLSReloadInterval: 10 * time.Second,
+		TLSClientAuth:     "none",
+
+		DBDriver:            "postgres",
+		SchemaMismatch:      "fail",
+		SchemaCheckInterval: 15 * time.Second,
+		DBQueryTimeout:      5 * time.Second,
+		DBMaxOpenConns:      25,
+		DBMaxIdleConns:      25,
+		DBConnMaxLifetime:   30 * time.Minute,
+		DBConnMaxIdleTime:   5 * time.Minute,
+
+		LogLevel: "info",
+
+		CORSAllowedMethods: []string{"GET", "POST"},
+		CORSAllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-ID", "traceparent", "tracestate"},
+		CORSExposedHeaders: []string{"X-Request-ID", "Retry-After", "Content-Disposition"},
+		CORSMaxAge:         10 * time.Minute,
+
+		FlatsCacheSize: 1000,
+		FlatsCacheTTL:  time.Minute,
+
+		RateLimitStore:        "memory",
+		AuthIPRate:            1,
+		AuthIPBurst:           20,
+		AuthAccountRate:       0.2,
+		AuthAccountBurst:      5,
+		LoginLockoutThreshold: 5,
+		LoginLockoutBaseDelay: time.Second,
+		LoginLockoutMaxDelay:  15 * time.Minute,
+		LoginLockoutWindow:    time.Hour,
+
+		SenderBackend:     "simulated",
+		SenderMaxDelay:    3 * time.Second,
+		SenderFailureRate: 0.1,
+
+		StorageBackend: "local",
+		StoragePath:    "photos",
+		PhotosBaseURL:  "/photos",
+	}
+}
+
+// Command - параметры запуска, которые не входят в конфигурацию.
+type Command struct {
+	// File - путь к YAML-файлу конфигурации из -config или CONFIG_FILE; пустой - без файла
+	File string
+	// PrintConfig - вывести итоговую конфигурацию без секретов и завершиться
+	PrintConfig bool
+}
+
+// Load собирает конфигурацию: значения по умолчанию, затем YAML-файл, переменные окружения и флаги args,
+// каждый следующий источник переопределяет предыдущий. Пустая переменная окружения считается незаданной.
+// Итоговая конфигурация проверяется, все ошибки возвращаются вместе.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, Command, error) {
+	var command Command
+
+	flags := flag.NewFlagSet("service", flag.ContinueOnError)
+	flags.StringVar(&command.File, "config", "", "путь к YAML-файлу конфигурации (CONFIG_FILE)")
+	flags.BoolVar(&command.PrintConfig, "print-config", false, "вывести конфигурацию без секретов и завершиться")
+
+	fields := configFields()
+	for _, field := range fields {
+		flags.String(field.flag, "", fmt.Sprintf("%s (%s)", field.yaml, field.env))
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, Command{}, err
+	}
+	if flags.NArg() > 0 {
+		return nil, Command{}, fmt.Errorf("лишние аргументы: %s", strings.Join(flags.Args(), " "))
+	}
+
+	if command.File == "" {
+		command.File, _ = lookupEnv("CONFIG_FILE")
+	}
+
+	config := Default()
+
+	if command.File != "" {
+		if err := config.loadFile(command.File); err != nil {
+			return nil, Command{}, err
+		}
+	}
+
+	var errs []error
+	value := reflect.ValueOf(config).Elem()
+	for _, field := range fields {
+		if env, ok := lookupEnv(field.env); ok && env != "" {
+			if err := setField(value.Field(field.index), env); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", field.env, err))
+			}
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		for _, field := range fields {
+			if field.flag == f.Name {
+				if err := setField(value.Field(field.index), f.Value.String()); err != nil {
+					errs = append(errs, fmt.Errorf("-%s: %w", field.flag, err))
+				}
+			}
+		}
+	})
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, Command{}, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, Command{}, err
+	}
+
+	return config, command, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла конфигурации: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	// опечатка в ключе не должна молча оставлять значение по умолчанию
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("ошибка разбора файла конфигурации %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Validate проверяет обязательные поля и допустимые значения.
+func (c *Config) Validate() error {
+	var errs []error
+	required := func(value, name string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("не задан %s", name))
+		}
+	}
+	oneOf := func(value, name string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: недопустимое значение %q, ожидается одно из %s", name, value, strings.Join(allowed, ", ")))
+	}
+
+	required(c.ServerAddress, "SERVER_ADDRESS")
+	if c.MetricsEnabled() && c.MetricsAddress == c.ServerAddress {
+		errs = append(errs, fmt.Errorf("METRICS_ADDRESS должен отличаться от SERVER_ADDRESS"))
+	}
+	required(c.JWTSecret, "JWT_SECRET")
+	required(c.DBConnection, "DB_CONNECTION")
+
+	oneOf(c.DBDriver, "DB_DRIVER", "postgres", "sqlite")
+	oneOf(c.SchemaMismatch, "SCHEMA_MISMATCH", "fail", "readonly")
+	if c.SchemaCheckInterval <= 0 {
+		errs = append(errs, fmt.Errorf("SCHEMA_CHECK_INTERVAL: должен быть больше нуля"))
+	}
+	oneOf(c.TracingExporter, "TRACING_EXPORTER", "", "none", "otlp", "stdout")
+	oneOf(c.StorageBackend, "STORAGE_BACKEND", "local", "s3")
+	oneOf(c.SenderBackend, "SENDER_BACKEND", "simulated", "discard")
+
+	if c.CORSAllowCredentials && slices.Contains(c.CORSAllowedOrigins, "*") {
+		errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS: \"*\" нельзя сочетать с CORS_ALLOW_CREDENTIALS, перечислите источники явно"))
+	}
+	for _, origin := range c.CORSAllowedOrigins {
+		if parsed, err := url.Parse(origin); origin != "*" && (err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Path != "") {
+			errs = append(errs, fmt.Errorf("CORS_ALLOWED_ORIGINS: %q не является источником вида https://example.com", origin))
+		}
 	}
+
+	oneOf(c.TLSClientAuth, "TLS_CLIENT_AUTH", "none", "optional", "require")
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, fmt.Errorf("TLS_CERT_FILE и TLS_KEY_FILE задаются вместе"))
+	}
+	if c.TLSCertFile != "" && c.TLSReloadInterval <= 0 {
+		errs = append(errs, fmt.Errorf("TLS_RELOAD_INTERVAL: должен быть больше нуля"))
+	}
+	if c.TLSClientAuth != "none" && c.TLSClientCAFile == "" {
+		errs = append(errs, fmt.Errorf("TLS_CLIENT_AUTH=%s требует TLS_CLIENT_CA_FILE", c.TLSClientAuth))
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		errs = append(errs, fmt.Errorf("TLS_CLIENT_CA_FILE требует TLS_CERT_FILE и TLS_KEY_FILE"))
+	}
+	if len(c.TLSClientPrincipals) > 0 && c.TLSClientAuth == "none" {
+		errs = append(errs, fmt.Errorf("TLS_CLIENT_PRINCIPALS требует TLS_CLIENT_AUTH=optional или require"))
+	}
+	if _, err := tlsutil.ParsePrincipals(c.TLSClientPrincipals); err != nil {
+		errs = append(errs, fmt.Errorf("TLS_CLIENT_PRINCIPALS: %w", err))
+	}
+
+	oneOf(c.RateLimitStore, "RATE_LIMIT_STORE", "memory", "postgres")
+	if c.RateLimitStore == "postgres" && c.DBDriver != "postgres" {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE=postgres требует DB_DRIVER=postgres"))
+	}
+	if c.AuthIPRate > 0 && c.AuthIPBurst < 1 {
+		errs = append(errs, fmt.Errorf("AUTH_IP_BURST: должен быть не меньше 1"))
+	}
+	if c.AuthAccountRate > 0 && c.AuthAccountBurst < 1 {
+		errs = append(errs, fmt.Errorf("AUTH_ACCOUNT_BURST: должен быть не меньше 1"))
+	}
+	if c.LoginLockoutThreshold > 0 {
+		if c.LoginLockoutBaseDelay <= 0 {
+			errs = append(errs, fmt.Errorf("LOGIN_LOCKOUT_BASE_DELAY: должен быть больше нуля"))
+		}
+		if c.LoginLockoutMaxDelay < c.LoginLockoutBaseDelay {
+			errs = append(errs, fmt.Errorf("LOGIN_LOCKOUT_MAX_DELAY: должен быть не меньше LOGIN_LOCKOUT_BASE_DELAY"))
+		}
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %q не является подсетью вида 10.0.0.0/8", proxy))
+		}
+	}
+
+	if c.SenderFailureRate < 0 || c.SenderFailureRate > 1 {
+		errs = append(errs, fmt.Errorf("SENDER_FAILURE_RATE: значение должно быть от 0 до 1"))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: недопустимое значение %q, ожидается debug, info, warn или error", c.LogLevel))
+	}
+
+	if c.StorageBackend == "local" {
+		// ссылки на фотографии подписываются своим секретом, а не секретом JWT
+		required(c.StorageURLSecret, "STORAGE_URL_SECRET")
+	}
+	if c.StorageBackend == "s3" {
+		required(c.S3Endpoint, "S3_ENDPOINT")
+		required(c.S3Bucket, "S3_BUCKET")
+		required(c.S3AccessKey, "S3_ACCESS_KEY")
+		required(c.S3SecretKey, "S3_SECRET_KEY")
+	}
+
+	value := reflect.ValueOf(c).Elem()
+	for _, field := range configFields() {
+		switch v := value.Field(field.index).Interface().(type) {
+		case time.Duration:
+			if v < 0 {
+				errs = append(errs, fmt.Errorf("%s: значение не может быть отрицательным", field.env))
+			}
+		case int:
+			if v < 0 {
+				errs = append(errs, fmt.Errorf("%s: значение не может быть отрицательным", field.env))
+			}
+		case float64:
+			if v < 0 {
+				errs = append(errs, fmt.Errorf("%s: значение не может быть отрицательным", field.env))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// MetricsDisabled - значение METRICS_ADDRESS, отключающее сервер метрик.
+const MetricsDisabled = "off"
+
+// MetricsEnabled сообщает, нужно ли отдавать /metrics на MetricsAddress.
+func (c *Config) MetricsEnabled() bool {
+	return c.MetricsAddress != "" && c.MetricsAddress != MetricsDisabled
+}
+
+// Redacted возвращает копию конфигурации, в которой секреты и пароль в DB_CONNECTION заменены на [REDACTED].
+func (c *Config) Redacted() *Config {
+	copied := *c
+
+	value := reflect.ValueOf(&copied).Elem()
+	for _, field := range configFields() {
+		if !field.secret {
+			continue
+		}
+
+		switch secret := value.Field(field.index).Interface().(type) {
+		case string:
+			if secret != "" {
+				value.Field(field.index).SetString(redacted)
+			}
+		case []string:
+			hidden := make([]string, len(secret))
+			for i := range hidden {
+				hidden[i] = redacted
+			}
+			value.Field(field.index).Set(reflect.ValueOf(hidden))
+		}
+	}
+
+	copied.DBConnection = redactDSN(copied.DBDriver, copied.DBConnection)
+
+	return &copied
+}
+
+// RestartRequired возвращает переменные окружения полей, которые отличаются в next, но применяются
+// только при запуске сервиса.
+func (c *Config) RestartRequired(next *Config) []string {
+	current, updated := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+
+	var fields []string
+	for _, field := range configFields() {
+		if !field.reload && !reflect.DeepEqual(current.Field(field.index).Interface(), updated.Field(field.index).Interface()) {
+			fields = append(fields, field.env)
+		}
+	}
+
+	return fields
+}
+
+// YAML возвращает конфигурацию в формате файла конфигурации.
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// redactDSN скрывает пароль в строке подключения PostgreSQL в виде URL или key=value.
+func redactDSN(driver, dsn string) string {
+	if driver == "sqlite" || dsn == "" {
+		return dsn
+	}
+
+	if parsed, err := url.Parse(dsn); err == nil && parsed.Scheme != "" {
+		return parsed.Redacted()
+	}
+
+	parts := strings.Fields(dsn)
+	for i, part := range parts {
+		if strings.HasPrefix(part, "password=") {
+			parts[i] = "password=" + redacted
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+type configField struct {
+	index  int
+	yaml   string
+	env    string
+	flag   string
+	secret bool
+	reload bool
+}
+
+func configFields() []configField {
+	configType := reflect.TypeOf(Config{})
+
+	fields := make([]configField, 0, configType.NumField())
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		name := field.Tag.Get("yaml")
+		fields = append(fields, configField{
+			index:  i,
+			yaml:   name,
+			env:    field.Tag.Get("env"),
+			flag:   strings.ReplaceAll(name, "_", "-"),
+			secret: field.Tag.Get("secret") == "true",
+			reload: field.Tag.Get("reload") == "true",
+		})
+	}
+
+	return fields
+}
+
+// setField разбирает строку из переменной окружения или флага в тип поля.
+func setField(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("ожидается true или false, получено %q", value)
+		}
+		field.SetBool(parsed)
+	case int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("ожидается целое число, получено %q", value)
+		}
+		field.SetInt(int64(parsed))
+	case float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("ожидается число, получено %q", value)
+		}
+		field.SetFloat(parsed)
+	case []string:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case time.Duration:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("ожидается длительность, например 5s, получено %q", value)
+		}
+		field.SetInt(int64(parsed))
+	default:
+		return fmt.Errorf("неподдерживаемый тип поля %s", field.Type())
+	}
+
+	return nil
 }
@@ -0,0 +1,199 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+	FormatXLSX   Format = "xlsx"
+)
+
+// flushEvery - через сколько строк сбрасывать буфер, чтобы клиент получал данные по мере выгрузки.
+const flushEvery = 100
+
+// formulaPrefixes - символы, с которых табличные редакторы начинают формулу.
+const formulaPrefixes = "=+-@\t\r"
+
+// ContentType возвращает MIME-тип выгрузки.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Writer построчно записывает выгрузку. object используется в NDJSON, values - в табличных форматах
+// и должны идти в порядке заголовка.
+type Writer interface {
+	Write(object interface{}, values []interface{}) error
+	Close() error
+}
+
+// NewWriter создает Writer для формата. flush вызывается после каждых flushEvery строк и может быть nil.
+func NewWriter(format Format, w io.Writer, header []string, flush func()) (Writer, error) {
+	if flush == nil {
+		flush = func() {}
+	}
+
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, header, flush)
+	case FormatNDJSON:
+		return &ndjsonWriter{encoder: json.NewEncoder(w), flush: flush}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w, header)
+	default:
+		return nil, fmt.Errorf("неизвестный формат выгрузки: %s", format)
+	}
+}
+
+// escapeCell не дает табличному редактору выполнить текст из базы как формулу: строка, начинающаяся
+// с символа формулы, получает префикс "'". Числа и остальные строки не меняются.
+func escapeCell(value interface{}) interface{} {
+	if s, ok := value.(string); ok && s != "" && strings.ContainsRune(formulaPrefixes, rune(s[0])) {
+		return "'" + s
+	}
+
+	return value
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	flush  func()
+	rows   int
+}
+
+func newCSVWriter(w io.Writer, header []string, flush func()) (*csvWriter, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &csvWriter{writer: writer, flush: flush}, nil
+}
+
+func (c *csvWriter) Write(_ interface{}, values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = fmt.Sprint(escapeCell(value))
+	}
+
+	if err := c.writer.Write(record); err != nil {
+		return err
+	}
+
+	if c.rows++; c.rows%flushEvery == 0 {
+		c.writer.Flush()
+		c.flush()
+	}
+
+	return c.writer.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.writer.Flush()
+	c.flush()
+	return c.writer.Error()
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+	flush   func()
+	rows    int
+}
+
+func (n *ndjsonWriter) Write(object interface{}, _ []interface{}) error {
+	if err := n.encoder.Encode(object); err != nil {
+		return err
+	}
+
+	if n.rows++; n.rows%flushEvery == 0 {
+		n.flush()
+	}
+
+	return nil
+}
+
+func (n *ndjsonWriter) Close() error {
+	n.flush()
+	return nil
+}
+
+// xlsxWriter пишет строки через потоковый режим excelize, который держит лист во временном
+// файле, а не в памяти. XLSX - zip-архив, поэтому клиент получит его целиком только в конце.
+type xlsxWriter struct {
+	w      io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+const xlsxSheet = "Sheet1"
+
+func newXLSXWriter(w io.Writer, header []string) (*xlsxWriter, error) {
+	file := excelize.NewFile()
+
+	stream, err := file.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	writer := &xlsxWriter{w: w, file: file, stream: stream}
+
+	values := make([]interface{}, len(header))
+	for i, column := range header {
+		values[i] = column
+	}
+
+	if err := writer.Write(nil, values); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (x *xlsxWriter) Write(_ interface{}, values []interface{}) error {
+	x.row++
+
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+
+	escaped := make([]interface{}, len(values))
+	for i, value := range values {
+		escaped[i] = escapeCell(value)
+	}
+
+	return x.stream.SetRow(cell, escaped)
+}
+
+// Close дописывает файл в w и удаляет временные файлы excelize. Вызывается и при ошибке выгрузки,
+// чтобы временные файлы не оставались на диске.
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+
+	return x.file.Write(x.w)
+}
@@ -0,0 +1,52 @@
+// Package httputil содержит общие вспомогательные типы для HTTP-middleware.
+package httputil
+
+import "net/http"
+
+// ResponseRecorder запоминает код ответа и объем тела. Flush пробрасывается, чтобы потоковые
+// выгрузки продолжали отправлять данные частями.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	Status      int
+	Bytes       int
+	wroteHeader bool
+}
+
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	// вложенные middleware делят один recorder и видят один и тот же код ответа
+	if recorder, ok := w.(*ResponseRecorder); ok {
+		return recorder
+	}
+
+	// если обработчик ничего не вызвал, net/http отвечает 200
+	return &ResponseRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *ResponseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.Status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *ResponseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.Bytes += n
+	return n, err
+}
+
+// Written сообщает, что код ответа уже отправлен и изменить его нельзя.
+func (r *ResponseRecorder) Written() bool {
+	return r.wroteHeader
+}
+
+func (r *ResponseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
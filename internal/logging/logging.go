@@ -0,0 +1,119 @@
+// Package logging настраивает структурированные JSON-логи на log/slog и передает в них
+// идентификатор запроса и пользователя из контекста.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// redacted подставляется вместо значений, которые нельзя писать в логи
+const redacted = "[REDACTED]"
+
+// sensitiveKeys - ключи атрибутов, значения которых никогда не попадают в логи, даже если их передали по ошибке
+var sensitiveKeys = []string{"password", "token", "authorization", "secret", "jwt", "cookie"}
+
+// level общий для логгера по умолчанию, чтобы его можно было менять без пересоздания логгера
+var level slog.LevelVar
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	requestInfoKey
+)
+
+// requestInfo заполняется по ходу обработки запроса: пользователь становится известен только
+// после проверки токена, а в журнал доступа попадает после ответа
+type requestInfo struct {
+	userID uuid.UUID
+}
+
+// Setup создает JSON-логгер с уровнем logLevel (debug, info, warn, error) и делает его логгером по умолчанию.
+func Setup(logLevel string, w io.Writer) (*slog.Logger, error) {
+	if err := SetLevel(logLevel); err != nil {
+		return nil, err
+	}
+
+	logger := slog.New(&contextHandler{Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       &level,
+		ReplaceAttr: redact,
+	})})
+	slog.SetDefault(logger)
+
+	return logger, nil
+}
+
+// SetLevel меняет минимальный уровень логов на лету.
+func SetLevel(logLevel string) error {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(logLevel)); err != nil {
+		return fmt.Errorf("неизвестный уровень логирования: %s", logLevel)
+	}
+
+	level.Set(parsed)
+	return nil
+}
+
+// WithRequestID сохраняет идентификатор запроса в контексте.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID возвращает идентификатор запроса из контекста или пустую строку.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// SetUserID запоминает пользователя запроса для журнала доступа и последующих записей.
+func SetUserID(ctx context.Context, userID uuid.UUID) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.userID = userID
+	}
+}
+
+func withRequestInfo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestInfoKey, &requestInfo{})
+}
+
+// contextHandler добавляет в каждую запись идентификаторы запроса и пользователя из контекста.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok && info.userID != uuid.Nil {
+		record.AddAttrs(slog.String("user_id", info.userID.String()))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(attr.Key, redacted)
+		}
+	}
+
+	return attr
+}
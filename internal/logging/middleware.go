@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/httputil"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader - заголовок, в котором идентификатор запроса приходит от клиента или прокси и возвращается в ответе
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength ограничивает идентификатор от клиента, чтобы через него нельзя было раздуть логи
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware берет идентификатор запроса из X-Request-ID или создает новый,
+// кладет его в контекст и возвращает клиенту в том же заголовке.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// AccessLog пишет по записи на каждый запрос: маршрут, код ответа, время обработки и пользователя.
+// Заголовки и тело не логируются, поэтому токены и пароли в журнал не попадают.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := withRequestInfo(r.Context())
+		start := time.Now()
+		recorder := httputil.NewResponseRecorder(w)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if recorder.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		slog.Log(ctx, level, "запрос обработан",
+			"method", r.Method,
+			"route", route,
+			"status", recorder.Status,
+			"bytes", recorder.Bytes,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+		)
+	})
+}
+
+// validRequestID допускает только печатные ASCII-символы, чтобы идентификатор не ломал строки логов.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
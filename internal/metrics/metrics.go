@@ -0,0 +1,158 @@
+// Package metrics описывает метрики Prometheus сервиса и отдает их на /metrics.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/httputil"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "house_service"
+
+// statsTimeout ограничивает подсчет бизнес-показателей при сборе метрик
+const statsTimeout = 5 * time.Second
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Время обработки HTTP-запросов по шаблону маршрута и коду ответа.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Время операций хранилища по операции и результату (ok, not_found, error).",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "result"})
+
+	emailsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "notifications",
+		Name:      "emails_total",
+		Help:      "Уведомления подписчикам по результату отправки (sent, failed).",
+	}, []string{"result"})
+
+	cacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Обращения к кешу по кешу и результату (hit, miss, stale, error).",
+	}, []string{"cache", "result"})
+)
+
+// Handler отдает метрики в формате Prometheus.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware замеряет время обработки запросов. Подключается через mux.Router.Use, чтобы
+// в метку route попадал шаблон маршрута (/house/{id}), а не путь с конкретными идентификаторами.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		recorder := httputil.NewResponseRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		httpRequestDuration.WithLabelValues(r.Method, route, strconv.Itoa(recorder.Status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveQuery записывает время операции хранилища, начатой в start. err передается указателем,
+// чтобы вызов можно было отложить через defer до того, как станет известен результат.
+func ObserveQuery(operation string, start time.Time, err *error) {
+	result := "ok"
+	if errors.Is(*err, sql.ErrNoRows) {
+		result = "not_found"
+	} else if *err != nil {
+		result = "error"
+	}
+
+	dbQueryDuration.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
+
+// ObserveEmail учитывает отправленное или неотправленное уведомление.
+func ObserveEmail(sent bool) {
+	if sent {
+		emailsTotal.WithLabelValues("sent").Inc()
+	} else {
+		emailsTotal.WithLabelValues("failed").Inc()
+	}
+}
+
+// ObserveCache учитывает обращение к кешу name: hit - найдено, miss - нет записи, stale - запись устарела,
+// error - кеш недоступен.
+func ObserveCache(name, result string) {
+	cacheRequestsTotal.WithLabelValues(name, result).Inc()
+}
+
+// RegisterDB публикует статистику пула соединений с базой.
+func RegisterDB(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterStats публикует бизнес-показатели: число домов и квартир по статусам.
+// stats вызывается при каждом сборе метрик.
+func RegisterStats(stats func(ctx context.Context) (models.Stats, error)) error {
+	return prometheus.Register(&statsCollector{stats: stats})
+}
+
+var (
+	housesDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "houses"), "Число домов.", nil, nil)
+	flatsDesc  = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "flats"), "Число квартир по статусу модерации.", []string{"status"}, nil)
+)
+
+type statsCollector struct {
+	stats func(ctx context.Context) (models.Stats, error)
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- housesDesc
+	ch <- flatsDesc
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	stats, err := c.stats(ctx)
+	if err != nil {
+		slog.Error("сбор бизнес-метрик", "error", err)
+		ch <- prometheus.NewInvalidMetric(housesDesc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(housesDesc, prometheus.GaugeValue, float64(stats.Houses))
+
+	// статусы без квартир публикуются нулями, чтобы ряды не пропадали из графиков
+	for _, status := range []models.FlatStatus{models.FlatStatusCreated, models.FlatStatusOnModeration, models.FlatStatusApproved, models.FlatStatusDeclined} {
+		if _, ok := stats.FlatsByStatus[status]; !ok {
+			stats.FlatsByStatus[status] = 0
+		}
+	}
+	for status, count := range stats.FlatsByStatus {
+		ch <- prometheus.MustNewConstMetric(flatsDesc, prometheus.GaugeValue, float64(count), string(status))
+	}
+}
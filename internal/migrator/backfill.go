@@ -0,0 +1,98 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Vykiy/house-service/internal/address"
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// addressKeyVersion - миграция, добавившая houses.address_key
+const addressKeyVersion = 6
+
+// Backfill заполняет данные, которые миграции не могут вычислить в SQL: ключ адреса домов,
+// созданных до миграции addressKeyVersion, и домов, чей ключ сбросила миграция 12 при добавлении
+// в ключ города и индекса. Вызывается после применения миграций; повторный
+// вызов ничего не меняет. Если схема еще не дошла до нужной версии, ничего не делает.
+func Backfill(ctx context.Context, m *migrate.Migrate, driver, dsn string) error {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if dirty || version < addressKeyVersion {
+		return nil
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return backfillAddressKeys(ctx, db, driver)
+}
+
+// backfillAddressKeys вычисляет ключ адреса по тем же правилам, что и при создании дома. Если несколько
+// старых домов дают один ключ, ключ получает дом с меньшим ID, остальные остаются без ключа и попадают в лог.
+func backfillAddressKeys(ctx context.Context, db *sql.DB, driver string) error {
+	rows, err := db.QueryContext(ctx, "SELECT id, address, city, postal_code FROM houses WHERE address_key IS NULL ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("ошибка чтения домов без ключа адреса: %w", err)
+	}
+
+	type house struct {
+		id         int
+		address    string
+		city       string
+		postalCode string
+	}
+
+	var houses []house
+	for rows.Next() {
+		var h house
+		if err := rows.Scan(&h.id, &h.address, &h.city, &h.postalCode); err != nil {
+			rows.Close()
+			return err
+		}
+		houses = append(houses, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	query := "UPDATE houses SET address_key = $1 WHERE id = $2 AND NOT EXISTS (SELECT 1 FROM houses WHERE address_key = $1)"
+	if driver == "sqlite" {
+		query = "UPDATE houses SET address_key = ?1 WHERE id = ?2 AND NOT EXISTS (SELECT 1 FROM houses WHERE address_key = ?1)"
+	}
+
+	var duplicates []int
+	for _, h := range houses {
+		key := address.Key(h.address, h.city, h.postalCode)
+		if key == "" {
+			continue
+		}
+
+		result, err := db.ExecContext(ctx, query, key, h.id)
+		if err != nil {
+			return fmt.Errorf("ошибка заполнения ключа адреса дома %d: %w", h.id, err)
+		}
+
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			duplicates = append(duplicates, h.id)
+		}
+	}
+
+	if len(duplicates) > 0 {
+		slog.WarnContext(ctx, "дома с совпадающим адресом оставлены без ключа адреса, объедините их вручную", "house_ids", duplicates)
+	}
+
+	return nil
+}
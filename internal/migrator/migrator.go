@@ -0,0 +1,206 @@
+// Package migrator применяет миграции схемы базы данных: встроенные в бинарный файл
+// или из каталога с файлами N_name.up.sql и N_name.down.sql.
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Vykiy/house-service/cmd/migrator/migrations"
+	"github.com/Vykiy/house-service/cmd/migrator/migrations_sqlite"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// advisoryLockID - ключ advisory-блокировки PostgreSQL, под которой сервис применяет миграции при запуске
+const advisoryLockID = 7226135010
+
+var migrationNameRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// DefaultPath возвращает каталог миграций по умолчанию для драйвера базы данных.
+func DefaultPath(driver string) string {
+	if driver == "sqlite" {
+		return "migrations_sqlite"
+	}
+
+	return "migrations"
+}
+
+// Up применяет недостающие встроенные миграции и заполняет данные через Backfill. В PostgreSQL это делается под advisory-блокировкой:
+// из одновременно запущенных реплик миграции выполняет первая, остальные дожидаются ее
+// и обнаруживают, что применять нечего.
+func Up(ctx context.Context, driver, dsn string) error {
+	if driver == "postgres" {
+		unlock, err := lockPostgres(ctx, dsn)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	m, err := New(driver, dsn, "")
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return Backfill(ctx, m, driver, dsn)
+}
+
+// New подключается к базе и готовит миграции из каталога path, при пустом path - встроенные.
+// driver - postgres или sqlite, для sqlite dsn содержит путь к файлу базы. Вызывающий закрывает результат через Close.
+func New(driver, dsn, path string) (*migrate.Migrate, error) {
+	var (
+		db         *sql.DB
+		dbInstance database.Driver
+		err        error
+	)
+
+	switch driver {
+	case "postgres":
+		db, err = sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		dbInstance, err = postgres.WithInstance(db, &postgres.Config{})
+	case "sqlite":
+		db, err = sql.Open("sqlite", dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		dbInstance, err = sqlite.WithInstance(db, &sqlite.Config{})
+	default:
+		return nil, fmt.Errorf("неизвестный драйвер базы данных: %s", driver)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	var m *migrate.Migrate
+	if path == "" {
+		var (
+			embedded  fs.FS
+			migration source.Driver
+		)
+		if embedded, err = embeddedMigrations(driver); err == nil {
+			if migration, err = iofs.New(embedded, "."); err == nil {
+				m, err = migrate.NewWithInstance("iofs", migration, driver, dbInstance)
+			}
+		}
+	} else {
+		var absPath string
+		if absPath, err = filepath.Abs(path); err == nil {
+			m, err = migrate.NewWithDatabaseInstance("file://"+filepath.ToSlash(absPath), driver, dbInstance)
+		}
+	}
+	if err != nil {
+		dbInstance.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func embeddedMigrations(driver string) (fs.FS, error) {
+	switch driver {
+	case "postgres":
+		return migrations.FS, nil
+	case "sqlite":
+		return migrations_sqlite.FS, nil
+	default:
+		return nil, fmt.Errorf("неизвестный драйвер базы данных: %s", driver)
+	}
+}
+
+// Create добавляет в каталог path пустую пару файлов миграции со следующим по порядку номером
+// и возвращает пути к ним.
+func Create(path, name string) (string, string, error) {
+	if !migrationNameRegexp.MatchString(name) {
+		return "", "", fmt.Errorf("имя миграции может содержать только строчные латинские буквы, цифры и _: %q", name)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	lastVersion := 0
+	for _, entry := range entries {
+		prefix, _, found := strings.Cut(entry.Name(), "_")
+		if !found {
+			continue
+		}
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			continue
+		}
+
+		lastVersion = max(lastVersion, version)
+	}
+
+	base := filepath.Join(path, fmt.Sprintf("%d_%s", lastVersion+1, name))
+	up, down := base+".up.sql", base+".down.sql"
+
+	for _, file := range []string{up, down} {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+
+		if err := f.Close(); err != nil {
+			return "", "", err
+		}
+	}
+
+	return up, down, nil
+}
+
+// lockPostgres ждет advisory-блокировку на отдельном соединении и возвращает функцию, снимающую ее.
+func lockPostgres(ctx context.Context, dsn string) (func(), error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", advisoryLockID); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, fmt.Errorf("ошибка получения блокировки миграций: %w", err)
+	}
+
+	return func() {
+		// блокировка сессионная, поэтому закрытие соединения снимет ее, даже если unlock не выполнится
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockID)
+		conn.Close()
+		db.Close()
+	}, nil
+}
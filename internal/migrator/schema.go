@@ -0,0 +1,109 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// Schema описывает версию схемы базы относительно встроенных миграций. Version == 0 - миграции не применялись.
+type Schema struct {
+	Version  uint `json:"version"`
+	Expected uint `json:"expected"`
+	Dirty    bool `json:"dirty"`
+}
+
+// Err возвращает nil, если схема совпадает с ожидаемой, иначе ошибку с описанием расхождения.
+func (s Schema) Err() error {
+	switch {
+	case s.Dirty:
+		return fmt.Errorf("миграция %d базы данных завершилась с ошибкой (dirty), исправьте схему и выполните migrator force", s.Version)
+	case s.Version < s.Expected:
+		return fmt.Errorf("схема базы данных устарела: версия %d, ожидается %d; примените миграции", s.Version, s.Expected)
+	case s.Version > s.Expected:
+		return fmt.Errorf("схема базы данных новее сервиса: версия %d, ожидается %d; обновите сервис", s.Version, s.Expected)
+	}
+
+	return nil
+}
+
+// ReadOnlyCompatible сообщает, что схема новее сервиса и не грязная. Миграции только добавляют таблицы
+// и колонки, поэтому запросы чтения сервиса к такой схеме работают. К устаревшей схеме сервис обращается
+// к колонкам и таблицам, которых еще нет, а состояние грязной схемы неизвестно.
+func (s Schema) ReadOnlyCompatible() bool {
+	return !s.Dirty && s.Version > s.Expected
+}
+
+// ExpectedVersion возвращает последнюю версию среди встроенных миграций драйвера.
+func ExpectedVersion(driver string) (uint, error) {
+	embedded, err := embeddedMigrations(driver)
+	if err != nil {
+		return 0, err
+	}
+
+	source, err := iofs.New(embedded, ".")
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	version, err := source.First()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		next, err := source.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		version = next
+	}
+}
+
+// CheckSchema читает из таблицы golang-migrate версию схемы базы и сравнивает ее со встроенными миграциями.
+func CheckSchema(ctx context.Context, db *sql.DB, driver string) (Schema, error) {
+	expected, err := ExpectedVersion(driver)
+	if err != nil {
+		return Schema{}, err
+	}
+
+	schema := Schema{Expected: expected}
+
+	var tableQuery string
+	if driver == "sqlite" {
+		tableQuery = "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	} else {
+		tableQuery = "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, tableQuery).Scan(&exists); err != nil {
+		return Schema{}, err
+	}
+	if !exists {
+		return schema, nil
+	}
+
+	// golang-migrate хранит одну строку; после отката всех миграций таблица пустая
+	var version int64
+	err = db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &schema.Dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return schema, nil
+	} else if err != nil {
+		return Schema{}, err
+	}
+
+	if version > 0 {
+		schema.Version = uint(version)
+	}
+
+	return schema, nil
+}
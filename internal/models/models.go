@@ -1,6 +1,9 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
 
 type UserType string
 
@@ -21,20 +24,84 @@ const (
 )
 
 type House struct {
-	ID        int    `json:"id" db:"id"`
-	Address   string `json:"address" db:"address"`
-	YearBuilt int    `json:"yearBuilt" db:"year_built"`
-	Developer string `json:"developer" db:"developer"`
-	CreatedAt string `json:"createdAt" db:"created_at"`
-	UpdatedAt string `json:"updatedAt" db:"updated_at"`
+	ID         int      `json:"id" db:"id"`
+	Address    string   `json:"address" db:"address"`
+	City       string   `json:"city" db:"city"`
+	Street     string   `json:"street" db:"street"`
+	Building   string   `json:"building" db:"building"`
+	PostalCode string   `json:"postalCode" db:"postal_code"`
+	Latitude   *float64 `json:"latitude,omitempty" db:"latitude"`
+	Longitude  *float64 `json:"longitude,omitempty" db:"longitude"`
+	AddressKey *string  `json:"-" db:"address_key"` // нормализованный адрес, по которому ищутся дубликаты
+	YearBuilt  int      `json:"yearBuilt" db:"year_built"`
+	Developer  string   `json:"developer" db:"developer"`
+	CreatedAt  string   `json:"createdAt" db:"created_at"`
+	UpdatedAt  string   `json:"updatedAt" db:"updated_at"`
+}
+
+type NearbyHouse struct {
+	House
+	Distance float64 `json:"distance" db:"distance"` // расстояние в метрах от точки поиска
 }
 
 type Flat struct {
-	ID      int        `json:"id" db:"flat_number"` // используем номер квартиры относительно дома в качестве ID
-	HouseID int        `json:"houseId" db:"house_id"`
-	Price   int        `json:"price" db:"price"`
-	Rooms   int        `json:"rooms" db:"rooms"`
-	Status  FlatStatus `json:"status" db:"status"`
+	ID                  int            `json:"id" db:"flat_number"` // используем номер квартиры относительно дома в качестве ID
+	HouseID             int            `json:"houseId" db:"house_id"`
+	Price               int            `json:"price" db:"price"`
+	Rooms               int            `json:"rooms" db:"rooms"`
+	Status              FlatStatus     `json:"status" db:"status"`
+	Area                float64        `json:"area" db:"area"` // общая площадь в квадратных метрах, 0 - не указана
+	Floor               int            `json:"floor" db:"floor"`
+	Description         string         `json:"description" db:"description"`
+	Photos              pq.StringArray `json:"photos" db:"photos"` // ссылки на фотографии
+	PricePerSquareMeter float64        `json:"pricePerSquareMeter" db:"-"`
+	UploadedPhotos      []FlatPhoto    `json:"uploadedPhotos,omitempty" db:"-"`
+}
+
+// FlatPhoto - загруженная фотография квартиры. Ссылки подписываются при каждой выдаче.
+type FlatPhoto struct {
+	ID           int    `json:"id" db:"id"`
+	FlatID       int    `json:"-" db:"flat_id"`
+	FlatNumber   int    `json:"-" db:"flat_number"`
+	Key          string `json:"-" db:"storage_key"`
+	ThumbnailKey string `json:"-" db:"thumbnail_key"`
+	ContentType  string `json:"contentType" db:"content_type"`
+	Size         int64  `json:"size" db:"size"`
+	Width        int    `json:"width" db:"width"`
+	Height       int    `json:"height" db:"height"`
+	CreatedAt    string `json:"createdAt" db:"created_at"`
+	URL          string `json:"url" db:"-"`
+	ThumbnailURL string `json:"thumbnailUrl" db:"-"`
+}
+
+type FlatPrice struct {
+	Price     int    `json:"price" db:"price"`
+	ChangedAt string `json:"changedAt" db:"changed_at"`
+}
+
+// FlatFilter задает необязательные ограничения на выборку квартир, nil - без ограничения.
+type FlatFilter struct {
+	MinPrice *int
+	MaxPrice *int
+	MinArea  *float64
+	MaxArea  *float64
+	// Status оставляет квартиры в одном статусе: пользователи видят только одобренные
+	Status *FlatStatus
+}
+
+// Match сообщает, проходит ли квартира фильтр. Границы включаются, как в SQL-запросах хранилищ.
+func (f FlatFilter) Match(flat Flat) bool {
+	return (f.MinPrice == nil || flat.Price >= *f.MinPrice) &&
+		(f.MaxPrice == nil || flat.Price <= *f.MaxPrice) &&
+		(f.MinArea == nil || flat.Area >= *f.MinArea) &&
+		(f.MaxArea == nil || flat.Area <= *f.MaxArea) &&
+		(f.Status == nil || flat.Status == *f.Status)
+}
+
+// Stats - сводные показатели хранилища для метрик.
+type Stats struct {
+	Houses        int
+	FlatsByStatus map[FlatStatus]int
 }
 
 type User struct {
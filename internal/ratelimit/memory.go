@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// memoryCleanupInterval - как часто MemoryStore удаляет давно не использованные ключи
+const memoryCleanupInterval = time.Minute
+
+// memoryIdleTTL - ключ без обращений дольше этого времени удаляется: корзина за это время уже заполнилась,
+// а счетчик неудач устарел
+const memoryIdleTTL = 24 * time.Hour
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type failureCounter struct {
+	failures int
+	updated  time.Time
+}
+
+// MemoryStore хранит состояние в памяти процесса.
+type MemoryStore struct {
+	mu          sync.Mutex
+	buckets     map[string]*bucket
+	failures    map[string]*failureCounter
+	lastCleanup time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:     make(map[string]*bucket),
+		failures:    make(map[string]*failureCounter),
+		lastCleanup: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.cleanup(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return retryAfter(b.tokens, limit), nil
+	}
+
+	b.tokens--
+	return 0, nil
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.cleanup(now)
+
+	counter, ok := s.failures[key]
+	if !ok || (window > 0 && now.Sub(counter.updated) > window) {
+		counter = &failureCounter{}
+		s.failures[key] = counter
+	}
+
+	counter.failures++
+	counter.updated = now
+
+	return counter.failures, nil
+}
+
+func (s *MemoryStore) Failures(ctx context.Context, key string) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.failures[key]
+	if !ok {
+		return 0, 0, nil
+	}
+
+	return counter.failures, time.Since(counter.updated), nil
+}
+
+func (s *MemoryStore) ResetFailures(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+// cleanup вызывается под блокировкой, чтобы ключи от разовых клиентов не копились бесконечно
+func (s *MemoryStore) cleanup(now time.Time) {
+	if now.Sub(s.lastCleanup) < memoryCleanupInterval {
+		return
+	}
+	s.lastCleanup = now
+
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > memoryIdleTTL {
+			delete(s.buckets, key)
+		}
+	}
+	for key, counter := range s.failures {
+		if now.Sub(counter.updated) > memoryIdleTTL {
+			delete(s.failures, key)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresStore хранит состояние в таблицах rate_limits и login_failures, так что ограничения общие
+// для всех реплик. Время берется из базы, чтобы расхождение часов реплик не влияло на подсчет.
+type PostgresStore struct {
+	db *sqlx.DB
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take пополняет и списывает корзину одним запросом: строка блокируется на время обновления,
+// поэтому одновременные запросы разных реплик не получают один и тот же токен.
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	// параметры приводятся явно: иначе PostgreSQL выведет тип $2 из "$2 - 1" как integer
+	const available = "LEAST($2::double precision, rate_limits.tokens + EXTRACT(EPOCH FROM now() - rate_limits.updated_at)::double precision * $3::double precision)"
+
+	var (
+		allowed bool
+		tokens  float64
+	)
+	err := s.db.QueryRowxContext(ctx, `
+		INSERT INTO rate_limits (key, tokens, allowed, updated_at) VALUES ($1, $2::double precision - 1, TRUE, now())
+		ON CONFLICT (key) DO UPDATE SET
+			allowed = `+available+` >= 1,
+			tokens = `+available+` - CASE WHEN `+available+` >= 1 THEN 1 ELSE 0 END,
+			updated_at = now()
+		RETURNING allowed, tokens`,
+		key, float64(limit.Burst), limit.Rate,
+	).Scan(&allowed, &tokens)
+	if err != nil {
+		return 0, err
+	}
+
+	if !allowed {
+		return retryAfter(tokens, limit), nil
+	}
+
+	return 0, nil
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	var failures int
+	err := s.db.QueryRowxContext(ctx, `
+		INSERT INTO login_failures (key, failures, updated_at) VALUES ($1, 1, now())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN $2::double precision > 0 AND login_failures.updated_at < now() - make_interval(secs => $2::double precision) THEN 1
+				ELSE login_failures.failures + 1
+			END,
+			updated_at = now()
+		RETURNING failures`,
+		key, window.Seconds(),
+	).Scan(&failures)
+
+	return failures, err
+}
+
+func (s *PostgresStore) Failures(ctx context.Context, key string) (int, time.Duration, error) {
+	var (
+		failures int
+		since    float64
+	)
+	err := s.db.QueryRowxContext(ctx, "SELECT failures, EXTRACT(EPOCH FROM now() - updated_at) FROM login_failures WHERE key = $1", key).Scan(&failures, &since)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	return failures, time.Duration(since * float64(time.Second)), nil
+}
+
+func (s *PostgresStore) ResetFailures(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_failures WHERE key = $1", key)
+	return err
+}
+
+// Prune удаляет строки, которые не обновлялись дольше olderThan.
+func (s *PostgresStore) Prune(ctx context.Context, olderThan time.Duration) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM rate_limits WHERE updated_at < now() - make_interval(secs => $1::double precision)", olderThan.Seconds()); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_failures WHERE updated_at < now() - make_interval(secs => $1::double precision)", olderThan.Seconds())
+	return err
+}
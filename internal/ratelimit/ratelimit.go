@@ -0,0 +1,153 @@
+// Package ratelimit ограничивает частоту запросов алгоритмом token bucket и блокирует вход
+// после неудачных попыток с экспоненциально растущей задержкой.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Limit - пополнение корзины Rate токенов в секунду до Burst. Rate == 0 отключает ограничение.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Store хранит состояние корзин и счетчики неудачных попыток. Реализация в памяти подходит
+// для одного экземпляра сервиса, в PostgreSQL - для нескольких реплик.
+type Store interface {
+	// Take забирает токен из корзины key. Если токенов нет, возвращает время до появления следующего.
+	Take(ctx context.Context, key string, limit Limit) (time.Duration, error)
+	// RecordFailure увеличивает счетчик неудач key, начиная его заново, если прошлая неудача была раньше window.
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	// Failures возвращает число неудач key и время, прошедшее с последней из них.
+	Failures(ctx context.Context, key string) (int, time.Duration, error)
+	// ResetFailures сбрасывает счетчик неудач key.
+	ResetFailures(ctx context.Context, key string) error
+}
+
+// Limiter ограничивает запросы по ключу. Лимит можно менять на лету.
+type Limiter struct {
+	store  Store
+	prefix string
+	limit  atomic.Pointer[Limit]
+}
+
+// NewLimiter создает ограничитель. prefix отделяет его ключи от других ограничителей в том же хранилище.
+func NewLimiter(store Store, prefix string, limit Limit) *Limiter {
+	l := &Limiter{store: store, prefix: prefix}
+	l.SetLimit(limit)
+	return l
+}
+
+func (l *Limiter) SetLimit(limit Limit) {
+	l.limit.Store(&limit)
+}
+
+// Allow возвращает 0, если запрос с ключом key разрешен, иначе время, через которое его можно повторить.
+func (l *Limiter) Allow(ctx context.Context, key string) (time.Duration, error) {
+	limit := *l.limit.Load()
+	if limit.Rate <= 0 {
+		return 0, nil
+	}
+
+	return l.store.Take(ctx, l.prefix+key, limit)
+}
+
+// LockoutPolicy - после Threshold неудач подряд вход блокируется на BaseDelay, и каждая следующая
+// неудача удваивает блокировку, но не больше MaxDelay. Счетчик забывается, если неудач не было дольше Window.
+// Threshold == 0 отключает блокировку.
+type LockoutPolicy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+}
+
+// Delay возвращает длительность блокировки после failures неудач подряд.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+
+	// показатель ограничен, чтобы сдвиг не переполнил Duration
+	delay := time.Duration(float64(p.BaseDelay) * math.Pow(2, math.Min(float64(failures-p.Threshold), 62)))
+	if delay > p.MaxDelay || delay <= 0 {
+		return p.MaxDelay
+	}
+
+	return delay
+}
+
+// Lockout блокирует вход в учетную запись после повторяющихся неудачных попыток.
+type Lockout struct {
+	store  Store
+	policy atomic.Pointer[LockoutPolicy]
+}
+
+func NewLockout(store Store, policy LockoutPolicy) *Lockout {
+	l := &Lockout{store: store}
+	l.SetPolicy(policy)
+	return l
+}
+
+func (l *Lockout) SetPolicy(policy LockoutPolicy) {
+	l.policy.Store(&policy)
+}
+
+// Check возвращает 0, если вход в account разрешен, иначе оставшееся время блокировки.
+func (l *Lockout) Check(ctx context.Context, account string) (time.Duration, error) {
+	policy := *l.policy.Load()
+	if policy.Threshold <= 0 {
+		return 0, nil
+	}
+
+	failures, since, err := l.store.Failures(ctx, lockoutKey(account))
+	if err != nil {
+		return 0, err
+	}
+	if policy.Window > 0 && since > policy.Window {
+		return 0, nil
+	}
+
+	if delay := policy.Delay(failures); delay > since {
+		return delay - since, nil
+	}
+
+	return 0, nil
+}
+
+// Failure учитывает неудачную попытку входа и возвращает блокировку, которая после нее действует.
+func (l *Lockout) Failure(ctx context.Context, account string) (time.Duration, error) {
+	policy := *l.policy.Load()
+	if policy.Threshold <= 0 {
+		return 0, nil
+	}
+
+	failures, err := l.store.RecordFailure(ctx, lockoutKey(account), policy.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	return policy.Delay(failures), nil
+}
+
+// Success сбрасывает счетчик неудач после успешного входа.
+func (l *Lockout) Success(ctx context.Context, account string) error {
+	if policy := *l.policy.Load(); policy.Threshold <= 0 {
+		return nil
+	}
+
+	return l.store.ResetFailures(ctx, lockoutKey(account))
+}
+
+func lockoutKey(account string) string {
+	return "login:" + account
+}
+
+// retryAfter переводит недостающую долю токена во время ожидания.
+func retryAfter(tokens float64, limit Limit) time.Duration {
+	return time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+}
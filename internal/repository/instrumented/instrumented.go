@@ -0,0 +1,131 @@
+// Package instrumented оборачивает хранилище приложения и замеряет время каждой операции.
+// Обертка не зависит от базы, поэтому одинаково работает с PostgreSQL, SQLite и хранилищем в памяти.
+package instrumented
+
+import (
+	"context"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/metrics"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/google/uuid"
+)
+
+type Repository struct {
+	next app.Repository
+}
+
+func NewRepository(next app.Repository) *Repository {
+	return &Repository{next: next}
+}
+
+func (r *Repository) CreateUser(ctx context.Context, email, passwordHash string, userType models.UserType) (userID uuid.UUID, err error) {
+	defer metrics.ObserveQuery("create_user", time.Now(), &err)
+	return r.next.CreateUser(ctx, email, passwordHash, userType)
+}
+
+func (r *Repository) GetUser(ctx context.Context, userID uuid.UUID) (user models.User, err error) {
+	defer metrics.ObserveQuery("get_user", time.Now(), &err)
+	return r.next.GetUser(ctx, userID)
+}
+
+func (r *Repository) CreateHouse(ctx context.Context, house models.House) (created models.House, err error) {
+	defer metrics.ObserveQuery("create_house", time.Now(), &err)
+	return r.next.CreateHouse(ctx, house)
+}
+
+func (r *Repository) GetHouseByAddressKey(ctx context.Context, addressKey string) (house models.House, err error) {
+	defer metrics.ObserveQuery("get_house_by_address_key", time.Now(), &err)
+	return r.next.GetHouseByAddressKey(ctx, addressKey)
+}
+
+func (r *Repository) GetHouseUpdatedAt(ctx context.Context, houseID int) (updatedAt string, err error) {
+	defer metrics.ObserveQuery("get_house_updated_at", time.Now(), &err)
+	return r.next.GetHouseUpdatedAt(ctx, houseID)
+}
+
+func (r *Repository) GetHousesNearby(ctx context.Context, lat, lon, radius float64, limit int) (houses []models.NearbyHouse, err error) {
+	defer metrics.ObserveQuery("get_houses_nearby", time.Now(), &err)
+	return r.next.GetHousesNearby(ctx, lat, lon, radius, limit)
+}
+
+func (r *Repository) GetHousesInBox(ctx context.Context, minLat, minLon, maxLat, maxLon, lat, lon float64, limit int) (houses []models.NearbyHouse, err error) {
+	defer metrics.ObserveQuery("get_houses_in_box", time.Now(), &err)
+	return r.next.GetHousesInBox(ctx, minLat, minLon, maxLat, maxLon, lat, lon, limit)
+}
+
+func (r *Repository) StreamHouses(ctx context.Context, box *[4]float64, fn func(models.House) error) (err error) {
+	defer metrics.ObserveQuery("stream_houses", time.Now(), &err)
+	return r.next.StreamHouses(ctx, box, fn)
+}
+
+func (r *Repository) GetFlats(ctx context.Context, houseID int, filter models.FlatFilter) (flats []models.Flat, err error) {
+	defer metrics.ObserveQuery("get_flats", time.Now(), &err)
+	return r.next.GetFlats(ctx, houseID, filter)
+}
+
+func (r *Repository) StreamFlats(ctx context.Context, houseID *int, filter models.FlatFilter, fn func(models.Flat) error) (err error) {
+	defer metrics.ObserveQuery("stream_flats", time.Now(), &err)
+	return r.next.StreamFlats(ctx, houseID, filter, fn)
+}
+
+func (r *Repository) GetFlat(ctx context.Context, flatID int) (flat models.Flat, err error) {
+	defer metrics.ObserveQuery("get_flat", time.Now(), &err)
+	return r.next.GetFlat(ctx, flatID)
+}
+
+func (r *Repository) CreateFlat(ctx context.Context, flat models.Flat) (created models.Flat, err error) {
+	defer metrics.ObserveQuery("create_flat", time.Now(), &err)
+	return r.next.CreateFlat(ctx, flat)
+}
+
+func (r *Repository) CreateFlats(ctx context.Context, houseID int, flats []models.Flat) (created []models.Flat, err error) {
+	defer metrics.ObserveQuery("create_flats", time.Now(), &err)
+	return r.next.CreateFlats(ctx, houseID, flats)
+}
+
+func (r *Repository) UpdateFlat(ctx context.Context, flatID int, status models.FlatStatus, moderatorID uuid.UUID) (flat models.Flat, err error) {
+	defer metrics.ObserveQuery("update_flat", time.Now(), &err)
+	return r.next.UpdateFlat(ctx, flatID, status, moderatorID)
+}
+
+func (r *Repository) UpdateFlatPrice(ctx context.Context, flatID int, price int) (flat models.Flat, oldPrice int, err error) {
+	defer metrics.ObserveQuery("update_flat_price", time.Now(), &err)
+	return r.next.UpdateFlatPrice(ctx, flatID, price)
+}
+
+func (r *Repository) GetFlatPrices(ctx context.Context, flatID int) (prices []models.FlatPrice, err error) {
+	defer metrics.ObserveQuery("get_flat_prices", time.Now(), &err)
+	return r.next.GetFlatPrices(ctx, flatID)
+}
+
+func (r *Repository) GetFlatModerator(ctx context.Context, flatID int) (moderatorID uuid.UUID, err error) {
+	defer metrics.ObserveQuery("get_flat_moderator", time.Now(), &err)
+	return r.next.GetFlatModerator(ctx, flatID)
+}
+
+func (r *Repository) CreateFlatPhoto(ctx context.Context, photo models.FlatPhoto) (created models.FlatPhoto, err error) {
+	defer metrics.ObserveQuery("create_flat_photo", time.Now(), &err)
+	return r.next.CreateFlatPhoto(ctx, photo)
+}
+
+func (r *Repository) GetHousePhotos(ctx context.Context, houseID int) (photos []models.FlatPhoto, err error) {
+	defer metrics.ObserveQuery("get_house_photos", time.Now(), &err)
+	return r.next.GetHousePhotos(ctx, houseID)
+}
+
+func (r *Repository) SubscribeToNewFlats(ctx context.Context, houseID int, email string) (err error) {
+	defer metrics.ObserveQuery("subscribe_to_new_flats", time.Now(), &err)
+	return r.next.SubscribeToNewFlats(ctx, houseID, email)
+}
+
+func (r *Repository) GetSubscribers(ctx context.Context, houseID int) (subscribers []string, err error) {
+	defer metrics.ObserveQuery("get_subscribers", time.Now(), &err)
+	return r.next.GetSubscribers(ctx, houseID)
+}
+
+func (r *Repository) GetStats(ctx context.Context) (stats models.Stats, err error) {
+	defer metrics.ObserveQuery("get_stats", time.Now(), &err)
+	return r.next.GetStats(ctx)
+}
@@ -0,0 +1,486 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// earthRadius совпадает с радиусом Земли в расширении earthdistance, чтобы расстояния совпадали с Postgres.
+const earthRadius = 6378168
+
+type flatRecord struct {
+	flat        models.Flat // ID - номер квартиры в доме, как в Postgres
+	moderatorID uuid.UUID
+}
+
+// Repository - хранилище в памяти с той же семантикой, что и repository.Repository.
+// Подходит для тестов и локального запуска без базы данных.
+type Repository struct {
+	mu sync.Mutex
+
+	users map[uuid.UUID]models.User
+
+	houses         map[int]models.House
+	housesByKey    map[string]int
+	lastHouseID    int
+	lastFlatNumber map[int]int // по ID дома
+
+	flats       map[int]*flatRecord // по сквозному ID квартиры
+	lastFlatID  int
+	prices      map[int][]models.FlatPrice
+	photos      []models.FlatPhoto
+	lastPhotoID int
+
+	subscriptions map[int][]string
+}
+
+func NewRepository() *Repository {
+	return &Repository{
+		users:          make(map[uuid.UUID]models.User),
+		houses:         make(map[int]models.House),
+		housesByKey:    make(map[string]int),
+		lastFlatNumber: make(map[int]int),
+		flats:          make(map[int]*flatRecord),
+		prices:         make(map[int][]models.FlatPrice),
+		subscriptions:  make(map[int][]string),
+	}
+}
+
+func (r *Repository) CreateUser(ctx context.Context, email, passwordHash string, userType models.UserType) (uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user := models.User{ID: uuid.New(), Email: email, PasswordHash: passwordHash, UserType: userType}
+	r.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+func (r *Repository) GetUser(ctx context.Context, userID uuid.UUID) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+func (r *Repository) CreateHouse(ctx context.Context, house models.House) (models.House, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if house.AddressKey != nil {
+		if _, ok := r.housesByKey[*house.AddressKey]; ok {
+			return models.House{}, repository.ErrAlreadyExists
+		}
+	}
+
+	r.lastHouseID++
+	house.ID = r.lastHouseID
+	house.CreatedAt = now()
+	house.UpdatedAt = house.CreatedAt
+	house.Latitude = copyFloat(house.Latitude)
+	house.Longitude = copyFloat(house.Longitude)
+	if house.AddressKey != nil {
+		key := *house.AddressKey
+		house.AddressKey = &key
+		r.housesByKey[key] = house.ID
+	}
+
+	r.houses[house.ID] = house
+
+	return house, nil
+}
+
+func (r *Repository) GetHouseByAddressKey(ctx context.Context, addressKey string) (models.House, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, ok := r.housesByKey[addressKey]
+	if !ok {
+		return models.House{}, sql.ErrNoRows
+	}
+
+	return r.houses[id], nil
+}
+
+func (r *Repository) GetHouseUpdatedAt(ctx context.Context, houseID int) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	house, ok := r.houses[houseID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+
+	return house.UpdatedAt, nil
+}
+
+func (r *Repository) GetHousesNearby(ctx context.Context, lat, lon, radius float64, limit int) ([]models.NearbyHouse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	houses := []models.NearbyHouse{}
+	for _, house := range r.houses {
+		if house.Latitude == nil || house.Longitude == nil {
+			continue
+		}
+
+		if distance := greatCircleDistance(lat, lon, *house.Latitude, *house.Longitude); distance <= radius {
+			houses = append(houses, models.NearbyHouse{House: house, Distance: distance})
+		}
+	}
+
+	return sortByDistance(houses, limit), nil
+}
+
+func (r *Repository) GetHousesInBox(ctx context.Context, minLat, minLon, maxLat, maxLon, lat, lon float64, limit int) ([]models.NearbyHouse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	houses := []models.NearbyHouse{}
+	for _, house := range r.houses {
+		if !inBox(house, &[4]float64{minLat, minLon, maxLat, maxLon}) {
+			continue
+		}
+
+		houses = append(houses, models.NearbyHouse{House: house, Distance: greatCircleDistance(lat, lon, *house.Latitude, *house.Longitude)})
+	}
+
+	return sortByDistance(houses, limit), nil
+}
+
+func (r *Repository) StreamHouses(ctx context.Context, box *[4]float64, fn func(models.House) error) error {
+	r.mu.Lock()
+	houses := make([]models.House, 0, len(r.houses))
+	for _, house := range r.houses {
+		if box == nil || inBox(house, box) {
+			houses = append(houses, house)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Slice(houses, func(i, j int) bool { return houses[i].ID < houses[j].ID })
+
+	for _, house := range houses {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(house); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Repository) GetFlats(ctx context.Context, houseID int, filter models.FlatFilter) ([]models.Flat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.selectFlats(&houseID, filter), nil
+}
+
+func (r *Repository) StreamFlats(ctx context.Context, houseID *int, filter models.FlatFilter, fn func(models.Flat) error) error {
+	r.mu.Lock()
+	flats := r.selectFlats(houseID, filter)
+	r.mu.Unlock()
+
+	for _, flat := range flats {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(flat); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Repository) GetFlat(ctx context.Context, flatID int) (models.Flat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.flats[flatID]
+	if !ok {
+		return models.Flat{}, sql.ErrNoRows
+	}
+
+	return copyFlat(record.flat), nil
+}
+
+func (r *Repository) CreateFlat(ctx context.Context, flat models.Flat) (models.Flat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.houses[flat.HouseID]; !ok {
+		return models.Flat{}, sql.ErrNoRows
+	}
+
+	return r.insertFlat(flat.HouseID, flat), nil
+}
+
+func (r *Repository) CreateFlats(ctx context.Context, houseID int, flats []models.Flat) ([]models.Flat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.houses[houseID]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	created := make([]models.Flat, 0, len(flats))
+	for _, flat := range flats {
+		created = append(created, r.insertFlat(houseID, flat))
+	}
+
+	return created, nil
+}
+
+func (r *Repository) UpdateFlat(ctx context.Context, flatID int, status models.FlatStatus, moderatorID uuid.UUID) (models.Flat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.flats[flatID]
+	if !ok {
+		return models.Flat{}, sql.ErrNoRows
+	}
+
+	record.flat.Status = status
+	record.moderatorID = uuid.Nil
+	if _, ok := r.users[moderatorID]; ok && status == models.FlatStatusOnModeration {
+		record.moderatorID = moderatorID
+	}
+	r.touchHouse(record.flat.HouseID)
+
+	return copyFlat(record.flat), nil
+}
+
+func (r *Repository) UpdateFlatPrice(ctx context.Context, flatID int, price int) (models.Flat, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.flats[flatID]
+	if !ok {
+		return models.Flat{}, 0, sql.ErrNoRows
+	}
+
+	oldPrice := record.flat.Price
+	record.flat.Price = price
+
+	if price != oldPrice {
+		r.prices[flatID] = append(r.prices[flatID], models.FlatPrice{Price: price, ChangedAt: now()})
+		r.touchHouse(record.flat.HouseID)
+	}
+
+	return copyFlat(record.flat), oldPrice, nil
+}
+
+func (r *Repository) GetFlatPrices(ctx context.Context, flatID int) ([]models.FlatPrice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]models.FlatPrice{}, r.prices[flatID]...), nil
+}
+
+func (r *Repository) GetFlatModerator(ctx context.Context, flatID int) (uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.flats[flatID]
+	if !ok {
+		return uuid.Nil, sql.ErrNoRows
+	}
+
+	return record.moderatorID, nil
+}
+
+func (r *Repository) CreateFlatPhoto(ctx context.Context, photo models.FlatPhoto) (models.FlatPhoto, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.flats[photo.FlatID]
+	if !ok {
+		return models.FlatPhoto{}, sql.ErrNoRows
+	}
+
+	r.lastPhotoID++
+	photo.ID = r.lastPhotoID
+	photo.CreatedAt = now()
+	r.photos = append(r.photos, photo)
+	r.touchHouse(record.flat.HouseID)
+
+	return photo, nil
+}
+
+func (r *Repository) GetHousePhotos(ctx context.Context, houseID int) ([]models.FlatPhoto, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var photos []models.FlatPhoto
+	for _, photo := range r.photos {
+		if record := r.flats[photo.FlatID]; record.flat.HouseID == houseID {
+			photo.FlatNumber = record.flat.ID
+			photos = append(photos, photo)
+		}
+	}
+
+	return photos, nil
+}
+
+func (r *Repository) SubscribeToNewFlats(ctx context.Context, houseID int, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.houses[houseID]; !ok {
+		return sql.ErrNoRows
+	}
+
+	for _, subscriber := range r.subscriptions[houseID] {
+		if subscriber == email {
+			return repository.ErrAlreadyExists
+		}
+	}
+
+	r.subscriptions[houseID] = append(r.subscriptions[houseID], email)
+
+	return nil
+}
+
+func (r *Repository) GetSubscribers(ctx context.Context, houseID int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.subscriptions[houseID]...), nil
+}
+
+func (r *Repository) GetStats(ctx context.Context) (models.Stats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := models.Stats{Houses: len(r.houses), FlatsByStatus: make(map[models.FlatStatus]int)}
+	for _, record := range r.flats {
+		stats.FlatsByStatus[record.flat.Status]++
+	}
+
+	return stats, nil
+}
+
+// insertFlat вызывается под r.mu, поэтому номера в доме выдаются без гонок.
+func (r *Repository) insertFlat(houseID int, flat models.Flat) models.Flat {
+	r.lastFlatID++
+	r.lastFlatNumber[houseID]++
+
+	flat.ID = r.lastFlatNumber[houseID]
+	flat.HouseID = houseID
+	flat.Status = models.FlatStatusCreated
+	flat.PricePerSquareMeter = 0
+	flat.UploadedPhotos = nil
+	flat = copyFlat(flat)
+
+	r.flats[r.lastFlatID] = &flatRecord{flat: flat}
+	r.prices[r.lastFlatID] = []models.FlatPrice{{Price: flat.Price, ChangedAt: now()}}
+	r.touchHouse(houseID)
+
+	// как и в Postgres, при создании возвращается сквозной ID квартиры
+	created := copyFlat(flat)
+	created.ID = r.lastFlatID
+
+	return created
+}
+
+// selectFlats вызывается под r.mu.
+func (r *Repository) selectFlats(houseID *int, filter models.FlatFilter) []models.Flat {
+	var flats []models.Flat
+	for _, record := range r.flats {
+		flat := record.flat
+		if (houseID != nil && flat.HouseID != *houseID) || !filter.Match(flat) {
+			continue
+		}
+
+		flats = append(flats, copyFlat(flat))
+	}
+
+	sort.Slice(flats, func(i, j int) bool {
+		if flats[i].HouseID != flats[j].HouseID {
+			return flats[i].HouseID < flats[j].HouseID
+		}
+		return flats[i].ID < flats[j].ID
+	})
+
+	return flats
+}
+
+// touchHouse вызывается под r.mu.
+func (r *Repository) touchHouse(houseID int) {
+	house := r.houses[houseID]
+	house.UpdatedAt = now()
+	r.houses[houseID] = house
+}
+
+// inBox проверяет попадание дома в прямоугольник. Если box[1] > box[3], прямоугольник пересекает
+// 180-й меридиан и долгота проверяется по двум диапазонам.
+func inBox(house models.House, box *[4]float64) bool {
+	if house.Latitude == nil || house.Longitude == nil || *house.Latitude < box[0] || *house.Latitude > box[2] {
+		return false
+	}
+
+	if box[1] > box[3] {
+		return *house.Longitude >= box[1] || *house.Longitude <= box[3]
+	}
+	return *house.Longitude >= box[1] && *house.Longitude <= box[3]
+}
+
+func sortByDistance(houses []models.NearbyHouse, limit int) []models.NearbyHouse {
+	sort.Slice(houses, func(i, j int) bool { return houses[i].Distance < houses[j].Distance })
+
+	if len(houses) > limit {
+		houses = houses[:limit]
+	}
+
+	return houses
+}
+
+// greatCircleDistance - расстояние по поверхности сферы в метрах (формула гаверсинусов).
+func greatCircleDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func copyFlat(flat models.Flat) models.Flat {
+	photos := pq.StringArray{}
+	flat.Photos = append(photos, flat.Photos...)
+	return flat
+}
+
+func copyFloat(value *float64) *float64 {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+// now форматирует время так же, как database/sql при чтении TIMESTAMP в строку.
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
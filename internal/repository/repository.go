@@ -1,52 +1,152 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Vykiy/house-service/internal/models"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+var ErrAlreadyExists = errors.New("запись уже существует")
+
+const houseColumns = "id, address, city, street, building, postal_code, latitude, longitude, address_key, year_built, developer, created_at, updated_at"
+
+// boxCondition - попадание дома в прямоугольник ($1, $2) - ($3, $4). Если $2 > $4, прямоугольник
+// пересекает 180-й меридиан и долгота проверяется по двум диапазонам.
+const boxCondition = "latitude BETWEEN $1 AND $3 AND (longitude BETWEEN $2 AND $4 OR ($2 > $4 AND (longitude >= $2 OR longitude <= $4)))"
+
 type Repository struct {
-	db *sqlx.DB
+	db           *sqlx.DB
+	queryTimeout time.Duration
 }
 
-func NewRepository(db *sqlx.DB) *Repository {
-	return &Repository{db: db}
+// NewRepository создает репозиторий. queryTimeout ограничивает время каждой операции,
+// кроме потоковых выгрузок; 0 - без ограничения.
+func NewRepository(db *sqlx.DB, queryTimeout time.Duration) *Repository {
+	return &Repository{db: db, queryTimeout: queryTimeout}
+}
+
+func (r *Repository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, r.queryTimeout)
 }
 
-func (r *Repository) CreateUser(email, passwordHash string, userType models.UserType) (uuid.UUID, error) {
+func (r *Repository) CreateUser(ctx context.Context, email, passwordHash string, userType models.UserType) (uuid.UUID, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	var userID uuid.UUID
-	if err := r.db.QueryRow("INSERT INTO users (email, password_hash, user_type) VALUES ($1, $2, $3) RETURNING id", email, passwordHash, userType).Scan(&userID); err != nil {
+	if err := r.db.QueryRowContext(ctx, "INSERT INTO users (email, password_hash, user_type) VALUES ($1, $2, $3) RETURNING id", email, passwordHash, userType).Scan(&userID); err != nil {
 		return uuid.Nil, err
 	}
 
 	return userID, nil
 }
 
-func (r *Repository) GetUser(userID uuid.UUID) (models.User, error) {
+func (r *Repository) GetUser(ctx context.Context, userID uuid.UUID) (models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	var user models.User
-	if err := r.db.Get(&user, "SELECT id, email, password_hash, user_type FROM users WHERE id = $1", userID); err != nil {
+	if err := r.db.GetContext(ctx, &user, "SELECT id, email, password_hash, user_type FROM users WHERE id = $1", userID); err != nil {
 		return models.User{}, err
 	}
 
 	return user, nil
 }
 
-func (r *Repository) CreateHouse(address, developer string, yearBuilt int) (models.House, error) {
+func (r *Repository) CreateHouse(ctx context.Context, house models.House) (models.House, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var created models.House
+	if err := r.db.GetContext(ctx, &created, "INSERT INTO houses (address, city, street, building, postal_code, latitude, longitude, address_key, developer, year_built) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING "+houseColumns,
+		house.Address, house.City, house.Street, house.Building, house.PostalCode, house.Latitude, house.Longitude, house.AddressKey, house.Developer, house.YearBuilt); err != nil {
+		if isUniqueViolation(err) {
+			return models.House{}, ErrAlreadyExists
+		}
+		return models.House{}, err
+	}
+
+	return created, nil
+}
+
+func (r *Repository) GetHouseByAddressKey(ctx context.Context, addressKey string) (models.House, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	var house models.House
-	if err := r.db.QueryRow("INSERT INTO houses (address, developer, year_built) VALUES ($1, $2, $3) RETURNING address, developer, year_built, id, created_at, updated_at",
-		address, developer, yearBuilt).Scan(&house.Address, &house.Developer, &house.YearBuilt, &house.ID, &house.CreatedAt, &house.UpdatedAt); err != nil {
+	if err := r.db.GetContext(ctx, &house, "SELECT "+houseColumns+" FROM houses WHERE address_key = $1", addressKey); err != nil {
 		return models.House{}, err
 	}
 
 	return house, nil
 }
 
-func (r *Repository) GetFlats(houseID int) ([]models.Flat, error) {
+func (r *Repository) GetHouseUpdatedAt(ctx context.Context, houseID int) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var updatedAt string
+	if err := r.db.GetContext(ctx, &updatedAt, "SELECT updated_at FROM houses WHERE id = $1", houseID); err != nil {
+		return "", err
+	}
+
+	return updatedAt, nil
+}
+
+func (r *Repository) GetHousesNearby(ctx context.Context, lat, lon, radius float64, limit int) ([]models.NearbyHouse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	houses := []models.NearbyHouse{}
+	// earth_box отбирает кандидатов по GiST-индексу, earth_distance отсекает углы куба
+	if err := r.db.SelectContext(ctx, &houses, `SELECT `+houseColumns+`, earth_distance(ll_to_earth($1, $2), ll_to_earth(latitude, longitude)) AS distance
+		FROM houses
+		WHERE latitude IS NOT NULL AND longitude IS NOT NULL
+			AND earth_box(ll_to_earth($1, $2), $3) @> ll_to_earth(latitude, longitude)
+			AND earth_distance(ll_to_earth($1, $2), ll_to_earth(latitude, longitude)) <= $3
+		ORDER BY distance
+		LIMIT $4`, lat, lon, radius, limit); err != nil {
+		return nil, err
+	}
+
+	return houses, nil
+}
+
+func (r *Repository) GetHousesInBox(ctx context.Context, minLat, minLon, maxLat, maxLon, lat, lon float64, limit int) ([]models.NearbyHouse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	houses := []models.NearbyHouse{}
+	if err := r.db.SelectContext(ctx, &houses, `SELECT `+houseColumns+`, earth_distance(ll_to_earth($5, $6), ll_to_earth(latitude, longitude)) AS distance
+		FROM houses
+		WHERE `+boxCondition+`
+		ORDER BY distance
+		LIMIT $7`, minLat, minLon, maxLat, maxLon, lat, lon, limit); err != nil {
+		return nil, err
+	}
+
+	return houses, nil
+}
+
+func (r *Repository) GetFlats(ctx context.Context, houseID int, filter models.FlatFilter) ([]models.Flat, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query, args := flatsQuery(&houseID, filter)
+
 	var flats []models.Flat
-	if err := r.db.Select(&flats, "SELECT flat_number, house_id, price, rooms FROM flats WHERE house_id = $1", houseID); err != nil {
+	if err := r.db.SelectContext(ctx, &flats, query+" ORDER BY flat_number", args...); err != nil {
 		return nil, err
 	}
 
@@ -54,27 +154,157 @@ func (r *Repository) GetFlats(houseID int) ([]models.Flat, error) {
 
 }
 
-func (r *Repository) CreateFlat(houseID int, price, rooms int) (models.Flat, error) {
-	var flat models.Flat
+// StreamFlats построчно передает квартиры в fn, не загружая всю выборку в память.
+// houseID == nil означает квартиры всех домов.
+func (r *Repository) StreamFlats(ctx context.Context, houseID *int, filter models.FlatFilter, fn func(models.Flat) error) error {
+	query, args := flatsQuery(houseID, filter)
+
+	rows, err := r.db.QueryxContext(ctx, query+" ORDER BY house_id, flat_number", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var flat models.Flat
+		if err := rows.StructScan(&flat); err != nil {
+			return err
+		}
+
+		if err := fn(flat); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// StreamHouses построчно передает дома в fn. box == nil означает все дома,
+// иначе [minLat, minLon, maxLat, maxLon].
+func (r *Repository) StreamHouses(ctx context.Context, box *[4]float64, fn func(models.House) error) error {
+	query := "SELECT " + houseColumns + " FROM houses"
+	var args []interface{}
+	if box != nil {
+		query += " WHERE " + boxCondition
+		args = []interface{}{box[0], box[1], box[2], box[3]}
+	}
+
+	rows, err := r.db.QueryxContext(ctx, query+" ORDER BY id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-	tx, err := r.db.Begin()
+	for rows.Next() {
+		var house models.House
+		if err := rows.StructScan(&house); err != nil {
+			return err
+		}
+
+		if err := fn(house); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func flatsQuery(houseID *int, filter models.FlatFilter) (string, []interface{}) {
+	query := "SELECT flat_number, house_id, price, rooms, status, area, floor, description, photos FROM flats WHERE TRUE"
+	var args []interface{}
+
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		query += fmt.Sprintf(" AND %s $%d", condition, len(args))
+	}
+
+	if houseID != nil {
+		addCondition("house_id =", *houseID)
+	}
+	if filter.MinPrice != nil {
+		addCondition("price >=", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		addCondition("price <=", *filter.MaxPrice)
+	}
+	if filter.MinArea != nil {
+		addCondition("area >=", *filter.MinArea)
+	}
+	if filter.MaxArea != nil {
+		addCondition("area <=", *filter.MaxArea)
+	}
+	if filter.Status != nil {
+		addCondition("status =", *filter.Status)
+	}
+
+	return query, args
+}
+
+func (r *Repository) CreateFlat(ctx context.Context, flat models.Flat) (models.Flat, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var created models.Flat
+
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return models.Flat{}, err
 	}
 
-	var lastFlatNumber int
-	if err := tx.QueryRow("SELECT flat_number FROM flats WHERE house_id = $1 ORDER BY flat_number DESC LIMIT 1", houseID).Scan(&lastFlatNumber); err != nil && err != sql.ErrNoRows {
+	lastFlatNumber, err := lockLastFlatNumber(ctx, tx, flat.HouseID)
+	if err != nil {
 		tx.Rollback()
 		return models.Flat{}, err
 	}
 
-	if err := tx.QueryRow("INSERT INTO flats (house_id, price, rooms, flat_number, status) VALUES ($1, $2, $3, $4, $5) RETURNING id, house_id, price, rooms",
-		houseID, price, rooms, lastFlatNumber+1, models.FlatStatusCreated).Scan(&flat.ID, &flat.HouseID, &flat.Price, &flat.Rooms); err != nil {
+	if flat.Photos == nil {
+		flat.Photos = pq.StringArray{}
+	}
+
+	if err := tx.QueryRowContext(ctx, "INSERT INTO flats (house_id, price, rooms, flat_number, status, area, floor, description, photos) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, house_id, price, rooms, status, area, floor, description, photos",
+		flat.HouseID, flat.Price, flat.Rooms, lastFlatNumber+1, models.FlatStatusCreated, flat.Area, flat.Floor, flat.Description, flat.Photos).Scan(&created.ID, &created.HouseID, &created.Price, &created.Rooms, &created.Status, &created.Area, &created.Floor, &created.Description, &created.Photos); err != nil {
 		tx.Rollback()
 		return models.Flat{}, err
 	}
 
-	if _, err := tx.Exec("UPDATE houses SET updated_at = NOW() WHERE id = $1", flat.HouseID); err != nil {
+	if _, err := tx.ExecContext(ctx, "INSERT INTO flat_price_history (flat_id, price) VALUES ($1, $2)", created.ID, created.Price); err != nil {
+		tx.Rollback()
+		return models.Flat{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE houses SET updated_at = NOW() WHERE id = $1", created.HouseID); err != nil {
+		tx.Rollback()
+		return models.Flat{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return models.Flat{}, err
+	}
+
+	return created, nil
+}
+
+func (r *Repository) UpdateFlat(ctx context.Context, flatID int, status models.FlatStatus, moderatorID uuid.UUID) (models.Flat, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Flat{}, err
+	}
+
+	var flat models.Flat
+
+	// moderator_id ссылается на users: модераторы без учетной записи (dummyLogin) квартиру не закрепляют
+	if err := tx.QueryRowContext(ctx, "UPDATE flats SET status = $1, moderator_id = (SELECT id FROM users WHERE id = $3) WHERE id = $2 RETURNING flat_number, house_id, price, rooms, status, area, floor, description, photos",
+		status, flatID, flatModerator(status, moderatorID)).Scan(&flat.ID, &flat.HouseID, &flat.Price, &flat.Rooms, &flat.Status, &flat.Area, &flat.Floor, &flat.Description, &flat.Photos); err != nil {
+		tx.Rollback()
+		return models.Flat{}, err
+	}
+
+	// по времени изменения дома другие реплики узнают, что их кеш квартир устарел
+	if _, err := tx.ExecContext(ctx, "UPDATE houses SET updated_at = NOW() WHERE id = $1", flat.HouseID); err != nil {
 		tx.Rollback()
 		return models.Flat{}, err
 	}
@@ -87,39 +317,271 @@ func (r *Repository) CreateFlat(houseID int, price, rooms int) (models.Flat, err
 	return flat, nil
 }
 
-func (r *Repository) UpdateFlat(flatID int, status models.FlatStatus) (models.Flat, error) {
+// CreateFlats создает квартиры дома в одной транзакции: либо все, либо ни одной.
+// Номера присваиваются по порядку после последнего существующего, как в CreateFlat.
+func (r *Repository) CreateFlats(ctx context.Context, houseID int, flats []models.Flat) ([]models.Flat, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	lastFlatNumber, err := lockLastFlatNumber(ctx, tx, houseID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	created := make([]models.Flat, 0, len(flats))
+	for i, flat := range flats {
+		if flat.Photos == nil {
+			flat.Photos = pq.StringArray{}
+		}
+
+		var createdFlat models.Flat
+		if err := tx.QueryRowContext(ctx, "INSERT INTO flats (house_id, price, rooms, flat_number, status, area, floor, description, photos) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, house_id, price, rooms, status, area, floor, description, photos",
+			houseID, flat.Price, flat.Rooms, lastFlatNumber+i+1, models.FlatStatusCreated, flat.Area, flat.Floor, flat.Description, flat.Photos).Scan(&createdFlat.ID, &createdFlat.HouseID, &createdFlat.Price, &createdFlat.Rooms, &createdFlat.Status, &createdFlat.Area, &createdFlat.Floor, &createdFlat.Description, &createdFlat.Photos); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO flat_price_history (flat_id, price) VALUES ($1, $2)", createdFlat.ID, createdFlat.Price); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		created = append(created, createdFlat)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE houses SET updated_at = NOW() WHERE id = $1", houseID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// UpdateFlatPrice меняет цену квартиры и записывает изменение в историю. Возвращает прежнюю цену.
+func (r *Repository) UpdateFlatPrice(ctx context.Context, flatID int, price int) (models.Flat, int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Flat{}, 0, err
+	}
+
+	var oldPrice int
+	if err := tx.QueryRowContext(ctx, "SELECT price FROM flats WHERE id = $1 FOR UPDATE", flatID).Scan(&oldPrice); err != nil {
+		tx.Rollback()
+		return models.Flat{}, 0, err
+	}
+
 	var flat models.Flat
+	if err := tx.QueryRowContext(ctx, "UPDATE flats SET price = $1 WHERE id = $2 RETURNING flat_number, house_id, price, rooms, status, area, floor, description, photos",
+		price, flatID).Scan(&flat.ID, &flat.HouseID, &flat.Price, &flat.Rooms, &flat.Status, &flat.Area, &flat.Floor, &flat.Description, &flat.Photos); err != nil {
+		tx.Rollback()
+		return models.Flat{}, 0, err
+	}
 
-	if err := r.db.QueryRow("UPDATE flats SET status = $1 WHERE id = $2 RETURNING flat_number, house_id, price, rooms, status",
-		status, flatID).Scan(&flat.ID, &flat.HouseID, &flat.Price, &flat.Rooms, &flat.Status); err != nil {
+	if price != oldPrice {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO flat_price_history (flat_id, price) VALUES ($1, $2)", flatID, price); err != nil {
+			tx.Rollback()
+			return models.Flat{}, 0, err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE houses SET updated_at = NOW() WHERE id = $1", flat.HouseID); err != nil {
+			tx.Rollback()
+			return models.Flat{}, 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return models.Flat{}, 0, err
+	}
+
+	return flat, oldPrice, nil
+}
+
+func (r *Repository) GetFlatPrices(ctx context.Context, flatID int) ([]models.FlatPrice, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	prices := []models.FlatPrice{}
+	if err := r.db.SelectContext(ctx, &prices, "SELECT price, changed_at FROM flat_price_history WHERE flat_id = $1 ORDER BY changed_at, id", flatID); err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+func (r *Repository) GetFlat(ctx context.Context, flatID int) (models.Flat, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var flat models.Flat
+	if err := r.db.GetContext(ctx, &flat, "SELECT flat_number, house_id, price, rooms, status, area, floor, description, photos FROM flats WHERE id = $1", flatID); err != nil {
 		return models.Flat{}, err
 	}
 
 	return flat, nil
 }
 
-func (r *Repository) GetFlatModerator(flatID int) (uuid.UUID, error) {
+func (r *Repository) CreateFlatPhoto(ctx context.Context, photo models.FlatPhoto) (models.FlatPhoto, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.FlatPhoto{}, err
+	}
+
+	if err := tx.QueryRowContext(ctx, "INSERT INTO flat_photos (flat_id, storage_key, thumbnail_key, content_type, size, width, height) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at",
+		photo.FlatID, photo.Key, photo.ThumbnailKey, photo.ContentType, photo.Size, photo.Width, photo.Height).Scan(&photo.ID, &photo.CreatedAt); err != nil {
+		tx.Rollback()
+		if isForeignKeyViolation(err) {
+			return models.FlatPhoto{}, sql.ErrNoRows
+		}
+		return models.FlatPhoto{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE houses SET updated_at = NOW() WHERE id = (SELECT house_id FROM flats WHERE id = $1)", photo.FlatID); err != nil {
+		tx.Rollback()
+		return models.FlatPhoto{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return models.FlatPhoto{}, err
+	}
+
+	return photo, nil
+}
+
+func (r *Repository) GetHousePhotos(ctx context.Context, houseID int) ([]models.FlatPhoto, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var photos []models.FlatPhoto
+	if err := r.db.SelectContext(ctx, &photos, `SELECT p.id, p.flat_id, f.flat_number, p.storage_key, p.thumbnail_key, p.content_type, p.size, p.width, p.height, p.created_at
+		FROM flat_photos p JOIN flats f ON f.id = p.flat_id
+		WHERE f.house_id = $1
+		ORDER BY p.id`, houseID); err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
+
+func (r *Repository) GetFlatModerator(ctx context.Context, flatID int) (uuid.UUID, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	var moderatorID uuid.UUID
-	if err := r.db.QueryRow("SELECT moderator_id FROM flats WHERE id = $1", flatID).Scan(&moderatorID); err != nil {
+	if err := r.db.QueryRowContext(ctx, "SELECT moderator_id FROM flats WHERE id = $1", flatID).Scan(&moderatorID); err != nil {
 		return uuid.Nil, err
 	}
 
 	return moderatorID, nil
 }
 
-func (r *Repository) SubscribeToNewFlats(houseID int, email string) error {
-	if _, err := r.db.Exec("INSERT INTO subscriptions (house_id, email) VALUES ($1, $2)", houseID, email); err != nil {
+func (r *Repository) SubscribeToNewFlats(ctx context.Context, houseID int, email string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, "INSERT INTO subscriptions (house_id, email) VALUES ($1, $2)", houseID, email); err != nil {
+		if isUniqueViolation(err) {
+			return ErrAlreadyExists
+		} else if isForeignKeyViolation(err) {
+			return sql.ErrNoRows
+		}
 		return err
 	}
 
 	return nil
 }
 
-func (r *Repository) GetSubscribers(houseID int) ([]string, error) {
+func (r *Repository) GetSubscribers(ctx context.Context, houseID int) ([]string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	var subscribers []string
-	if err := r.db.Select(&subscribers, "SELECT email FROM subscriptions WHERE house_id = $1", houseID); err != nil {
+	if err := r.db.SelectContext(ctx, &subscribers, "SELECT email FROM subscriptions WHERE house_id = $1", houseID); err != nil {
 		return nil, err
 	}
 
 	return subscribers, nil
 }
+
+// GetStats считает дома и квартиры по статусам.
+func (r *Repository) GetStats(ctx context.Context) (models.Stats, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	stats := models.Stats{FlatsByStatus: make(map[models.FlatStatus]int)}
+	if err := r.db.GetContext(ctx, &stats.Houses, "SELECT COUNT(*) FROM houses"); err != nil {
+		return models.Stats{}, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT status, COUNT(*) FROM flats GROUP BY status")
+	if err != nil {
+		return models.Stats{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status models.FlatStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return models.Stats{}, err
+		}
+
+		stats.FlatsByStatus[status] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return models.Stats{}, err
+	}
+
+	return stats, nil
+}
+
+// lockLastFlatNumber блокирует строку дома до конца транзакции и возвращает последний номер квартиры в нем.
+// Блокировка сериализует создание квартир в одном доме, иначе параллельные транзакции
+// прочитают один и тот же номер и столкнутся на unique_flat_number. Если дома нет, возвращает sql.ErrNoRows.
+func lockLastFlatNumber(ctx context.Context, tx *sql.Tx, houseID int) (int, error) {
+	var id int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM houses WHERE id = $1 FOR UPDATE", houseID).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	var lastFlatNumber int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(flat_number), 0) FROM flats WHERE house_id = $1", houseID).Scan(&lastFlatNumber); err != nil {
+		return 0, err
+	}
+
+	return lastFlatNumber, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// flatModerator возвращает модератора, за которым закрепляется квартира с новым статусом.
+func flatModerator(status models.FlatStatus, moderatorID uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: moderatorID, Valid: status == models.FlatStatusOnModeration && moderatorID != uuid.Nil}
+}
@@ -0,0 +1,516 @@
+// Package repotest содержит общий набор тестов, которому должна соответствовать любая реализация app.Repository.
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Run запускает набор тестов. Тесты не рассчитывают на пустое хранилище,
+// поэтому подходят и для общей тестовой базы.
+func Run(t *testing.T, repo app.Repository) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, repo) })
+	t.Run("Houses", func(t *testing.T) { testHouses(t, repo) })
+	t.Run("Geo", func(t *testing.T) { testGeo(t, repo) })
+	t.Run("Flats", func(t *testing.T) { testFlats(t, repo) })
+	t.Run("FlatNumbering", func(t *testing.T) { testFlatNumbering(t, repo) })
+	t.Run("Prices", func(t *testing.T) { testPrices(t, repo) })
+	t.Run("Photos", func(t *testing.T) { testPhotos(t, repo) })
+	t.Run("Subscriptions", func(t *testing.T) { testSubscriptions(t, repo) })
+	t.Run("Stats", func(t *testing.T) { testStats(t, repo) })
+}
+
+func testUsers(t *testing.T, repo app.Repository) {
+	ctx := context.Background()
+
+	userID, err := repo.CreateUser(ctx, "user@example.com", "hash", models.UserTypeModerator)
+	if err != nil {
+		t.Fatalf("ошибка создания пользователя: %v", err)
+	}
+
+	user, err := repo.GetUser(ctx, userID)
+	if err != nil {
+		t.Fatalf("ошибка получения пользователя: %v", err)
+	}
+
+	if user.ID != userID || user.PasswordHash != "hash" || user.UserType != models.UserTypeModerator {
+		t.Fatalf("неверный пользователь: %+v", user)
+	}
+
+	if _, err := repo.GetUser(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ожидалась sql.ErrNoRows для несуществующего пользователя: %v", err)
+	}
+}
+
+func testHouses(t *testing.T, repo app.Repository) {
+	ctx := context.Background()
+
+	key := "repotest " + uuid.NewString()
+	house, err := repo.CreateHouse(ctx, models.House{Address: key, City: "city", AddressKey: &key, Developer: "dev", YearBuilt: 2000})
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+
+	if house.ID == 0 || house.Address != key || house.City != "city" || house.YearBuilt != 2000 || house.CreatedAt == "" {
+		t.Fatalf("неверный дом: %+v", house)
+	}
+
+	found, err := repo.GetHouseByAddressKey(ctx, key)
+	if err != nil {
+		t.Fatalf("ошибка поиска дома по адресу: %v", err)
+	} else if found.ID != house.ID {
+		t.Fatalf("найден не тот дом")
+	}
+
+	if _, err := repo.CreateHouse(ctx, models.House{Address: key, AddressKey: &key}); !errors.Is(err, repository.ErrAlreadyExists) {
+		t.Fatalf("ожидалась repository.ErrAlreadyExists для дубликата: %v", err)
+	}
+
+	if _, err := repo.GetHouseByAddressKey(ctx, "repotest "+uuid.NewString()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ожидалась sql.ErrNoRows для неизвестного адреса: %v", err)
+	}
+}
+
+func testGeo(t *testing.T, repo app.Repository) {
+	ctx := context.Background()
+
+	// случайная точка, чтобы не пересекаться с данными других тестов
+	lat := rand.Float64()*100 - 50
+	lon := rand.Float64()*300 - 150
+
+	ids := make([]int, 3)
+	for i, offset := range []float64{0.05, 0, 0.005} {
+		houseLat, houseLon := lat+offset, lon
+		house := createHouse(t, repo, models.House{Latitude: &houseLat, Longitude: &houseLon})
+		ids[i] = house.ID
+	}
+
+	houses, err := repo.GetHousesNearby(ctx, lat, lon, 1000, 10)
+	if err != nil {
+		t.Fatalf("ошибка поиска домов в радиусе: %v", err)
+	}
+
+	if len(houses) != 2 || houses[0].ID != ids[1] || houses[1].ID != ids[2] {
+		t.Fatalf("неверные дома в радиусе: %+v", houses)
+	} else if houses[1].Distance < 500 || houses[1].Distance > 600 {
+		t.Fatalf("неверное расстояние: %f", houses[1].Distance)
+	}
+
+	houses, err = repo.GetHousesInBox(ctx, lat-0.01, lon-0.01, lat+0.1, lon+0.01, lat+0.1, lon, 2)
+	if err != nil {
+		t.Fatalf("ошибка поиска домов в прямоугольнике: %v", err)
+	}
+
+	if len(houses) != 2 || houses[0].ID != ids[0] || houses[1].ID != ids[2] {
+		t.Fatalf("неверные дома в прямоугольнике: %+v", houses)
+	}
+
+	var streamed []int
+	if err := repo.StreamHouses(ctx, &[4]float64{lat - 0.01, lon - 0.01, lat + 0.1, lon + 0.01}, func(house models.House) error {
+		streamed = append(streamed, house.ID)
+		return nil
+	}); err != nil {
+		t.Fatalf("ошибка выгрузки домов: %v", err)
+	}
+
+	if len(streamed) != 3 || streamed[0] != ids[0] || streamed[2] != ids[2] {
+		t.Fatalf("неверная выгрузка домов: %v", streamed)
+	}
+
+	// прямоугольник через 180-й меридиан: от 179.99 на восток до -179.99
+	for i, houseLon := range []float64{179.995, -179.995, 0} {
+		houseLat := lat
+		house := createHouse(t, repo, models.House{Latitude: &houseLat, Longitude: &houseLon})
+		ids[i] = house.ID
+	}
+
+	houses, err = repo.GetHousesInBox(ctx, lat-0.001, 179.99, lat+0.001, -179.99, lat, 179.995, 10)
+	if err != nil {
+		t.Fatalf("ошибка поиска домов в прямоугольнике через меридиан: %v", err)
+	}
+
+	if len(houses) != 2 || houses[0].ID != ids[0] || houses[1].ID != ids[1] {
+		t.Fatalf("неверные дома в прямоугольнике через меридиан: %+v", houses)
+	}
+
+	streamed = nil
+	if err := repo.StreamHouses(ctx, &[4]float64{lat - 0.001, 179.99, lat + 0.001, -179.99}, func(house models.House) error {
+		streamed = append(streamed, house.ID)
+		return nil
+	}); err != nil {
+		t.Fatalf("ошибка выгрузки домов: %v", err)
+	}
+
+	if len(streamed) != 2 || streamed[0] != ids[0] || streamed[1] != ids[1] {
+		t.Fatalf("неверная выгрузка домов через меридиан: %v", streamed)
+	}
+}
+
+func testFlats(t *testing.T, repo app.Repository) {
+	ctx := context.Background()
+
+	house := createHouse(t, repo, models.House{})
+
+	updatedAt, err := repo.GetHouseUpdatedAt(ctx, house.ID)
+	if err != nil {
+		t.Fatalf("ошибка получения времени изменения дома: %v", err)
+	}
+
+	if _, err := repo.GetHouseUpdatedAt(ctx, -1); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ожидалась sql.ErrNoRows для несуществующего дома: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond) // SQLite хранит время с точностью до миллисекунды
+
+	created, err := repo.CreateFlat(ctx, models.Flat{HouseID: house.ID, Price: 100, Rooms: 2, Area: 50, Floor: 3, Description: "desc", Photos: []string{"a.jpg"}})
+	if err != nil {
+		t.Fatalf("ошибка создания квартиры: %v", err)
+	}
+
+	if created.Status != models.FlatStatusCreated || created.Price != 100 || created.Area != 50 || len(created.Photos) != 1 {
+		t.Fatalf("неверная созданная квартира: %+v", created)
+	}
+
+	if _, err := repo.CreateFlat(ctx, models.Flat{HouseID: -1, Price: 1, Rooms: 1}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ожидалась sql.ErrNoRows для несуществующего дома: %v", err)
+	}
+
+	// по времени изменения дома кеш списка квартир узнает о новых квартирах
+	updatedAt = assertHouseTouched(t, repo, house.ID, updatedAt, "создание квартиры")
+
+	// CreateFlat возвращает сквозной ID квартиры, по которому работают остальные методы
+	flat, err := repo.GetFlat(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("ошибка получения квартиры: %v", err)
+	} else if flat.ID != 1 || flat.HouseID != house.ID || flat.Description != "desc" {
+		t.Fatalf("неверная квартира: %+v", flat)
+	}
+
+	updated, err := repo.UpdateFlat(ctx, created.ID, models.FlatStatusApproved, uuid.Nil)
+	if err != nil {
+		t.Fatalf("ошибка обновления квартиры: %v", err)
+	} else if updated.Status != models.FlatStatusApproved || updated.ID != 1 {
+		t.Fatalf("неверная обновленная квартира: %+v", updated)
+	}
+	assertHouseTouched(t, repo, house.ID, updatedAt, "изменение статуса")
+
+	if _, err := repo.UpdateFlat(ctx, -1, models.FlatStatusApproved, uuid.Nil); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ожидалась sql.ErrNoRows для несуществующей квартиры: %v", err)
+	}
+
+	moderatorID, err := repo.GetFlatModerator(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("ошибка получения модератора: %v", err)
+	} else if moderatorID != uuid.Nil {
+		t.Fatalf("у новой квартиры не должно быть модератора")
+	}
+
+	// квартира на модерации закрепляется за модератором, окончание проверки снимает закрепление;
+	// модератор без учетной записи квартиру не закрепляет
+	moderator, err := repo.CreateUser(ctx, uuid.NewString()+"@example.com", "hash", models.UserTypeModerator)
+	if err != nil {
+		t.Fatalf("ошибка создания модератора: %v", err)
+	}
+	for _, step := range []struct {
+		status    models.FlatStatus
+		moderator uuid.UUID
+		want      uuid.UUID
+	}{
+		{models.FlatStatusOnModeration, moderator, moderator},
+		{models.FlatStatusApproved, moderator, uuid.Nil},
+		{models.FlatStatusOnModeration, uuid.New(), uuid.Nil},
+	} {
+		if _, err := repo.UpdateFlat(ctx, created.ID, step.status, step.moderator); err != nil {
+			t.Fatalf("ошибка обновления квартиры: %v", err)
+		}
+		if moderatorID, err := repo.GetFlatModerator(ctx, created.ID); err != nil || moderatorID != step.want {
+			t.Fatalf("статус %s: неверный модератор %v, ожидался %v: %v", step.status, moderatorID, step.want, err)
+		}
+	}
+
+	imported, err := repo.CreateFlats(ctx, house.ID, []models.Flat{{Price: 300, Rooms: 1, Area: 20}, {Price: 200, Rooms: 3, Area: 80}})
+	if err != nil {
+		t.Fatalf("ошибка импорта квартир: %v", err)
+	} else if len(imported) != 2 {
+		t.Fatalf("неверное количество импортированных квартир")
+	}
+
+	if _, err := repo.CreateFlats(ctx, -1, []models.Flat{{Price: 1, Rooms: 1}}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ожидалась sql.ErrNoRows при импорте в несуществующий дом: %v", err)
+	}
+
+	flats, err := repo.GetFlats(ctx, house.ID, models.FlatFilter{})
+	if err != nil {
+		t.Fatalf("ошибка получения квартир: %v", err)
+	}
+
+	if len(flats) != 3 || flats[0].ID != 1 || flats[1].ID != 2 || flats[2].ID != 3 {
+		t.Fatalf("неверные квартиры дома: %+v", flats)
+	}
+
+	minPrice, maxArea := 150, 60.0
+	flats, err = repo.GetFlats(ctx, house.ID, models.FlatFilter{MinPrice: &minPrice, MaxArea: &maxArea})
+	if err != nil {
+		t.Fatalf("ошибка получения квартир с фильтром: %v", err)
+	}
+
+	if len(flats) != 1 || flats[0].ID != 2 {
+		t.Fatalf("неверный результат фильтра: %+v", flats)
+	}
+
+	// после шагов модерации на проверке только первая квартира, импортированные остались созданными
+	status := models.FlatStatusOnModeration
+	flats, err = repo.GetFlats(ctx, house.ID, models.FlatFilter{Status: &status})
+	if err != nil {
+		t.Fatalf("ошибка получения квартир с фильтром по статусу: %v", err)
+	}
+
+	if len(flats) != 1 || flats[0].ID != 1 {
+		t.Fatalf("неверный результат фильтра по статусу: %+v", flats)
+	}
+
+	var streamed []int
+	if err := repo.StreamFlats(ctx, &house.ID, models.FlatFilter{}, func(flat models.Flat) error {
+		streamed = append(streamed, flat.ID)
+		return nil
+	}); err != nil {
+		t.Fatalf("ошибка выгрузки квартир: %v", err)
+	}
+
+	if len(streamed) != 3 || streamed[0] != 1 || streamed[2] != 3 {
+		t.Fatalf("неверная выгрузка квартир: %v", streamed)
+	}
+}
+
+func testFlatNumbering(t *testing.T, repo app.Repository) {
+	ctx := context.Background()
+
+	first := createHouse(t, repo, models.House{})
+	second := createHouse(t, repo, models.House{})
+
+	const flatsCount = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*flatsCount)
+	for i := 0; i < flatsCount; i++ {
+		for _, houseID := range []int{first.ID, second.ID} {
+			wg.Add(1)
+			go func(houseID int) {
+				defer wg.Done()
+				if _, err := repo.CreateFlat(ctx, models.Flat{HouseID: houseID, Price: 1, Rooms: 1}); err != nil {
+					errs <- err
+				}
+			}(houseID)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("ошибка параллельного создания квартиры: %v", err)
+	}
+
+	// нумерация своя в каждом доме и идет без пропусков
+	for _, houseID := range []int{first.ID, second.ID} {
+		flats, err := repo.GetFlats(ctx, houseID, models.FlatFilter{})
+		if err != nil {
+			t.Fatalf("ошибка получения квартир: %v", err)
+		}
+
+		if len(flats) != flatsCount {
+			t.Fatalf("неверное количество квартир: %d", len(flats))
+		}
+
+		for i, flat := range flats {
+			if flat.ID != i+1 {
+				t.Fatalf("номера квартир идут с пропуском: ожидался %d, получен %d", i+1, flat.ID)
+			}
+		}
+	}
+}
+
+func testPrices(t *testing.T, repo app.Repository) {
+	ctx := context.Background()
+
+	house := createHouse(t, repo, models.House{})
+
+	created, err := repo.CreateFlat(ctx, models.Flat{HouseID: house.ID, Price: 100, Rooms: 1})
+	if err != nil {
+		t.Fatalf("ошибка создания квартиры: %v", err)
+	}
+
+	flat, oldPrice, err := repo.UpdateFlatPrice(ctx, created.ID, 80)
+	if err != nil {
+		t.Fatalf("ошибка обновления цены: %v", err)
+	} else if oldPrice != 100 || flat.Price != 80 {
+		t.Fatalf("неверное обновление цены: было %d, стало %d", oldPrice, flat.Price)
+	}
+
+	// цена не изменилась - история не пополняется
+	if _, _, err := repo.UpdateFlatPrice(ctx, created.ID, 80); err != nil {
+		t.Fatalf("ошибка обновления цены: %v", err)
+	}
+
+	prices, err := repo.GetFlatPrices(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("ошибка получения истории цен: %v", err)
+	}
+
+	if len(prices) != 2 || prices[0].Price != 100 || prices[1].Price != 80 {
+		t.Fatalf("неверная история цен: %+v", prices)
+	}
+
+	if _, _, err := repo.UpdateFlatPrice(ctx, -1, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ожидалась sql.ErrNoRows для несуществующей квартиры: %v", err)
+	}
+
+	prices, err = repo.GetFlatPrices(ctx, -1)
+	if err != nil || len(prices) != 0 {
+		t.Fatalf("история цен несуществующей квартиры должна быть пустой: %v", err)
+	}
+}
+
+func testPhotos(t *testing.T, repo app.Repository) {
+	ctx := context.Background()
+
+	house := createHouse(t, repo, models.House{})
+
+	created, err := repo.CreateFlat(ctx, models.Flat{HouseID: house.ID, Price: 1, Rooms: 1})
+	if err != nil {
+		t.Fatalf("ошибка создания квартиры: %v", err)
+	}
+
+	updatedAt, err := repo.GetHouseUpdatedAt(ctx, house.ID)
+	if err != nil {
+		t.Fatalf("ошибка получения времени изменения дома: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	photo, err := repo.CreateFlatPhoto(ctx, models.FlatPhoto{FlatID: created.ID, Key: "a.jpg", ThumbnailKey: "a_thumb.jpg", ContentType: "image/jpeg", Size: 10, Width: 4, Height: 3})
+	if err != nil {
+		t.Fatalf("ошибка сохранения фотографии: %v", err)
+	} else if photo.ID == 0 || photo.CreatedAt == "" {
+		t.Fatalf("неверная фотография: %+v", photo)
+	}
+	assertHouseTouched(t, repo, house.ID, updatedAt, "загрузка фотографии")
+
+	photos, err := repo.GetHousePhotos(ctx, house.ID)
+	if err != nil {
+		t.Fatalf("ошибка получения фотографий: %v", err)
+	}
+
+	if len(photos) != 1 || photos[0].FlatNumber != 1 || photos[0].Key != "a.jpg" || photos[0].Width != 4 {
+		t.Fatalf("неверные фотографии дома: %+v", photos)
+	}
+
+	if _, err := repo.CreateFlatPhoto(ctx, models.FlatPhoto{FlatID: -1, Key: "b.jpg", ThumbnailKey: "b_thumb.jpg"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ожидалась sql.ErrNoRows для фотографии несуществующей квартиры: %v", err)
+	}
+}
+
+func testSubscriptions(t *testing.T, repo app.Repository) {
+	ctx := context.Background()
+
+	house := createHouse(t, repo, models.House{})
+
+	if err := repo.SubscribeToNewFlats(ctx, house.ID, "a@example.com"); err != nil {
+		t.Fatalf("ошибка подписки: %v", err)
+	}
+
+	if err := repo.SubscribeToNewFlats(ctx, house.ID, "b@example.com"); err != nil {
+		t.Fatalf("ошибка подписки: %v", err)
+	}
+
+	if err := repo.SubscribeToNewFlats(ctx, house.ID, "a@example.com"); !errors.Is(err, repository.ErrAlreadyExists) {
+		t.Fatalf("ожидалась repository.ErrAlreadyExists для повторной подписки: %v", err)
+	}
+
+	if err := repo.SubscribeToNewFlats(ctx, -1, "a@example.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("ожидалась sql.ErrNoRows для подписки на несуществующий дом: %v", err)
+	}
+
+	subscribers, err := repo.GetSubscribers(ctx, house.ID)
+	if err != nil {
+		t.Fatalf("ошибка получения подписчиков: %v", err)
+	}
+
+	if len(subscribers) != 2 {
+		t.Fatalf("неверные подписчики: %v", subscribers)
+	}
+}
+
+func testStats(t *testing.T, repo app.Repository) {
+	ctx := context.Background()
+
+	before, err := repo.GetStats(ctx)
+	if err != nil {
+		t.Fatalf("ошибка получения статистики: %v", err)
+	}
+
+	house := createHouse(t, repo, models.House{})
+
+	flats, err := repo.CreateFlats(ctx, house.ID, []models.Flat{{Price: 1000, Rooms: 1}, {Price: 2000, Rooms: 2}})
+	if err != nil {
+		t.Fatalf("ошибка создания квартир: %v", err)
+	}
+
+	if _, err := repo.UpdateFlat(ctx, flats[0].ID, models.FlatStatusApproved, uuid.Nil); err != nil {
+		t.Fatalf("ошибка обновления квартиры: %v", err)
+	}
+
+	after, err := repo.GetStats(ctx)
+	if err != nil {
+		t.Fatalf("ошибка получения статистики: %v", err)
+	}
+
+	// общая база может пополняться другими тестами, но сам этот тест выполняется последовательно
+	if after.Houses != before.Houses+1 {
+		t.Fatalf("неверное число домов: было %d, стало %d", before.Houses, after.Houses)
+	}
+
+	if after.FlatsByStatus[models.FlatStatusCreated] != before.FlatsByStatus[models.FlatStatusCreated]+1 ||
+		after.FlatsByStatus[models.FlatStatusApproved] != before.FlatsByStatus[models.FlatStatusApproved]+1 {
+		t.Fatalf("неверное число квартир по статусам: было %v, стало %v", before.FlatsByStatus, after.FlatsByStatus)
+	}
+}
+
+// createHouse создает дом с уникальным адресом, дополняя переданные поля.
+// assertHouseTouched проверяет, что action изменило время изменения дома, и ждет, чтобы следующее
+// изменение получило другое время. Возвращает новое время.
+func assertHouseTouched(t *testing.T, repo app.Repository, houseID int, before, action string) string {
+	t.Helper()
+
+	touched, err := repo.GetHouseUpdatedAt(context.Background(), houseID)
+	if err != nil {
+		t.Fatalf("ошибка получения времени изменения дома: %v", err)
+	} else if touched == before {
+		t.Fatalf("%s не изменило время изменения дома: %s", action, touched)
+	}
+	time.Sleep(2 * time.Millisecond) // SQLite хранит время с точностью до миллисекунды
+
+	return touched
+}
+
+func createHouse(t *testing.T, repo app.Repository, house models.House) models.House {
+	t.Helper()
+
+	key := "repotest " + uuid.NewString()
+	house.Address, house.AddressKey = key, &key
+	house.Developer, house.YearBuilt = "repotest", 2000
+
+	created, err := repo.CreateHouse(context.Background(), house)
+	if err != nil {
+		t.Fatalf("ошибка создания дома: %v", err)
+	}
+
+	return created
+}
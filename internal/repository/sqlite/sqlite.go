@@ -0,0 +1,606 @@
+// Package sqlite реализует хранилище приложения поверх встроенной SQLite для установок на одном узле.
+// Поведение совпадает с репозиторием PostgreSQL и проверяется тем же набором тестов repotest.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	sqlitedriver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// earthRadius совпадает с радиусом Земли в расширении earthdistance, чтобы расстояния не расходились с PostgreSQL
+const earthRadius = 6378168.0
+
+const houseColumns = "id, address, city, street, building, postal_code, latitude, longitude, address_key, year_built, developer, created_at, updated_at"
+
+const flatColumns = "flat_number, house_id, price, rooms, status, area, floor, description, photos"
+
+// now возвращает текущее время в том же виде, в каком его отдает PostgreSQL
+const now = "strftime('%Y-%m-%dT%H:%M:%fZ', 'now')"
+
+// distance - расстояние по гаверсинусу от точки (?, ?) до дома; аргументы задает distanceArgs
+const distance = "2 * 6378168.0 * asin(sqrt(pow(sin(radians(latitude - ?) / 2), 2) + cos(radians(?)) * cos(radians(latitude)) * pow(sin(radians(longitude - ?) / 2), 2)))"
+
+// boxCondition - попадание дома в прямоугольник; аргументы задает boxArgs. Если min_lon > max_lon,
+// прямоугольник пересекает 180-й меридиан и долгота проверяется по двум диапазонам.
+const boxCondition = "latitude BETWEEN ? AND ? AND (longitude BETWEEN ? AND ? OR (? > ? AND (longitude >= ? OR longitude <= ?)))"
+
+type Repository struct {
+	db           *sqlx.DB
+	queryTimeout time.Duration
+}
+
+// Open открывает файл базы с настройками из DSN.
+func Open(path string) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite", DSN(path))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// DSN возвращает строку подключения к файлу базы, с которой работает репозиторий. Транзакции начинаются
+// с BEGIN IMMEDIATE, поэтому пишущие транзакции выполняются по очереди, а конкурирующие соединения
+// ждут блокировку до busy_timeout.
+func DSN(path string) string {
+	query := url.Values{}
+	query.Add("_pragma", "busy_timeout(10000)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Set("_txlock", "immediate")
+
+	return "file:" + path + "?" + query.Encode()
+}
+
+// NewRepository создает репозиторий. queryTimeout ограничивает время каждой операции,
+// кроме потоковых выгрузок; 0 - без ограничения.
+func NewRepository(db *sqlx.DB, queryTimeout time.Duration) *Repository {
+	return &Repository{db: db, queryTimeout: queryTimeout}
+}
+
+func (r *Repository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, r.queryTimeout)
+}
+
+func (r *Repository) CreateUser(ctx context.Context, email, passwordHash string, userType models.UserType) (uuid.UUID, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	userID := uuid.New()
+	if _, err := r.db.ExecContext(ctx, "INSERT INTO users (id, email, password_hash, user_type) VALUES (?, ?, ?, ?)", userID, email, passwordHash, userType); err != nil {
+		return uuid.Nil, err
+	}
+
+	return userID, nil
+}
+
+func (r *Repository) GetUser(ctx context.Context, userID uuid.UUID) (models.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var user models.User
+	if err := r.db.GetContext(ctx, &user, "SELECT id, email, password_hash, user_type FROM users WHERE id = ?", userID); err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *Repository) CreateHouse(ctx context.Context, house models.House) (models.House, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var created models.House
+	if err := r.db.GetContext(ctx, &created, "INSERT INTO houses (address, city, street, building, postal_code, latitude, longitude, address_key, developer, year_built) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING "+houseColumns,
+		house.Address, house.City, house.Street, house.Building, house.PostalCode, house.Latitude, house.Longitude, house.AddressKey, house.Developer, house.YearBuilt); err != nil {
+		if isUniqueViolation(err) {
+			return models.House{}, repository.ErrAlreadyExists
+		}
+		return models.House{}, err
+	}
+
+	return created, nil
+}
+
+func (r *Repository) GetHouseByAddressKey(ctx context.Context, addressKey string) (models.House, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var house models.House
+	if err := r.db.GetContext(ctx, &house, "SELECT "+houseColumns+" FROM houses WHERE address_key = ?", addressKey); err != nil {
+		return models.House{}, err
+	}
+
+	return house, nil
+}
+
+func (r *Repository) GetHouseUpdatedAt(ctx context.Context, houseID int) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var updatedAt string
+	if err := r.db.GetContext(ctx, &updatedAt, "SELECT updated_at FROM houses WHERE id = ?", houseID); err != nil {
+		return "", err
+	}
+
+	return updatedAt, nil
+}
+
+func (r *Repository) GetHousesNearby(ctx context.Context, lat, lon, radius float64, limit int) ([]models.NearbyHouse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	// расширения earthdistance нет, поэтому кандидаты отбираются по индексу (latitude, longitude)
+	// в описанном вокруг круга прямоугольнике, а точное расстояние считается по гаверсинусу
+	query := "SELECT " + houseColumns + ", " + distance + " AS distance FROM houses WHERE latitude BETWEEN ? AND ?"
+	args := distanceArgs(lat, lon)
+
+	latDelta := radius / earthRadius * 180 / math.Pi
+	args = append(args, lat-latDelta, lat+latDelta)
+
+	// у полюсов и на линии перемены дат прямоугольник по долготе не строится, там хватает отбора по широте
+	if cosLat := math.Cos(lat * math.Pi / 180); cosLat > 1e-6 {
+		lonDelta := radius / (earthRadius * cosLat) * 180 / math.Pi
+		if lon-lonDelta >= -180 && lon+lonDelta <= 180 {
+			query += " AND longitude BETWEEN ? AND ?"
+			args = append(args, lon-lonDelta, lon+lonDelta)
+		}
+	}
+
+	houses := []models.NearbyHouse{}
+	if err := r.db.SelectContext(ctx, &houses, "SELECT * FROM ("+query+") WHERE distance <= ? ORDER BY distance LIMIT ?", append(args, radius, limit)...); err != nil {
+		return nil, err
+	}
+
+	return houses, nil
+}
+
+func (r *Repository) GetHousesInBox(ctx context.Context, minLat, minLon, maxLat, maxLon, lat, lon float64, limit int) ([]models.NearbyHouse, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	houses := []models.NearbyHouse{}
+	if err := r.db.SelectContext(ctx, &houses, `SELECT `+houseColumns+`, `+distance+` AS distance
+		FROM houses
+		WHERE `+boxCondition+`
+		ORDER BY distance
+		LIMIT ?`, append(append(distanceArgs(lat, lon), boxArgs(minLat, minLon, maxLat, maxLon)...), limit)...); err != nil {
+		return nil, err
+	}
+
+	return houses, nil
+}
+
+func (r *Repository) GetFlats(ctx context.Context, houseID int, filter models.FlatFilter) ([]models.Flat, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query, args := flatsQuery(&houseID, filter)
+
+	var flats []models.Flat
+	if err := r.db.SelectContext(ctx, &flats, query+" ORDER BY flat_number", args...); err != nil {
+		return nil, err
+	}
+
+	return flats, nil
+}
+
+// StreamFlats построчно передает квартиры в fn, не загружая всю выборку в память.
+// houseID == nil означает квартиры всех домов.
+func (r *Repository) StreamFlats(ctx context.Context, houseID *int, filter models.FlatFilter, fn func(models.Flat) error) error {
+	query, args := flatsQuery(houseID, filter)
+
+	rows, err := r.db.QueryxContext(ctx, query+" ORDER BY house_id, flat_number", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var flat models.Flat
+		if err := rows.StructScan(&flat); err != nil {
+			return err
+		}
+
+		if err := fn(flat); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// StreamHouses построчно передает дома в fn. box == nil означает все дома,
+// иначе [minLat, minLon, maxLat, maxLon].
+func (r *Repository) StreamHouses(ctx context.Context, box *[4]float64, fn func(models.House) error) error {
+	query := "SELECT " + houseColumns + " FROM houses"
+	var args []interface{}
+	if box != nil {
+		query += " WHERE " + boxCondition
+		args = boxArgs(box[0], box[1], box[2], box[3])
+	}
+
+	rows, err := r.db.QueryxContext(ctx, query+" ORDER BY id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var house models.House
+		if err := rows.StructScan(&house); err != nil {
+			return err
+		}
+
+		if err := fn(house); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func flatsQuery(houseID *int, filter models.FlatFilter) (string, []interface{}) {
+	query := "SELECT " + flatColumns + " FROM flats WHERE TRUE"
+	var args []interface{}
+
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		query += fmt.Sprintf(" AND %s ?", condition)
+	}
+
+	if houseID != nil {
+		addCondition("house_id =", *houseID)
+	}
+	if filter.MinPrice != nil {
+		addCondition("price >=", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		addCondition("price <=", *filter.MaxPrice)
+	}
+	if filter.MinArea != nil {
+		addCondition("area >=", *filter.MinArea)
+	}
+	if filter.MaxArea != nil {
+		addCondition("area <=", *filter.MaxArea)
+	}
+	if filter.Status != nil {
+		addCondition("status =", *filter.Status)
+	}
+
+	return query, args
+}
+
+func (r *Repository) CreateFlat(ctx context.Context, flat models.Flat) (models.Flat, error) {
+	created, err := r.CreateFlats(ctx, flat.HouseID, []models.Flat{flat})
+	if err != nil {
+		return models.Flat{}, err
+	}
+
+	return created[0], nil
+}
+
+// CreateFlats создает квартиры дома в одной транзакции: либо все, либо ни одной.
+// Номера присваиваются по порядку после последнего существующего, как в CreateFlat.
+func (r *Repository) CreateFlats(ctx context.Context, houseID int, flats []models.Flat) ([]models.Flat, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	lastFlatNumber, err := lastFlatNumber(ctx, tx, houseID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	created := make([]models.Flat, 0, len(flats))
+	for i, flat := range flats {
+		if flat.Photos == nil {
+			flat.Photos = pq.StringArray{}
+		}
+
+		var createdFlat models.Flat
+		if err := tx.QueryRowContext(ctx, "INSERT INTO flats (house_id, price, rooms, flat_number, status, area, floor, description, photos) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, house_id, price, rooms, status, area, floor, description, photos",
+			houseID, flat.Price, flat.Rooms, lastFlatNumber+i+1, models.FlatStatusCreated, flat.Area, flat.Floor, flat.Description, flat.Photos).Scan(&createdFlat.ID, &createdFlat.HouseID, &createdFlat.Price, &createdFlat.Rooms, &createdFlat.Status, &createdFlat.Area, &createdFlat.Floor, &createdFlat.Description, &createdFlat.Photos); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO flat_price_history (flat_id, price) VALUES (?, ?)", createdFlat.ID, createdFlat.Price); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		created = append(created, createdFlat)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE houses SET updated_at = "+now+" WHERE id = ?", houseID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (r *Repository) UpdateFlat(ctx context.Context, flatID int, status models.FlatStatus, moderatorID uuid.UUID) (models.Flat, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return models.Flat{}, err
+	}
+
+	var flat models.Flat
+	moderator := uuid.NullUUID{UUID: moderatorID, Valid: status == models.FlatStatusOnModeration && moderatorID != uuid.Nil}
+	if err := tx.GetContext(ctx, &flat, "UPDATE flats SET status = ?, moderator_id = (SELECT id FROM users WHERE id = ?) WHERE id = ? RETURNING "+flatColumns, status, moderator, flatID); err != nil {
+		tx.Rollback()
+		return models.Flat{}, err
+	}
+
+	// по времени изменения дома другие реплики узнают, что их кеш квартир устарел
+	if _, err := tx.ExecContext(ctx, "UPDATE houses SET updated_at = "+now+" WHERE id = ?", flat.HouseID); err != nil {
+		tx.Rollback()
+		return models.Flat{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return models.Flat{}, err
+	}
+
+	return flat, nil
+}
+
+// UpdateFlatPrice меняет цену квартиры и записывает изменение в историю. Возвращает прежнюю цену.
+func (r *Repository) UpdateFlatPrice(ctx context.Context, flatID int, price int) (models.Flat, int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	// транзакция начинается с BEGIN IMMEDIATE, так что прочитанная цена не изменится до коммита
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return models.Flat{}, 0, err
+	}
+
+	var oldPrice int
+	if err := tx.QueryRowContext(ctx, "SELECT price FROM flats WHERE id = ?", flatID).Scan(&oldPrice); err != nil {
+		tx.Rollback()
+		return models.Flat{}, 0, err
+	}
+
+	var flat models.Flat
+	if err := tx.GetContext(ctx, &flat, "UPDATE flats SET price = ? WHERE id = ? RETURNING "+flatColumns, price, flatID); err != nil {
+		tx.Rollback()
+		return models.Flat{}, 0, err
+	}
+
+	if price != oldPrice {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO flat_price_history (flat_id, price) VALUES (?, ?)", flatID, price); err != nil {
+			tx.Rollback()
+			return models.Flat{}, 0, err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE houses SET updated_at = "+now+" WHERE id = ?", flat.HouseID); err != nil {
+			tx.Rollback()
+			return models.Flat{}, 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return models.Flat{}, 0, err
+	}
+
+	return flat, oldPrice, nil
+}
+
+func (r *Repository) GetFlatPrices(ctx context.Context, flatID int) ([]models.FlatPrice, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	prices := []models.FlatPrice{}
+	if err := r.db.SelectContext(ctx, &prices, "SELECT price, changed_at FROM flat_price_history WHERE flat_id = ? ORDER BY changed_at, id", flatID); err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+func (r *Repository) GetFlat(ctx context.Context, flatID int) (models.Flat, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var flat models.Flat
+	if err := r.db.GetContext(ctx, &flat, "SELECT "+flatColumns+" FROM flats WHERE id = ?", flatID); err != nil {
+		return models.Flat{}, err
+	}
+
+	return flat, nil
+}
+
+func (r *Repository) CreateFlatPhoto(ctx context.Context, photo models.FlatPhoto) (models.FlatPhoto, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return models.FlatPhoto{}, err
+	}
+
+	if err := tx.QueryRowContext(ctx, "INSERT INTO flat_photos (flat_id, storage_key, thumbnail_key, content_type, size, width, height) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at",
+		photo.FlatID, photo.Key, photo.ThumbnailKey, photo.ContentType, photo.Size, photo.Width, photo.Height).Scan(&photo.ID, &photo.CreatedAt); err != nil {
+		tx.Rollback()
+		if isForeignKeyViolation(err) {
+			return models.FlatPhoto{}, sql.ErrNoRows
+		}
+		return models.FlatPhoto{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE houses SET updated_at = "+now+" WHERE id = (SELECT house_id FROM flats WHERE id = ?)", photo.FlatID); err != nil {
+		tx.Rollback()
+		return models.FlatPhoto{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return models.FlatPhoto{}, err
+	}
+
+	return photo, nil
+}
+
+func (r *Repository) GetHousePhotos(ctx context.Context, houseID int) ([]models.FlatPhoto, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var photos []models.FlatPhoto
+	if err := r.db.SelectContext(ctx, &photos, `SELECT p.id, p.flat_id, f.flat_number, p.storage_key, p.thumbnail_key, p.content_type, p.size, p.width, p.height, p.created_at
+		FROM flat_photos p JOIN flats f ON f.id = p.flat_id
+		WHERE f.house_id = ?
+		ORDER BY p.id`, houseID); err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
+
+func (r *Repository) GetFlatModerator(ctx context.Context, flatID int) (uuid.UUID, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var moderatorID uuid.UUID
+	if err := r.db.QueryRowContext(ctx, "SELECT moderator_id FROM flats WHERE id = ?", flatID).Scan(&moderatorID); err != nil {
+		return uuid.Nil, err
+	}
+
+	return moderatorID, nil
+}
+
+func (r *Repository) SubscribeToNewFlats(ctx context.Context, houseID int, email string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, "INSERT INTO subscriptions (house_id, email) VALUES (?, ?)", houseID, email); err != nil {
+		if isUniqueViolation(err) {
+			return repository.ErrAlreadyExists
+		} else if isForeignKeyViolation(err) {
+			return sql.ErrNoRows
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) GetSubscribers(ctx context.Context, houseID int) ([]string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var subscribers []string
+	if err := r.db.SelectContext(ctx, &subscribers, "SELECT email FROM subscriptions WHERE house_id = ?", houseID); err != nil {
+		return nil, err
+	}
+
+	return subscribers, nil
+}
+
+// GetStats считает дома и квартиры по статусам.
+func (r *Repository) GetStats(ctx context.Context) (models.Stats, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	stats := models.Stats{FlatsByStatus: make(map[models.FlatStatus]int)}
+	if err := r.db.GetContext(ctx, &stats.Houses, "SELECT COUNT(*) FROM houses"); err != nil {
+		return models.Stats{}, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT status, COUNT(*) FROM flats GROUP BY status")
+	if err != nil {
+		return models.Stats{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status models.FlatStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return models.Stats{}, err
+		}
+
+		stats.FlatsByStatus[status] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return models.Stats{}, err
+	}
+
+	return stats, nil
+}
+
+// lastFlatNumber возвращает последний номер квартиры в доме. Блокировка строк в SQLite не нужна:
+// транзакция уже держит блокировку записи всей базы. Если дома нет, возвращает sql.ErrNoRows.
+func lastFlatNumber(ctx context.Context, tx *sql.Tx, houseID int) (int, error) {
+	var id int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM houses WHERE id = ?", houseID).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	var lastFlatNumber int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(flat_number), 0) FROM flats WHERE house_id = ?", houseID).Scan(&lastFlatNumber); err != nil {
+		return 0, err
+	}
+
+	return lastFlatNumber, nil
+}
+
+// distanceArgs возвращает аргументы выражения distance для точки (lat, lon)
+func distanceArgs(lat, lon float64) []interface{} {
+	return []interface{}{lat, lat, lon}
+}
+
+// boxArgs возвращает аргументы выражения boxCondition
+func boxArgs(minLat, minLon, maxLat, maxLon float64) []interface{} {
+	return []interface{}{minLat, maxLat, minLon, maxLon, minLon, maxLon, minLon, maxLon}
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlitedriver.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+}
+
+func isForeignKeyViolation(err error) bool {
+	var sqliteErr *sqlitedriver.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
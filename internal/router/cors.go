@@ -0,0 +1,121 @@
+package router
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CORSConfig описывает, каким сайтам браузер разрешит обращаться к API. Пустой AllowedOrigins
+// выключает CORS; "*" разрешает любой источник, но не вместе с AllowCredentials.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge - сколько браузер может кешировать ответ на предварительный запрос
+	MaxAge time.Duration
+}
+
+// Middleware добавляет заголовки CORS и сам отвечает на OPTIONS. Маршруты регистрируются вместе с методом
+// OPTIONS, иначе gorilla/mux отклонил бы предварительный запрос с 405 до вызова middleware; до обработчиков
+// OPTIONS не доходит, потому что они не проверяют метод запроса.
+func (c CORSConfig) Middleware(next http.Handler) http.Handler {
+	anyOrigin := slices.Contains(c.AllowedOrigins, "*")
+	allowedMethods := strings.Join(c.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(c.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(c.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(c.MaxAge.Seconds()))
+
+	headerAllowed := make(map[string]bool, len(c.AllowedHeaders))
+	for _, header := range c.AllowedHeaders {
+		headerAllowed[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		origin := r.Header.Get("Origin")
+
+		// ответ зависит от Origin, кеши не должны отдавать его другому сайту
+		if len(c.AllowedOrigins) > 0 && !(anyOrigin && !c.AllowCredentials) {
+			header.Add("Vary", "Origin")
+		}
+
+		allowed := origin != "" && (anyOrigin || slices.Contains(c.AllowedOrigins, origin))
+		if allowed {
+			if anyOrigin && !c.AllowCredentials {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if c.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		// на неизвестный путь предварительный запрос получает 404, как и остальные
+		route := mux.CurrentRoute(r)
+		if r.Method != http.MethodOptions || route == nil {
+			if allowed && exposedHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var routeMethods []string
+		routeMethods, _ = route.GetMethods()
+		header.Set("Allow", strings.Join(routeMethods, ", "))
+
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		if allowed && requestMethod != "" {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+
+			// без разрешающих заголовков браузер сам отменит запрос
+			if slices.Contains(c.AllowedMethods, requestMethod) && slices.Contains(routeMethods, requestMethod) && c.headersAllowed(r, headerAllowed) {
+				header.Set("Access-Control-Allow-Methods", allowedMethods)
+				if allowedHeaders != "" {
+					header.Set("Access-Control-Allow-Headers", allowedHeaders)
+				}
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (c CORSConfig) headersAllowed(r *http.Request, allowed map[string]bool) bool {
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); header != "" && !allowed[http.CanonicalHeaderKey(header)] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// SecurityHeaders добавляет стандартные заголовки безопасности. API отдает только данные, поэтому
+// политика запрещает ответам подгружать что-либо и встраиваться в страницы.
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", "no-referrer")
+		header.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		if r.TLS != nil {
+			header.Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,172 @@
+package router
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Vykiy/house-service/internal/export"
+	"github.com/Vykiy/house-service/internal/models"
+)
+
+var (
+	exportHouseHeader = []string{"id", "address", "city", "street", "building", "postal_code", "latitude", "longitude", "year_built", "developer", "created_at", "updated_at"}
+	exportFlatHeader  = []string{"house_id", "flat_number", "status", "price", "rooms", "area", "price_per_square_meter", "floor", "description", "photos"}
+)
+
+// ExportHouses выгружает дома в формате из параметра format (csv, ndjson, xlsx).
+// Необязательные min_lat, min_lon, max_lat, max_lon ограничивают выгрузку прямоугольником.
+func (h *Handler) ExportHouses(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format, ok := parseExportFormat(query.Get("format"))
+	if !ok {
+		http.Error(w, "неверный формат выгрузки", http.StatusBadRequest)
+		return
+	}
+
+	var box *[4]float64
+	if query.Has("min_lat") || query.Has("min_lon") || query.Has("max_lat") || query.Has("max_lon") {
+		values, ok := parseBox(query)
+		if !ok {
+			http.Error(w, "неверные границы прямоугольника", http.StatusBadRequest)
+			return
+		}
+		box = &values
+	}
+
+	h.streamExport(w, r, format, "houses", exportHouseHeader, func(writer export.Writer) error {
+		return h.app.ExportHouses(r.Context(), box, func(house models.House) error {
+			return writer.Write(house, []interface{}{
+				house.ID, house.Address, house.City, house.Street, house.Building, house.PostalCode,
+				optionalFloat(house.Latitude), optionalFloat(house.Longitude),
+				house.YearBuilt, house.Developer, house.CreatedAt, house.UpdatedAt,
+			})
+		})
+	})
+}
+
+// ExportFlats выгружает квартиры с теми же фильтрами, что и список квартир дома.
+// Без house_id выгружаются квартиры всех домов.
+func (h *Handler) ExportFlats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format, ok := parseExportFormat(query.Get("format"))
+	if !ok {
+		http.Error(w, "неверный формат выгрузки", http.StatusBadRequest)
+		return
+	}
+
+	var houseID *int
+	if query.Has("house_id") {
+		id, err := strconv.Atoi(query.Get("house_id"))
+		if err != nil {
+			http.Error(w, "неверный формат ID дома", http.StatusBadRequest)
+			return
+		}
+		houseID = &id
+	}
+
+	filter, ok := parseFlatFilter(query)
+	if !ok {
+		http.Error(w, "неверный фильтр квартир", http.StatusBadRequest)
+		return
+	}
+
+	h.streamExport(w, r, format, "flats", exportFlatHeader, func(writer export.Writer) error {
+		return h.app.ExportFlats(r.Context(), houseID, filter, func(flat models.Flat) error {
+			return writer.Write(flat, []interface{}{
+				flat.HouseID, flat.ID, string(flat.Status), flat.Price, flat.Rooms, flat.Area,
+				flat.PricePerSquareMeter, flat.Floor, flat.Description, strings.Join(flat.Photos, csvPhotosSeparator),
+			})
+		})
+	})
+}
+
+// streamExport пишет выгрузку прямо в ответ. После начала передачи статус изменить нельзя,
+// поэтому ошибка посреди выгрузки только логируется и обрывает ответ.
+func (h *Handler) streamExport(w http.ResponseWriter, r *http.Request, format export.Format, name string, header []string, write func(export.Writer) error) {
+	out := &trackingWriter{ResponseWriter: w}
+
+	flush := func() {
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+
+	writer, err := export.NewWriter(format, out, header, flush)
+	if err != nil {
+		http.Error(w, "ошибка создания выгрузки", http.StatusInternalServerError)
+		return
+	}
+
+	closed := false
+	defer func() {
+		if !closed {
+			// освобождает ресурсы выгрузки (временные файлы XLSX), не дописывая ее в ответ
+			out.discard = true
+			writer.Close()
+		}
+	}()
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+
+	fail := func() {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "ошибка выгрузки", http.StatusInternalServerError)
+	}
+
+	if err := write(writer); err != nil {
+		if !out.wrote {
+			fail()
+			return
+		}
+		slog.ErrorContext(r.Context(), "выгрузка прервана", "export", name, "error", err)
+		return
+	}
+
+	closed = true
+	if err := writer.Close(); err != nil {
+		if !out.wrote {
+			fail()
+			return
+		}
+		slog.ErrorContext(r.Context(), "завершение выгрузки", "export", name, "error", err)
+	}
+}
+
+func parseExportFormat(value string) (export.Format, bool) {
+	switch format := export.Format(value); format {
+	case "":
+		return export.FormatCSV, true
+	case export.FormatCSV, export.FormatNDJSON, export.FormatXLSX:
+		return format, true
+	default:
+		return "", false
+	}
+}
+
+func optionalFloat(value *float64) interface{} {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// trackingWriter запоминает, было ли что-то отправлено клиенту. После discard запись отбрасывается.
+type trackingWriter struct {
+	http.ResponseWriter
+	wrote   bool
+	discard bool
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	if t.discard {
+		return len(p), nil
+	}
+	t.wrote = true
+	return t.ResponseWriter.Write(p)
+}
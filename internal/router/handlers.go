@@ -1,24 +1,51 @@
 package router
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/Vykiy/house-service/internal/app"
 	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/repository"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 var dummyUserID = uuid.MustParse("123e4567-e89b-12d3-a456-426614174000")
 
+const (
+	maxNearbyRadius    = 100000 // метров
+	defaultNearbyLimit = 100
+	maxNearbyLimit     = 1000
+
+	maxFlatDescriptionLength = 10000
+	maxFlatPhotos            = 50
+
+	maxPhotoSize          = 10 << 20 // байт на одну фотографию
+	maxPhotoUploadSize    = 50 << 20 // байт на весь запрос
+	maxPhotosPerUpload    = 10
+	photoUploadFormMemory = 8 << 20
+
+	maxJSONBodySize = 1 << 20 // байт в JSON-теле запроса
+)
+
 type Handler struct {
 	app       *app.App
 	jwtIssuer *JWTIssuer
+	auth      *AuthGuard
 }
 
-func NewHandler(app *app.App, jwtIssuer *JWTIssuer) *Handler {
-	return &Handler{app: app, jwtIssuer: jwtIssuer}
+func NewHandler(app *app.App, jwtIssuer *JWTIssuer, auth *AuthGuard) *Handler {
+	return &Handler{app: app, jwtIssuer: jwtIssuer, auth: auth}
 }
 
 func (h *Handler) DummyLogin(w http.ResponseWriter, r *http.Request) {
@@ -44,22 +71,32 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		Password string    `json:"password"`
 	}{}
 
-	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
-		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+	if !decodeJSON(w, r, &credentials) {
 		return
 	}
 
-	successful, userType, err := h.app.CheckUserPassword(credentials.ID, credentials.Password)
+	account := credentials.ID.String()
+	if !h.auth.allowLogin(w, r, account) {
+		return
+	}
+
+	successful, userType, err := h.app.CheckUserPassword(r.Context(), credentials.ID, credentials.Password)
 	if err != nil {
 		http.Error(w, "ошибка проверки пароля", http.StatusInternalServerError)
 		return
 	}
 
 	if !successful {
+		// клиент сразу узнает, что следующая попытка будет отклонена до конца блокировки
+		if wait := h.auth.loginFailed(r.Context(), account); wait > 0 {
+			setRetryAfter(w, wait)
+		}
 		http.Error(w, "неверный пароль", http.StatusForbidden)
 		return
 	}
 
+	h.auth.loginSucceeded(r.Context(), account)
+
 	token, err := h.jwtIssuer.IssueToken(models.UserType(userType), credentials.ID)
 	if err != nil {
 		http.Error(w, "ошибка создания токена", http.StatusInternalServerError)
@@ -76,8 +113,11 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		UserType string `json:"user_type"`
 	}{}
 
-	if err := json.NewDecoder(r.Body).Decode(&registrationData); err != nil {
-		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+	if !decodeJSON(w, r, &registrationData) {
+		return
+	}
+
+	if !h.auth.allowRegister(w, r, registrationData.Email) {
 		return
 	}
 
@@ -88,7 +128,7 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := h.app.CreateUser(registrationData.Email, registrationData.Password, userType)
+	userID, err := h.app.CreateUser(r.Context(), registrationData.Email, registrationData.Password, userType)
 	if err != nil {
 		http.Error(w, "ошибка создания пользователя", http.StatusInternalServerError)
 		return
@@ -107,13 +147,18 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) CreateHouse(w http.ResponseWriter, r *http.Request) {
 	createHouseData := struct {
-		Address   string `json:"address"`
-		YearBuilt int    `json:"year"`
-		Developer string `json:"developer"`
+		Address    string   `json:"address"`
+		City       string   `json:"city"`
+		Street     string   `json:"street"`
+		Building   string   `json:"building"`
+		PostalCode string   `json:"postal_code"`
+		Latitude   *float64 `json:"latitude"`
+		Longitude  *float64 `json:"longitude"`
+		YearBuilt  int      `json:"year"`
+		Developer  string   `json:"developer"`
 	}{}
 
-	if err := json.NewDecoder(r.Body).Decode(&createHouseData); err != nil {
-		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+	if !decodeJSON(w, r, &createHouseData) {
 		return
 	}
 
@@ -122,8 +167,37 @@ func (h *Handler) CreateHouse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	house, err := h.app.CreateHouse(createHouseData.Address, createHouseData.Developer, createHouseData.YearBuilt)
-	if err != nil {
+	structured := createHouseData.City != "" && createHouseData.Street != "" && createHouseData.Building != ""
+	if strings.TrimSpace(createHouseData.Address) == "" && !structured {
+		http.Error(w, "не указан адрес дома", http.StatusBadRequest)
+		return
+	}
+
+	if (createHouseData.Latitude == nil) != (createHouseData.Longitude == nil) {
+		http.Error(w, "координаты должны быть указаны вместе", http.StatusBadRequest)
+		return
+	} else if createHouseData.Latitude != nil && !validLatLon(*createHouseData.Latitude, *createHouseData.Longitude) {
+		http.Error(w, "неверные координаты", http.StatusBadRequest)
+		return
+	}
+
+	house, err := h.app.CreateHouse(r.Context(), models.House{
+		Address:    createHouseData.Address,
+		City:       createHouseData.City,
+		Street:     createHouseData.Street,
+		Building:   createHouseData.Building,
+		PostalCode: createHouseData.PostalCode,
+		Latitude:   createHouseData.Latitude,
+		Longitude:  createHouseData.Longitude,
+		YearBuilt:  createHouseData.YearBuilt,
+		Developer:  createHouseData.Developer,
+	})
+	status := http.StatusOK
+	if errors.Is(err, app.ErrHouseAlreadyExists) {
+		// отдаем существующий дом, чтобы клиент мог перейти к нему
+		status = http.StatusConflict
+		w.Header().Set("Location", fmt.Sprintf("/house/%d", house.ID))
+	} else if err != nil {
 		http.Error(w, "ошибка создания дома", http.StatusInternalServerError)
 		return
 	}
@@ -134,11 +208,84 @@ func (h *Handler) CreateHouse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.WriteHeader(status)
 	w.Write(houseJson)
 }
 
+func (h *Handler) GetHousesNearby(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultNearbyLimit
+	if limitString := query.Get("limit"); limitString != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitString); err != nil || limit < 1 || limit > maxNearbyLimit {
+			http.Error(w, "неверный лимит", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var (
+		houses []models.NearbyHouse
+		err    error
+	)
+
+	if query.Has("min_lat") || query.Has("min_lon") || query.Has("max_lat") || query.Has("max_lon") {
+		box, ok := parseBox(query)
+		if !ok {
+			http.Error(w, "неверные границы прямоугольника", http.StatusBadRequest)
+			return
+		}
+
+		// без явной точки сортируем по расстоянию до центра прямоугольника
+		lat, lon := (box[0]+box[2])/2, (box[1]+box[3])/2
+		if box[1] > box[3] {
+			if lon += 180; lon > 180 {
+				lon -= 360
+			}
+		}
+		if query.Has("lat") || query.Has("lon") {
+			point, ok := parseFloatParams(query, "lat", "lon")
+			if !ok || !validLatLon(point[0], point[1]) {
+				http.Error(w, "неверные координаты", http.StatusBadRequest)
+				return
+			}
+			lat, lon = point[0], point[1]
+		}
+
+		houses, err = h.app.GetHousesInBox(r.Context(), box[0], box[1], box[2], box[3], lat, lon, limit)
+	} else {
+		params, ok := parseFloatParams(query, "lat", "lon", "radius")
+		if !ok || !validLatLon(params[0], params[1]) {
+			http.Error(w, "неверные координаты", http.StatusBadRequest)
+			return
+		}
+
+		if params[2] <= 0 || params[2] > maxNearbyRadius {
+			http.Error(w, "неверный радиус", http.StatusBadRequest)
+			return
+		}
+
+		houses, err = h.app.GetHousesNearby(r.Context(), params[0], params[1], params[2], limit)
+	}
+	if err != nil {
+		http.Error(w, "ошибка поиска домов", http.StatusInternalServerError)
+		return
+	}
+
+	housesJson, err := json.Marshal(houses)
+	if err != nil {
+		http.Error(w, "ошибка создания ответа", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(housesJson)
+}
+
 func (h *Handler) GetFlats(w http.ResponseWriter, r *http.Request) {
-	houseIDString := r.URL.Query().Get("house_id")
+	houseIDString := mux.Vars(r)["id"]
+	if houseIDString == "" {
+		houseIDString = r.URL.Query().Get("house_id")
+	}
 	if houseIDString == "" {
 		http.Error(w, "не указан ID дома", http.StatusBadRequest)
 		return
@@ -150,7 +297,19 @@ func (h *Handler) GetFlats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	flats, err := h.app.GetFlats(houseID)
+	filter, ok := parseFlatFilter(r.URL.Query())
+	if !ok {
+		http.Error(w, "неверный фильтр квартир", http.StatusBadRequest)
+		return
+	}
+
+	// модераторы видят все квартиры, остальные - только прошедшие модерацию
+	if userType, _ := r.Context().Value(userTypeCtxKey).(models.UserType); userType != models.UserTypeModerator {
+		approved := models.FlatStatusApproved
+		filter.Status = &approved
+	}
+
+	flats, err := h.app.GetFlats(r.Context(), houseID, filter)
 	if err != nil {
 		http.Error(w, "ошибка получения квартир", http.StatusInternalServerError)
 		return
@@ -166,28 +325,69 @@ func (h *Handler) GetFlats(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// flatData - описание квартиры в запросах на создание и импорт.
+type flatData struct {
+	HouseID     int      `json:"house_id"`
+	Price       int      `json:"price"`
+	Rooms       int      `json:"rooms"`
+	Area        float64  `json:"area"`
+	Floor       int      `json:"floor"`
+	Description string   `json:"description"`
+	Photos      []string `json:"photos"`
+}
+
+// validate возвращает описание первой найденной ошибки или пустую строку.
+func (d flatData) validate() string {
+	if d.Price < 0 {
+		return "неверная цена"
+	} else if d.Rooms < 1 {
+		return "неверное количество комнат"
+	} else if d.Area < 0 || math.IsNaN(d.Area) {
+		return "неверная площадь"
+	} else if len(d.Description) > maxFlatDescriptionLength {
+		return "слишком длинное описание"
+	} else if len(d.Photos) > maxFlatPhotos {
+		return "слишком много фотографий"
+	}
+
+	for _, photo := range d.Photos {
+		if strings.TrimSpace(photo) == "" {
+			return "пустая ссылка на фотографию"
+		}
+	}
+
+	return ""
+}
+
+func (d flatData) toModel() models.Flat {
+	return models.Flat{
+		HouseID:     d.HouseID,
+		Price:       d.Price,
+		Rooms:       d.Rooms,
+		Area:        d.Area,
+		Floor:       d.Floor,
+		Description: d.Description,
+		Photos:      d.Photos,
+	}
+}
+
 func (h *Handler) CreateFlat(w http.ResponseWriter, r *http.Request) {
-	createFlatData := struct {
-		HouseID int `json:"house_id"`
-		Price   int `json:"price"`
-		Rooms   int `json:"rooms"`
-	}{}
+	var createFlatData flatData
 
-	if err := json.NewDecoder(r.Body).Decode(&createFlatData); err != nil {
-		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+	if !decodeJSON(w, r, &createFlatData) {
 		return
 	}
 
-	if createFlatData.Price < 0 {
-		http.Error(w, "неверная цена", http.StatusBadRequest)
-		return
-	} else if createFlatData.Rooms < 1 {
-		http.Error(w, "неверное количество комнат", http.StatusBadRequest)
+	if message := createFlatData.validate(); message != "" {
+		http.Error(w, message, http.StatusBadRequest)
 		return
 	}
 
-	flat, err := h.app.CreateFlat(createFlatData.HouseID, createFlatData.Price, createFlatData.Rooms)
-	if err != nil {
+	flat, err := h.app.CreateFlat(r.Context(), createFlatData.toModel())
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "дом не найден", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, "ошибка создания квартиры", http.StatusInternalServerError)
 		return
 	}
@@ -202,14 +402,89 @@ func (h *Handler) CreateFlat(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func (h *Handler) UploadFlatPhotos(w http.ResponseWriter, r *http.Request) {
+	flatID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "неверный формат ID квартиры", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhotoUploadSize)
+	if err := r.ParseMultipartForm(photoUploadFormMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "слишком большой запрос", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["photo"]
+	if len(files) == 0 {
+		http.Error(w, "не переданы фотографии", http.StatusBadRequest)
+		return
+	} else if len(files) > maxPhotosPerUpload {
+		http.Error(w, "слишком много фотографий", http.StatusBadRequest)
+		return
+	}
+
+	photos := make([]models.FlatPhoto, 0, len(files))
+	for _, fileHeader := range files {
+		if fileHeader.Size > maxPhotoSize {
+			http.Error(w, "слишком большая фотография", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		data, err := readMultipartFile(fileHeader)
+		if err != nil {
+			http.Error(w, "ошибка чтения фотографии", http.StatusBadRequest)
+			return
+		}
+
+		// заголовку Content-Type клиента не доверяем, определяем тип по содержимому
+		contentType := http.DetectContentType(data)
+		if !app.IsSupportedPhotoType(contentType) {
+			http.Error(w, "неподдерживаемый формат фотографии", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		photo, err := h.app.AddFlatPhoto(r.Context(), flatID, data, contentType)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "квартира не найдена", http.StatusNotFound)
+			return
+		} else if errors.Is(err, app.ErrInvalidImage) {
+			http.Error(w, "не удалось прочитать изображение", http.StatusBadRequest)
+			return
+		} else if errors.Is(err, app.ErrStorageDisabled) {
+			http.Error(w, "загрузка фотографий недоступна", http.StatusServiceUnavailable)
+			return
+		} else if err != nil {
+			http.Error(w, "ошибка загрузки фотографии", http.StatusInternalServerError)
+			return
+		}
+
+		photos = append(photos, photo)
+	}
+
+	photosJson, err := json.Marshal(photos)
+	if err != nil {
+		http.Error(w, "ошибка создания ответа", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(photosJson)
+}
+
 func (h *Handler) UpdateFlat(w http.ResponseWriter, r *http.Request) {
 	updateFlatData := struct {
 		FlatID int               `json:"flat_id"`
 		Status models.FlatStatus `json:"status"`
 	}{}
 
-	if err := json.NewDecoder(r.Body).Decode(&updateFlatData); err != nil {
-		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+	if !decodeJSON(w, r, &updateFlatData) {
 		return
 	}
 
@@ -224,7 +499,7 @@ func (h *Handler) UpdateFlat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ok, err := h.app.CheckFlatModerator(updateFlatData.FlatID, userID)
+	ok, err := h.app.CheckFlatModerator(r.Context(), updateFlatData.FlatID, userID)
 	if err != nil {
 		http.Error(w, "ошибка проверки модератора", http.StatusInternalServerError)
 		return
@@ -235,7 +510,7 @@ func (h *Handler) UpdateFlat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	flat, err := h.app.UpdateFlat(updateFlatData.FlatID, updateFlatData.Status)
+	flat, err := h.app.UpdateFlat(r.Context(), updateFlatData.FlatID, updateFlatData.Status, userID)
 	if err != nil {
 		http.Error(w, "ошибка обновления квартиры", http.StatusInternalServerError)
 		return
@@ -250,6 +525,92 @@ func (h *Handler) UpdateFlat(w http.ResponseWriter, r *http.Request) {
 	w.Write(flatJson)
 }
 
+func (h *Handler) UpdateFlatPrice(w http.ResponseWriter, r *http.Request) {
+	flatID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "неверный формат ID квартиры", http.StatusBadRequest)
+		return
+	}
+
+	updatePriceData := struct {
+		Price int `json:"price"`
+	}{}
+
+	if !decodeJSON(w, r, &updatePriceData) {
+		return
+	}
+
+	if updatePriceData.Price < 0 {
+		http.Error(w, "неверная цена", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := r.Context().Value(userIDCtxKey).(uuid.UUID)
+	if !ok {
+		http.Error(w, "не указан ID пользователя", http.StatusBadRequest)
+		return
+	}
+
+	// цену квартиры на модерации меняет только проверяющий ее модератор, как и статус
+	ok, err = h.app.CheckFlatModerator(r.Context(), flatID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "квартира не найдена", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "ошибка проверки модератора", http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		http.Error(w, "квартира уже модерируется другим сотрудником", http.StatusForbidden)
+		return
+	}
+
+	flat, err := h.app.UpdateFlatPrice(r.Context(), flatID, updatePriceData.Price)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "квартира не найдена", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "ошибка обновления цены", http.StatusInternalServerError)
+		return
+	}
+
+	flatJson, err := json.Marshal(flat)
+	if err != nil {
+		http.Error(w, "ошибка создания ответа", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(flatJson)
+}
+
+func (h *Handler) GetFlatPrices(w http.ResponseWriter, r *http.Request) {
+	flatID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "неверный формат ID квартиры", http.StatusBadRequest)
+		return
+	}
+
+	prices, err := h.app.GetFlatPrices(r.Context(), flatID)
+	if err != nil {
+		http.Error(w, "ошибка получения истории цен", http.StatusInternalServerError)
+		return
+	}
+
+	if len(prices) == 0 {
+		http.Error(w, "квартира не найдена", http.StatusNotFound)
+		return
+	}
+
+	pricesJson, err := json.Marshal(prices)
+	if err != nil {
+		http.Error(w, "ошибка создания ответа", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(pricesJson)
+}
+
 func (h *Handler) SubscribeToNewFlats(w http.ResponseWriter, r *http.Request) {
 	houseIDString := r.URL.Query().Get("house_id")
 	if houseIDString == "" {
@@ -267,15 +628,105 @@ func (h *Handler) SubscribeToNewFlats(w http.ResponseWriter, r *http.Request) {
 		Email string `json:"email"`
 	}{}
 
-	if err := json.NewDecoder(r.Body).Decode(&subscriptionData); err != nil {
-		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+	if !decodeJSON(w, r, &subscriptionData) {
 		return
 	}
 
-	if err := h.app.SubscribeToNewFlats(houseID, subscriptionData.Email); err != nil {
+	if err := h.app.SubscribeToNewFlats(r.Context(), houseID, subscriptionData.Email); errors.Is(err, repository.ErrAlreadyExists) {
+		http.Error(w, "подписка уже оформлена", http.StatusConflict)
+		return
+	} else if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "дом не найден", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, "ошибка подписки на новые квартиры", http.StatusInternalServerError)
 		return
 	}
 
 	w.Write([]byte("Успешно оформлена подписка"))
 }
+
+// parseFloatParams разбирает обязательные числовые параметры запроса в порядке names.
+func parseFloatParams(query url.Values, names ...string) ([]float64, bool) {
+	values := make([]float64, 0, len(names))
+	for _, name := range names {
+		value, err := strconv.ParseFloat(query.Get(name), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+
+	return values, true
+}
+
+// parseBox разбирает прямоугольник min_lat, min_lon, max_lat, max_lon. min_lon больше max_lon означает
+// прямоугольник, пересекающий 180-й меридиан: от min_lon на восток до max_lon.
+func parseBox(query url.Values) ([4]float64, bool) {
+	values, ok := parseFloatParams(query, "min_lat", "min_lon", "max_lat", "max_lon")
+	if !ok || !validLatLon(values[0], values[1]) || !validLatLon(values[2], values[3]) || values[0] > values[2] {
+		return [4]float64{}, false
+	}
+
+	return [4]float64{values[0], values[1], values[2], values[3]}, true
+}
+
+func validLatLon(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// parseFlatFilter разбирает фильтры min_price, max_price, min_area и max_area.
+func parseFlatFilter(query url.Values) (models.FlatFilter, bool) {
+	var filter models.FlatFilter
+
+	for name, target := range map[string]**int{"min_price": &filter.MinPrice, "max_price": &filter.MaxPrice} {
+		if !query.Has(name) {
+			continue
+		}
+		value, err := strconv.Atoi(query.Get(name))
+		if err != nil || value < 0 {
+			return models.FlatFilter{}, false
+		}
+		*target = &value
+	}
+
+	for name, target := range map[string]**float64{"min_area": &filter.MinArea, "max_area": &filter.MaxArea} {
+		if !query.Has(name) {
+			continue
+		}
+		values, ok := parseFloatParams(query, name)
+		if !ok || values[0] < 0 {
+			return models.FlatFilter{}, false
+		}
+		*target = &values[0]
+	}
+
+	return filter, true
+}
+
+func readMultipartFile(fileHeader *multipart.FileHeader) ([]byte, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, maxPhotoSize))
+}
+
+// decodeJSON разбирает JSON-тело запроса размером не больше maxJSONBodySize.
+// При ошибке отвечает клиенту и возвращает false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBodySize)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "слишком большой запрос", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
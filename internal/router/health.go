@@ -0,0 +1,194 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/migrator"
+)
+
+// readinessPingTimeout ограничивает проверку базы в /readyz: балансировщик не должен ждать дольше своего таймаута
+const readinessPingTimeout = 2 * time.Second
+
+// Pinger проверяет доступность базы данных, например *sqlx.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// SchemaCheck возвращает текущую версию схемы базы, например через migrator.CheckSchema.
+type SchemaCheck func(ctx context.Context) (migrator.Schema, error)
+
+// readOnlyAllowed - изменяющие запросы, которые не пишут в таблицы схемы и поэтому разрешены
+// в режиме только для чтения
+var readOnlyAllowed = map[string]bool{
+	"/login": true,
+}
+
+// Health отвечает на проверки живости и готовности. Если схема базы не совпадает со встроенными миграциями,
+// сервис не готов; в режиме только для чтения схема новее сервиса допускается, но изменяющие запросы отклоняются.
+type Health struct {
+	db          Pinger
+	app         *app.App
+	checkSchema SchemaCheck
+	readOnly    bool
+	schema      atomic.Pointer[schemaState]
+	draining    atomic.Bool
+}
+
+// schemaState - результат последней проверки схемы. err - ошибка самой проверки, например недоступность базы.
+type schemaState struct {
+	schema migrator.Schema
+	err    error
+}
+
+// NewHealth создает проверки. schema - результат проверки схемы при запуске; checkSchema повторяет ее
+// в Watch, чтобы готовность и режим только для чтения менялись вслед за миграциями; nil - схема считается
+// неизменной. readOnly соответствует SCHEMA_MISMATCH=readonly.
+func NewHealth(db Pinger, app *app.App, schema migrator.Schema, checkSchema SchemaCheck, readOnly bool) *Health {
+	h := &Health{db: db, app: app, checkSchema: checkSchema, readOnly: readOnly}
+	h.schema.Store(&schemaState{schema: schema})
+
+	return h
+}
+
+// Watch раз в interval проверяет схему базы. Завершается вместе с ctx.
+func (h *Health) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		h.RefreshSchema(ctx)
+	}
+}
+
+// RefreshSchema проверяет схему базы и запоминает результат для /readyz и ReadOnly.
+func (h *Health) RefreshSchema(ctx context.Context) {
+	if h.checkSchema == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessPingTimeout)
+	defer cancel()
+
+	schema, err := h.checkSchema(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "проверка схемы базы данных", "error", err)
+		// прежняя версия схемы остается для ответа /readyz
+		schema = h.schema.Load().schema
+	}
+
+	h.schema.Store(&schemaState{schema: schema, err: err})
+}
+
+// schemaReadOnly сообщает, что схема не совпадает, но в режиме только для чтения с ней можно работать.
+func (h *Health) schemaReadOnly(schema migrator.Schema) bool {
+	return h.readOnly && schema.ReadOnlyCompatible()
+}
+
+// Drain переключает /readyz в неготовое состояние, чтобы балансировщики перестали присылать запросы
+// до остановки сервера. Уже принятые запросы продолжают обрабатываться.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+type healthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type schemaCheck struct {
+	healthCheck
+	migrator.Schema
+}
+
+// senderCheck не влияет на готовность: очередь уведомлений только показывается для наблюдения
+type senderCheck struct {
+	Backlog int64 `json:"backlog"`
+}
+
+// Alive отвечает на /healthz: процесс запущен и обрабатывает запросы. Зависимости не проверяются,
+// чтобы недоступная база не приводила к перезапуску сервиса.
+func (h *Health) Alive(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// Ready отвечает на /readyz: 200, если сервис может обслуживать запросы, иначе 503 с причиной.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	status := "ok"
+
+	database := healthCheck{Status: "ok"}
+	ctx, cancel := context.WithTimeout(r.Context(), readinessPingTimeout)
+	defer cancel()
+	if err := h.db.PingContext(ctx); err != nil {
+		database.Status, database.Error = "fail", err.Error()
+		status = "fail"
+	}
+
+	state := h.schema.Load()
+	schema := schemaCheck{healthCheck: healthCheck{Status: "ok"}, Schema: state.schema}
+	if state.err != nil {
+		schema.Status, schema.Error = "fail", state.err.Error()
+		status = "fail"
+	} else if err := state.schema.Err(); err != nil {
+		schema.Error = err.Error()
+		if h.schemaReadOnly(state.schema) {
+			// в режиме только для чтения сервис остается готовым: чтение работает, причина видна в ответе
+			schema.Status = "read-only"
+		} else {
+			schema.Status, status = "fail", "fail"
+		}
+	}
+
+	sender := senderCheck{Backlog: h.app.SenderBacklog()}
+
+	if h.draining.Load() {
+		status = "draining"
+	}
+
+	responseJson, err := json.Marshal(struct {
+		Status   string      `json:"status"`
+		Database healthCheck `json:"database"`
+		Schema   schemaCheck `json:"schema"`
+		Sender   senderCheck `json:"sender"`
+	}{Status: status, Database: database, Schema: schema, Sender: sender})
+	if err != nil {
+		http.Error(w, "ошибка создания ответа", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(responseJson)
+}
+
+// ReadOnly в режиме SCHEMA_MISMATCH=readonly отклоняет изменяющие запросы, пока схема базы при последней проверке
+// не совпадает со встроенными миграциями. Вход разрешен, чтобы клиенты могли получить токен для чтения.
+func (h *Health) ReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions || readOnlyAllowed[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := h.schema.Load().schema.Err(); h.readOnly && err != nil {
+			http.Error(w, "сервис работает в режиме только для чтения: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
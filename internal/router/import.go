@@ -0,0 +1,258 @@
+package router
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxImportSize = 10 << 20 // байт
+	maxImportRows = 5000
+
+	csvPhotosSeparator = "|"
+)
+
+// importRowError описывает ошибку в строке импорта. Строки нумеруются с 1 без учета заголовка CSV.
+type importRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ImportFlats принимает квартиры дома массивом JSON или CSV с заголовком
+// price,rooms,area,floor,description,photos. Если хотя бы одна строка неверна,
+// не создается ни одной квартиры, а в ответе перечисляются ошибки по строкам.
+func (h *Handler) ImportFlats(w http.ResponseWriter, r *http.Request) {
+	houseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "неверный формат ID дома", http.StatusBadRequest)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, "не указан тип содержимого", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	var (
+		rows      []flatData
+		rowErrors []importRowError
+	)
+
+	switch mediaType {
+	case "application/json":
+		rows, rowErrors, err = parseJSONFlats(r.Body)
+	case "text/csv":
+		rows, rowErrors, err = parseCSVFlats(r.Body)
+	default:
+		http.Error(w, "поддерживаются только application/json и text/csv", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, "слишком большой файл импорта", http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("неверный формат запроса: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(rows) == 0 {
+		http.Error(w, "нет квартир для импорта", http.StatusBadRequest)
+		return
+	} else if len(rows) > maxImportRows {
+		http.Error(w, fmt.Sprintf("слишком много квартир, максимум %d", maxImportRows), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	failed := make(map[int]bool, len(rowErrors))
+	for _, rowError := range rowErrors {
+		failed[rowError.Row] = true
+	}
+
+	flats := make([]models.Flat, 0, len(rows))
+	for i, row := range rows {
+		if failed[i+1] {
+			continue
+		}
+
+		if message := row.validate(); message != "" {
+			rowErrors = append(rowErrors, importRowError{Row: i + 1, Error: message})
+			continue
+		}
+
+		row.HouseID = houseID
+		flats = append(flats, row.toModel())
+	}
+
+	if len(rowErrors) > 0 {
+		sort.Slice(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+
+		reportJson, err := json.Marshal(struct {
+			Errors []importRowError `json:"errors"`
+		}{Errors: rowErrors})
+		if err != nil {
+			http.Error(w, "ошибка создания ответа", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write(reportJson)
+		return
+	}
+
+	created, err := h.app.ImportFlats(r.Context(), houseID, flats)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "дом не найден", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "ошибка импорта квартир", http.StatusInternalServerError)
+		return
+	}
+
+	flatsJson, err := json.Marshal(created)
+	if err != nil {
+		http.Error(w, "ошибка создания ответа", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(flatsJson)
+}
+
+// parseJSONFlats разбирает массив квартир. Строки с ошибкой формата попадают в отчет,
+// но остаются в результате, чтобы нумерация строк совпадала.
+func parseJSONFlats(body io.Reader) ([]flatData, []importRowError, error) {
+	var rawRows []json.RawMessage
+	if err := json.NewDecoder(body).Decode(&rawRows); err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([]flatData, len(rawRows))
+	var rowErrors []importRowError
+	for i, rawRow := range rawRows {
+		decoder := json.NewDecoder(strings.NewReader(string(rawRow)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rows[i]); err != nil {
+			rowErrors = append(rowErrors, importRowError{Row: i + 1, Error: fmt.Sprintf("неверный формат строки: %v", err)})
+		}
+	}
+
+	return rows, rowErrors, nil
+}
+
+func parseCSVFlats(body io.Reader) ([]flatData, []importRowError, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if _, ok := columns[column]; ok {
+			return nil, nil, fmt.Errorf("повторяется колонка %q", column)
+		}
+
+		switch column {
+		case "price", "rooms", "area", "floor", "description", "photos":
+			columns[column] = i
+		default:
+			return nil, nil, fmt.Errorf("неизвестная колонка %q", column)
+		}
+	}
+
+	for _, required := range []string{"price", "rooms"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("нет обязательной колонки %q", required)
+		}
+	}
+
+	var (
+		rows      []flatData
+		rowErrors []importRowError
+	)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		row, err := parseCSVFlat(record, columns)
+		if err != nil {
+			rowErrors = append(rowErrors, importRowError{Row: len(rows) + 1, Error: err.Error()})
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+func parseCSVFlat(record []string, columns map[string]int) (flatData, error) {
+	if len(record) != len(columns) {
+		return flatData{}, fmt.Errorf("ожидается колонок: %d, получено: %d", len(columns), len(record))
+	}
+
+	var (
+		row flatData
+		err error
+	)
+
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	if row.Price, err = strconv.Atoi(field("price")); err != nil {
+		return flatData{}, errors.New("неверная цена")
+	}
+
+	if row.Rooms, err = strconv.Atoi(field("rooms")); err != nil {
+		return flatData{}, errors.New("неверное количество комнат")
+	}
+
+	if value := field("area"); value != "" {
+		if row.Area, err = strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64); err != nil {
+			return flatData{}, errors.New("неверная площадь")
+		}
+	}
+
+	if value := field("floor"); value != "" {
+		if row.Floor, err = strconv.Atoi(value); err != nil {
+			return flatData{}, errors.New("неверный этаж")
+		}
+	}
+
+	row.Description = field("description")
+
+	if value := field("photos"); value != "" {
+		row.Photos = strings.Split(value, csvPhotosSeparator)
+	}
+
+	return row, nil
+}
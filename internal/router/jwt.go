@@ -1,17 +1,42 @@
 package router
 
 import (
+	"errors"
+	"sync/atomic"
+
 	"github.com/Vykiy/house-service/internal/models"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// JWTIssuer подписывает токены текущим секретом и принимает токены, подписанные текущим или одним из
+// предыдущих секретов, чтобы при смене секрета уже выданные токены продолжали работать.
 type JWTIssuer struct {
-	jwtSecret string
+	keys atomic.Pointer[jwtKeys]
+}
+
+// errInvalidClaims - токен подписан верно, но в нем нет нужных полей
+var errInvalidClaims = errors.New("неверные данные в токене")
+
+type jwtKeys struct {
+	signing []byte
+	verify  jwt.VerificationKeySet
 }
 
-func NewJWTIssuer(jwtSecret string) *JWTIssuer {
-	return &JWTIssuer{jwtSecret: jwtSecret}
+func NewJWTIssuer(jwtSecret string, previousSecrets ...string) *JWTIssuer {
+	issuer := &JWTIssuer{}
+	issuer.SetSecrets(jwtSecret, previousSecrets...)
+	return issuer
+}
+
+// SetSecrets заменяет набор ключей. Запросы, которые уже проверяют токен, используют прежний набор.
+func (j *JWTIssuer) SetSecrets(jwtSecret string, previousSecrets ...string) {
+	keys := &jwtKeys{signing: []byte(jwtSecret)}
+	for _, secret := range append([]string{jwtSecret}, previousSecrets...) {
+		keys.verify.Keys = append(keys.verify.Keys, []byte(secret))
+	}
+
+	j.keys.Store(keys)
 }
 
 func (j *JWTIssuer) IssueToken(userType models.UserType, userID uuid.UUID) (string, error) {
@@ -20,28 +45,35 @@ func (j *JWTIssuer) IssueToken(userType models.UserType, userID uuid.UUID) (stri
 		"user_id":   userID.String(),
 	})
 
-	return token.SignedString([]byte(j.jwtSecret))
+	return token.SignedString(j.keys.Load().signing)
 }
 
 func (j *JWTIssuer) ParseToken(tokenString string) (models.UserType, uuid.UUID, error) {
+	keys := j.keys.Load()
+	// алгоритм фиксирован, чтобы токен не мог выбрать другой способ проверки подписи
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(j.jwtSecret), nil
-	})
+		return keys.verify, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
 		return models.UserTypeUnknown, uuid.Nil, err
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return models.UserTypeUnknown, uuid.Nil, err
+		return models.UserTypeUnknown, uuid.Nil, errInvalidClaims
 	}
 
 	userType, ok := claims["user_type"].(string)
 	if !ok {
-		return models.UserTypeUnknown, uuid.Nil, err
+		return models.UserTypeUnknown, uuid.Nil, errInvalidClaims
+	}
+
+	userIDClaim, ok := claims["user_id"].(string)
+	if !ok {
+		return models.UserTypeUnknown, uuid.Nil, errInvalidClaims
 	}
 
-	userID, err := uuid.Parse(claims["user_id"].(string))
+	userID, err := uuid.Parse(userIDClaim)
 	if err != nil {
 		return models.UserTypeUnknown, uuid.Nil, err
 	}
@@ -4,11 +4,16 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/Vykiy/house-service/internal/logging"
 	"github.com/Vykiy/house-service/internal/models"
+	"github.com/Vykiy/house-service/internal/tlsutil"
 	"github.com/google/uuid"
 )
 
-const userIDCtxKey = "user_id"
+const (
+	userIDCtxKey   = "user_id"
+	userTypeCtxKey = "user_type"
+)
 
 type Middleware struct {
 	jwtIssuer *JWTIssuer
@@ -20,29 +25,35 @@ func NewMiddleware(jwtIssuer *JWTIssuer) *Middleware {
 
 func (m *Middleware) UserAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userType, _, err := m.parseUserFromHeader(r.Header)
+		userType, userID, err := m.parseUser(r)
 		if err != nil {
 			http.Error(w, "неверный токен", http.StatusUnauthorized)
 			return
 		}
 
+		logging.SetUserID(r.Context(), userID)
+
 		if userType != models.UserTypeUser && userType != models.UserTypeModerator {
 			http.Error(w, "недостаточно прав", http.StatusForbidden)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), userTypeCtxKey, userType)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
 func (m *Middleware) ModeratorAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userType, userID, err := m.parseUserFromHeader(r.Header)
+		userType, userID, err := m.parseUser(r)
 		if err != nil {
 			http.Error(w, "неверный токен", http.StatusUnauthorized)
 			return
 		}
 
+		logging.SetUserID(r.Context(), userID)
+
 		if userType != models.UserTypeModerator {
 			http.Error(w, "недостаточно прав", http.StatusForbidden)
 			return
@@ -54,9 +65,13 @@ func (m *Middleware) ModeratorAuth(next http.Handler) http.Handler {
 	})
 }
 
-func (m *Middleware) parseUserFromHeader(header http.Header) (models.UserType, uuid.UUID, error) {
-	jwt := header.Get("Authorization")
+// parseUser определяет пользователя по токену, а без токена - по проверенному клиентскому сертификату сервиса.
+func (m *Middleware) parseUser(r *http.Request) (models.UserType, uuid.UUID, error) {
+	jwt := r.Header.Get("Authorization")
 	if jwt == "" {
+		if principal, ok := tlsutil.PrincipalFromContext(r.Context()); ok {
+			return principal.UserType, principal.UserID, nil
+		}
 		return models.UserTypeUnknown, uuid.Nil, nil
 	}
 
@@ -0,0 +1,191 @@
+package router
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Vykiy/house-service/internal/ratelimit"
+)
+
+// AuthLimits - ограничения /login и /register: частота запросов с одного IP, частота попыток
+// для одной учетной записи и блокировка после неудачных паролей. TrustedProxies - подсети
+// прокси, от которых принимается X-Forwarded-For.
+type AuthLimits struct {
+	IP             ratelimit.Limit
+	Account        ratelimit.Limit
+	Lockout        ratelimit.LockoutPolicy
+	TrustedProxies []netip.Prefix
+}
+
+// AuthGuard защищает вход и регистрацию от перебора: bcrypt делает каждую попытку дорогой для сервиса.
+// Методы можно вызывать у nil, тогда ограничений нет.
+type AuthGuard struct {
+	ip      *ratelimit.Limiter
+	account *ratelimit.Limiter
+	lockout *ratelimit.Lockout
+	proxies atomic.Pointer[[]netip.Prefix]
+}
+
+func NewAuthGuard(store ratelimit.Store, limits AuthLimits) *AuthGuard {
+	g := &AuthGuard{
+		ip:      ratelimit.NewLimiter(store, "ip:", limits.IP),
+		account: ratelimit.NewLimiter(store, "account:", limits.Account),
+		lockout: ratelimit.NewLockout(store, limits.Lockout),
+	}
+	g.proxies.Store(&limits.TrustedProxies)
+	return g
+}
+
+// SetLimits меняет ограничения на лету, накопленное состояние корзин и счетчиков сохраняется.
+func (g *AuthGuard) SetLimits(limits AuthLimits) {
+	g.ip.SetLimit(limits.IP)
+	g.account.SetLimit(limits.Account)
+	g.lockout.SetPolicy(limits.Lockout)
+	g.proxies.Store(&limits.TrustedProxies)
+}
+
+// LimitIP ограничивает частоту запросов с одного адреса. Адрес берется из соединения;
+// X-Forwarded-For учитывается, только если соединение пришло от доверенного прокси.
+func (g *AuthGuard) LimitIP(next http.Handler) http.Handler {
+	if g == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait, err := g.ip.Allow(r.Context(), clientIP(r, *g.proxies.Load()))
+		if !g.allowed(w, r, wait, err, "слишком много запросов") {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP возвращает адрес клиента. Если соединение пришло от доверенного прокси, адреса
+// из X-Forwarded-For просматриваются справа налево до первого недоверенного: его добавил
+// последний доверенный прокси, а все, что левее, клиент мог написать сам.
+func clientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !isTrustedProxy(peer.Unmap(), trusted) {
+		return host
+	}
+
+	var forwarded []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(value, ",")...)
+	}
+
+	client := peer.Unmap()
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+
+		client = addr.Unmap()
+		if !isTrustedProxy(client, trusted) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+func isTrustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowLogin проверяет частоту попыток входа в account и блокировку после неудачных паролей.
+// При отказе отвечает 429 с Retry-After и возвращает false.
+func (g *AuthGuard) allowLogin(w http.ResponseWriter, r *http.Request, account string) bool {
+	if g == nil {
+		return true
+	}
+
+	if !g.allowAccount(w, r, "login:"+account) {
+		return false
+	}
+
+	wait, err := g.lockout.Check(r.Context(), account)
+	return g.allowed(w, r, wait, err, "слишком много неудачных попыток входа, повторите позже")
+}
+
+// allowRegister ограничивает частоту регистраций на один адрес почты.
+func (g *AuthGuard) allowRegister(w http.ResponseWriter, r *http.Request, email string) bool {
+	if g == nil {
+		return true
+	}
+
+	return g.allowAccount(w, r, "register:"+strings.ToLower(email))
+}
+
+func (g *AuthGuard) allowAccount(w http.ResponseWriter, r *http.Request, key string) bool {
+	wait, err := g.account.Allow(r.Context(), key)
+	return g.allowed(w, r, wait, err, "слишком много запросов")
+}
+
+// loginFailed учитывает неверный пароль. Возвращает блокировку, которая начинает действовать после этой попытки.
+func (g *AuthGuard) loginFailed(ctx context.Context, account string) time.Duration {
+	if g == nil {
+		return 0
+	}
+
+	wait, err := g.lockout.Failure(ctx, account)
+	if err != nil {
+		slog.ErrorContext(ctx, "учет неудачной попытки входа", "error", err)
+		return 0
+	}
+
+	return wait
+}
+
+func (g *AuthGuard) loginSucceeded(ctx context.Context, account string) {
+	if g == nil {
+		return
+	}
+
+	if err := g.lockout.Success(ctx, account); err != nil {
+		slog.ErrorContext(ctx, "сброс неудачных попыток входа", "error", err)
+	}
+}
+
+// allowed отвечает 429, если wait > 0. Ошибка хранилища не блокирует вход: недоступность базы
+// ограничений не должна выключать авторизацию целиком.
+func (g *AuthGuard) allowed(w http.ResponseWriter, r *http.Request, wait time.Duration, err error, message string) bool {
+	if err != nil {
+		slog.ErrorContext(r.Context(), "проверка ограничения запросов", "error", err)
+		return true
+	}
+
+	if wait <= 0 {
+		return true
+	}
+
+	setRetryAfter(w, wait)
+	http.Error(w, message, http.StatusTooManyRequests)
+	return false
+}
+
+// setRetryAfter записывает ожидание в целых секундах с округлением вверх.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(wait.Seconds())))))
+}
@@ -0,0 +1,53 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/Vykiy/house-service/internal/httputil"
+	"github.com/Vykiy/house-service/internal/logging"
+)
+
+// Recover перехватывает панику в обработчике, логирует ее со стеком и отвечает 500 с JSON-описанием ошибки,
+// в котором есть идентификатор запроса для поиска в логах. Если ответ уже начат, соединение обрывается.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := httputil.NewResponseRecorder(w)
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// net/http использует эту панику, чтобы молча оборвать ответ
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			slog.ErrorContext(r.Context(), "паника при обработке запроса", "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+
+			if recorder.Written() {
+				panic(http.ErrAbortHandler)
+			}
+
+			responseJson, err := json.Marshal(struct {
+				Message   string `json:"message"`
+				RequestID string `json:"request_id,omitempty"`
+			}{Message: "внутренняя ошибка сервера", RequestID: logging.RequestID(r.Context())})
+			if err != nil {
+				http.Error(recorder, "внутренняя ошибка сервера", http.StatusInternalServerError)
+				return
+			}
+
+			recorder.Header().Set("Content-Type", "application/json")
+			recorder.Header().Del("Content-Disposition")
+			recorder.WriteHeader(http.StatusInternalServerError)
+			recorder.Write(responseJson)
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
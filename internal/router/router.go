@@ -4,24 +4,66 @@ import (
 	"net/http"
 
 	"github.com/Vykiy/house-service/internal/app"
+	"github.com/Vykiy/house-service/internal/logging"
+	"github.com/Vykiy/house-service/internal/metrics"
+	"github.com/Vykiy/house-service/internal/tracing"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
-func NewRouter(app *app.App, jwtIssuer *JWTIssuer) *mux.Router {
+// NewRouter создает маршрутизатор. photos раздает загруженные фотографии по подписанным ссылкам
+// и может быть nil, если хранилище выдает ссылки на внешний сервис (например, S3).
+// auth ограничивает вход и регистрацию; nil - без ограничений. cors с пустым списком источников выключает CORS.
+func NewRouter(app *app.App, jwtIssuer *JWTIssuer, photos http.Handler, health *Health, auth *AuthGuard, cors CORSConfig) *mux.Router {
 	router := mux.NewRouter()
 
-	handler := NewHandler(app, jwtIssuer)
+	// otelmux извлекает W3C trace-context из заголовков и открывает спан с шаблоном маршрута в имени.
+	// Recover стоит после журнала, метрик и трассировки, чтобы паника попала в них как ответ 500
+	middlewares := []mux.MiddlewareFunc{logging.RequestIDMiddleware, SecurityHeaders, logging.AccessLog, otelmux.Middleware(tracing.ServiceName), metrics.Middleware, Recover, cors.Middleware, health.ReadOnly}
+	router.Use(middlewares...)
+
+	// mux применяет Use только к найденным маршрутам, поэтому ответы 404 и 405 проходят ту же цепочку отдельно
+	chain := func(handler http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+	router.NotFoundHandler = chain(http.NotFoundHandler())
+	router.MethodNotAllowedHandler = chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+
+	handler := NewHandler(app, jwtIssuer, auth)
 
 	middleware := NewMiddleware(jwtIssuer)
 
-	router.Handle("/dummyLogin", http.HandlerFunc(handler.DummyLogin)).Methods("GET")
-	router.Handle("/login", http.HandlerFunc(handler.Login)).Methods("POST")
-	router.Handle("/register", http.HandlerFunc(handler.Register)).Methods("POST")
-	router.Handle("/house/create", middleware.ModeratorAuth(http.HandlerFunc(handler.CreateHouse))).Methods("POST")
-	router.Handle("/house/{id}", middleware.UserAuth(http.HandlerFunc(handler.GetFlats))).Methods("GET")
-	router.Handle("/flat/create", middleware.UserAuth(http.HandlerFunc(handler.CreateFlat))).Methods("POST")
-	router.Handle("/flat/update", middleware.ModeratorAuth(http.HandlerFunc(handler.UpdateFlat))).Methods("POST")
-	router.Handle("/house/{id}/subscribe", middleware.UserAuth(http.HandlerFunc(handler.SubscribeToNewFlats))).Methods("POST")
+	// OPTIONS добавляется к каждому маршруту, чтобы на предварительные запросы CORS отвечал cors.Middleware
+	handle := func(path string, handler http.Handler, method string) {
+		router.Handle(path, handler).Methods(method, http.MethodOptions)
+	}
+
+	handle("/healthz", http.HandlerFunc(health.Alive), http.MethodGet)
+	handle("/readyz", http.HandlerFunc(health.Ready), http.MethodGet)
+	handle("/dummyLogin", http.HandlerFunc(handler.DummyLogin), http.MethodGet)
+	handle("/login", auth.LimitIP(http.HandlerFunc(handler.Login)), http.MethodPost)
+	handle("/register", auth.LimitIP(http.HandlerFunc(handler.Register)), http.MethodPost)
+	handle("/export/houses", middleware.ModeratorAuth(http.HandlerFunc(handler.ExportHouses)), http.MethodGet)
+	handle("/export/flats", middleware.ModeratorAuth(http.HandlerFunc(handler.ExportFlats)), http.MethodGet)
+	handle("/house/create", middleware.ModeratorAuth(http.HandlerFunc(handler.CreateHouse)), http.MethodPost)
+	handle("/houses/nearby", middleware.UserAuth(http.HandlerFunc(handler.GetHousesNearby)), http.MethodGet)
+	handle("/house/{id}", middleware.UserAuth(http.HandlerFunc(handler.GetFlats)), http.MethodGet)
+	handle("/flat/create", middleware.UserAuth(http.HandlerFunc(handler.CreateFlat)), http.MethodPost)
+	handle("/flat/update", middleware.ModeratorAuth(http.HandlerFunc(handler.UpdateFlat)), http.MethodPost)
+	handle("/flat/{id}/price", middleware.ModeratorAuth(http.HandlerFunc(handler.UpdateFlatPrice)), http.MethodPost)
+	handle("/flat/{id}/prices", middleware.UserAuth(http.HandlerFunc(handler.GetFlatPrices)), http.MethodGet)
+	handle("/flat/{id}/photos", middleware.ModeratorAuth(http.HandlerFunc(handler.UploadFlatPhotos)), http.MethodPost)
+	handle("/house/{id}/flats:import", middleware.UserAuth(http.HandlerFunc(handler.ImportFlats)), http.MethodPost)
+	handle("/house/{id}/subscribe", middleware.UserAuth(http.HandlerFunc(handler.SubscribeToNewFlats)), http.MethodPost)
+
+	if photos != nil {
+		router.PathPrefix("/photos/").Handler(http.StripPrefix("/photos/", photos)).Methods(http.MethodGet, http.MethodOptions)
+	}
 
 	return router
 }
@@ -2,28 +2,106 @@ package sender
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"sync/atomic"
 	"time"
+
+	"github.com/Vykiy/house-service/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type Sender struct{}
+var tracer = otel.Tracer("github.com/Vykiy/house-service/internal/sender")
+
+// Backend доставляет уведомление получателю. headers - заголовки исходящего сообщения с trace-context.
+type Backend interface {
+	Send(ctx context.Context, recipient, message string, headers map[string]string) error
+}
+
+// Simulated имитирует почтовый сервис: отвечает со случайной задержкой до MaxDelay
+// и с вероятностью FailureRate завершается ошибкой.
+type Simulated struct {
+	MaxDelay    time.Duration
+	FailureRate float64
+}
+
+func (s Simulated) Send(ctx context.Context, recipient, message string, headers map[string]string) error {
+	if s.MaxDelay > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(s.MaxDelay))))
+	}
+
+	if rand.Float64() < s.FailureRate {
+		return errors.New("сообщение не отправлено")
+	}
+
+	return nil
+}
+
+// Discard ничего не отправляет, уведомления только логируются.
+type Discard struct{}
+
+func (Discard) Send(ctx context.Context, recipient, message string, headers map[string]string) error {
+	return nil
+}
+
+// NewBackend создает отправителя по имени: simulated или discard.
+func NewBackend(name string, maxDelay time.Duration, failureRate float64) (Backend, error) {
+	switch name {
+	case "simulated":
+		return Simulated{MaxDelay: maxDelay, FailureRate: failureRate}, nil
+	case "discard":
+		return Discard{}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный способ отправки уведомлений: %s", name)
+	}
+}
+
+type Sender struct {
+	backlog atomic.Int64
+	backend atomic.Pointer[Backend]
+}
 
 func New() *Sender {
-	return &Sender{}
+	s := &Sender{}
+	s.SetBackend(Simulated{MaxDelay: 3 * time.Second, FailureRate: 0.1})
+	return s
 }
 
+// SetBackend заменяет способ отправки. Уведомления, которые уже отправляются, завершаются прежним способом.
+func (s *Sender) SetBackend(backend Backend) {
+	s.backend.Store(&backend)
+}
+
+// Backlog возвращает число писем, отправка которых еще не завершилась.
+func (s *Sender) Backlog() int64 {
+	return s.backlog.Load()
+}
+
+// SendEmail отправляет уведомление. ctx несет спан запроса, вызвавшего отправку: trace-context
+// передается получателю в заголовках traceparent и tracestate, как в исходящем вебхуке.
 func (s *Sender) SendEmail(ctx context.Context, recipient string, message string) {
-	// Имитация отправки сообщения
-	duration := time.Duration(rand.Int63n(3000)) * time.Millisecond
-	time.Sleep(duration)
-
-	// Имитация неуспешной отправки сообщения
-	errorProbability := 0.1
-	if rand.Float64() < errorProbability {
-		fmt.Printf("failed to send message '%s' to '%s'\n", message, recipient)
+	s.backlog.Add(1)
+	defer s.backlog.Add(-1)
+
+	ctx, span := tracer.Start(ctx, "Sender.SendEmail", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	headers := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, headers)
+
+	backend := *s.backend.Load()
+	if err := backend.Send(ctx, recipient, message, headers); err != nil {
+		slog.WarnContext(ctx, "уведомление не отправлено", "recipient", recipient, "message", message, "traceparent", headers.Get("traceparent"), "error", err)
+		span.SetStatus(codes.Error, err.Error())
+		metrics.ObserveEmail(false)
 		return
 	}
 
-	fmt.Printf("send message '%s' to '%s'\n", message, recipient)
+	slog.InfoContext(ctx, "уведомление отправлено", "recipient", recipient, "message", message, "traceparent", headers.Get("traceparent"))
+	metrics.ObserveEmail(true)
 }
@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrNotFound = errors.New("объект не найден")
+
+// Storage хранит бинарные объекты (фотографии квартир) по ключу.
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, body io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL возвращает ссылку на объект, действительную в течение ttl.
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
@@ -0,0 +1,74 @@
+package tlsutil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Vykiy/house-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// principalNamespace - пространство имен UUID сервисов: один и тот же сервис всегда получает один идентификатор
+var principalNamespace = uuid.MustParse("5b0c4e3e-6f47-4a55-9d7c-2a1c8f0f7a51")
+
+// Principal - сервис, который представился проверенным клиентским сертификатом.
+type Principal struct {
+	Name     string
+	UserType models.UserType
+	UserID   uuid.UUID
+}
+
+type ctxKey struct{}
+
+// PrincipalFromContext возвращает сервис, сопоставленный клиентскому сертификату запроса.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(ctxKey{}).(Principal)
+	return principal, ok
+}
+
+// Principals сопоставляет имя из клиентского сертификата с типом пользователя, с правами которого работает сервис.
+// Имя - Common Name сертификата, а если его нет - первое DNS-имя.
+type Principals map[string]models.UserType
+
+// ParsePrincipals разбирает записи вида "имя=роль", где роль - user или moderator.
+func ParsePrincipals(entries []string) (Principals, error) {
+	principals := make(Principals, len(entries))
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(entry, "=")
+		name, role := strings.TrimSpace(name), models.UserType(strings.TrimSpace(value))
+		if !ok || name == "" || (role != models.UserTypeUser && role != models.UserTypeModerator) {
+			return nil, fmt.Errorf("%q: ожидается запись вида имя=user или имя=moderator", entry)
+		}
+		principals[name] = role
+	}
+
+	return principals, nil
+}
+
+// Middleware кладет в контекст сервис, если клиент предъявил сертификат, прошедший проверку по CA,
+// и его имя есть в списке. Непроверенные и неизвестные сертификаты не дают никаких прав.
+func (p Principals) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(p) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		leaf := r.TLS.VerifiedChains[0][0]
+		name := leaf.Subject.CommonName
+		if name == "" && len(leaf.DNSNames) > 0 {
+			name = leaf.DNSNames[0]
+		}
+
+		userType, ok := p[name]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal := Principal{Name: name, UserType: userType, UserID: uuid.NewSHA1(principalNamespace, []byte(name))}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, principal)))
+	})
+}
@@ -0,0 +1,175 @@
+// Package tlsutil настраивает TLS сервера: сертификаты перечитываются при изменении файлов без
+// перезапуска, клиентские сертификаты проверяются по заданному CA и сопоставляются с сервисами.
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientAuth - проверка клиентских сертификатов: none - не запрашиваются, optional - проверяются,
+// если клиент их прислал, require - без проверенного сертификата соединение отклоняется.
+type ClientAuth string
+
+const (
+	ClientAuthNone     ClientAuth = "none"
+	ClientAuthOptional ClientAuth = "optional"
+	ClientAuthRequire  ClientAuth = "require"
+)
+
+func (c ClientAuth) tlsType() tls.ClientAuthType {
+	switch c {
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert
+	default:
+		return tls.NoClientCert
+	}
+}
+
+// Reloader хранит TLS-конфигурацию сервера и пересобирает ее, когда меняются файлы сертификата,
+// ключа или CA клиентов. Уже установленные соединения продолжают работать со старым сертификатом.
+type Reloader struct {
+	certFile, keyFile, clientCAFile string
+	clientAuth                      ClientAuth
+
+	mu      sync.Mutex // не дает двум перезагрузкам идти одновременно
+	modTime map[string]time.Time
+	config  atomic.Pointer[tls.Config]
+}
+
+// NewReloader загружает сертификат и ключ. clientCAFile может быть пустым, если clientAuth - none.
+func NewReloader(certFile, keyFile, clientCAFile string, clientAuth ClientAuth) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile, clientAuth: clientAuth}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// TLSConfig возвращает конфигурацию для http.Server. Каждое рукопожатие получает текущую версию.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// GetCertificate нужен, чтобы ListenAndServeTLS не требовал пути к файлам
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &r.config.Load().Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.config.Load(), nil
+		},
+	}
+}
+
+// Reload перечитывает файлы. При ошибке продолжает действовать прежняя конфигурация.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки сертификата TLS: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+		ClientAuth:   r.clientAuth.tlsType(),
+	}
+
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения CA клиентских сертификатов: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("в файле CA клиентских сертификатов нет сертификатов")
+		}
+		config.ClientCAs = pool
+	}
+
+	r.config.Store(config)
+	r.modTime = modTime
+
+	return nil
+}
+
+// Watch раз в interval проверяет время изменения файлов и перечитывает их, если они изменились.
+// Завершается вместе с ctx.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !r.changed() {
+			continue
+		}
+
+		// файлы сертификата и ключа обычно заменяются не одновременно; пара, которая еще
+		// не сходится, будет перечитана на следующей проверке
+		if err := r.Reload(); err != nil {
+			slog.Error("сертификат TLS не перечитан, действует прежний", "error", err)
+			continue
+		}
+		slog.Info("сертификат TLS перечитан")
+	}
+}
+
+func (r *Reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.modTimes()
+	if err != nil {
+		return false
+	}
+
+	for file, t := range modTime {
+		if !t.Equal(r.modTime[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Reloader) modTimes() (map[string]time.Time, error) {
+	modTime := make(map[string]time.Time, 3)
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения файла TLS: %w", err)
+		}
+		modTime[file] = info.ModTime()
+	}
+
+	return modTime, nil
+}
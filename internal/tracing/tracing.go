@@ -0,0 +1,88 @@
+// Package tracing настраивает трассировку OpenTelemetry: экспорт спанов, W3C trace-context
+// и подключения к базе, в которых каждый SQL-запрос становится отдельным спаном.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/XSAM/otelsql"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const ServiceName = "house-service"
+
+// Setup настраивает глобальный провайдер трассировки. exporter - otlp, stdout или пустая строка,
+// тогда спаны не экспортируются, но trace-context из входящих запросов все равно передается дальше.
+// endpoint - адрес OTLP/HTTP коллектора, например http://localhost:4318; пустой - из OTEL_EXPORTER_OTLP_ENDPOINT.
+// Возвращает функцию, которая при остановке отправляет накопленные спаны.
+func Setup(ctx context.Context, exporter, endpoint string, stdout io.Writer) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	switch exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var options []otlptracehttp.Option
+		if endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+		}
+
+		otlpExporter, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, err
+		}
+		spanExporter = otlpExporter
+	case "stdout":
+		stdoutExporter, err := stdouttrace.New(stdouttrace.WithWriter(stdout))
+		if err != nil {
+			return nil, err
+		}
+		spanExporter = stdoutExporter
+	default:
+		return nil, fmt.Errorf("неизвестный экспортер трассировки: %s", exporter)
+	}
+
+	provider := NewProvider(sdktrace.WithBatcher(spanExporter))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// NewProvider создает провайдер трассировки с описанием сервиса. Тесты передают сюда
+// sdktrace.WithSyncer, чтобы спаны экспортировались сразу.
+func NewProvider(options ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	options = append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	}, options...)
+
+	return sdktrace.NewTracerProvider(options...)
+}
+
+// OpenDB открывает базу через database/sql с трассировкой каждого запроса.
+func OpenDB(driver, dsn string) (*sqlx.DB, error) {
+	db, err := otelsql.Open(driver, dsn, otelsql.WithAttributes(attribute.String("db.system", dbSystem(driver))))
+	if err != nil {
+		return nil, err
+	}
+
+	return sqlx.NewDb(db, driver), nil
+}
+
+func dbSystem(driver string) string {
+	if driver == "postgres" {
+		return "postgresql"
+	}
+
+	return driver
+}